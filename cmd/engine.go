@@ -105,6 +105,12 @@ func Start() {
 	// start the sync
 	task.StartSync(ctx, globalConfig)
 
+	// start the grpc server next to the http server
+	if globalConfig.Server.GRPCPort > 0 {
+		grpcServer := server.NewGRPCServer(globalConfig)
+		go grpcServer.Run(ctx)
+	}
+
 	disableHttp := os.Getenv("DISABLE_HTTP")
 
 	if disableHttp != "true" {
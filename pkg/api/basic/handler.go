@@ -76,25 +76,27 @@ func Version(c *gin.Context) {
 // @Router /healthz [get]
 func NewHealthzHandleFunc(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// check the es is running
-		esClient, err := client.NewEsPingClient(&cfg.Index.ElasticSearch)
-		if err != nil {
-			message := fmt.Sprintf("new es clinet fail: %s [address=%v]",
-				err.Error(), cfg.Index.ElasticSearch.Addresses)
-			c.String(http.StatusInternalServerError, message)
-			return
-		}
+		// check the es is running, no es while using the memory engine
+		if !cfg.Index.UseMemoryEngine() {
+			esClient, err := client.NewEsPingClient(&cfg.Index.ElasticSearch)
+			if err != nil {
+				message := fmt.Sprintf("new es clinet fail: %s [address=%v]",
+					err.Error(), cfg.Index.ElasticSearch.Addresses)
+				c.String(http.StatusInternalServerError, message)
+				return
+			}
 
-		_, err = esClient.Ping()
-		if err != nil {
-			message := fmt.Sprintf("ping elasticsearch fail: %s",
-				err.Error())
-			c.String(http.StatusInternalServerError, message)
-			return
+			_, err = esClient.Ping()
+			if err != nil {
+				message := fmt.Sprintf("ping elasticsearch fail: %s",
+					err.Error())
+				c.String(http.StatusInternalServerError, message)
+				return
+			}
 		}
 
 		// check the iam backend
-		err = components.NewIAMClient().Ping()
+		err := components.NewIAMClient().Ping()
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
 			return
@@ -0,0 +1,222 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"engine/pkg/api/search/pb"
+	"engine/pkg/indexer"
+	"engine/pkg/types"
+	"engine/pkg/util"
+)
+
+// grpcServer the grpc api, the same as the http api, the client id is set into the context by the auth interceptor
+type grpcServer struct {
+	pb.UnimplementedSearchServiceServer
+}
+
+// RegisterGRPC ...
+func RegisterGRPC(s *grpc.Server) {
+	pb.RegisterSearchServiceServer(s, &grpcServer{})
+}
+
+// Search ...
+func (s *grpcServer) Search(ctx context.Context, in *pb.SearchRequest) (*pb.SearchResponse, error) {
+	req := newSearchRequest(in)
+	if err := validateGRPCSearchRequests(ctx, req); err != nil {
+		return nil, err
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+
+	subjects, phases, err := indexer.Search(ctx, req, nil)
+	if err != nil {
+		return nil, grpcSystemError(ctx, err)
+	}
+
+	return &pb.SearchResponse{
+		Results: toPBSubjects(subjects),
+		Partial: phases.Partial(),
+		Phases:  toPBSearchPhases(phases),
+	}, nil
+}
+
+// BatchSearch ...
+func (s *grpcServer) BatchSearch(ctx context.Context, in *pb.BatchSearchRequest) (*pb.BatchSearchResponse, error) {
+	requests := make([]*types.SearchRequest, 0, len(in.Requests))
+	for _, r := range in.Requests {
+		requests = append(requests, newSearchRequest(r))
+	}
+	if err := validateGRPCSearchRequests(ctx, requests...); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	for _, req := range requests {
+		req.NowTimestamp = now
+	}
+
+	// NOTE: 单个请求失败/超时不影响整体, 每个请求的状态在status中返回
+	results, statuses := indexer.BatchSearch(ctx, requests, nil)
+
+	resp := &pb.BatchSearchResponse{Results: make([]*pb.BatchSearchResult, 0, len(results))}
+	for idx, subjects := range results {
+		resp.Results = append(resp.Results, &pb.BatchSearchResult{
+			Subjects: toPBSubjects(subjects),
+			Status: &pb.BatchSearchItemStatus{
+				Status:  statuses[idx].Status,
+				Message: statuses[idx].Message,
+				Partial: statuses[idx].Partial,
+				Phases:  toPBSearchPhases(statuses[idx].Phases),
+			},
+		})
+	}
+	return resp, nil
+}
+
+// Stats ...
+func (s *grpcServer) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	clientID := util.GetClientIDFromContext(ctx)
+
+	if in.System != "" && in.Action != "" {
+		if !isSuperClient(clientID) {
+			if err := validateSystemMatchClient(in.System, clientID); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "bad request:%s", err.Error())
+			}
+		}
+		return &pb.StatsResponse{Stats: indexer.Stats(in.System, in.Action)}, nil
+	}
+
+	if !isSuperClient(clientID) {
+		return nil, status.Error(
+			codes.PermissionDenied, "no permission:only supper app code can access the global stats",
+		)
+	}
+	return &pb.StatsResponse{Stats: totalStats()}, nil
+}
+
+// FullSync ...
+func (s *grpcServer) FullSync(ctx context.Context, in *pb.FullSyncRequest) (*pb.FullSyncResponse, error) {
+	// 敏感操作, 只有超级app code能
+	if !isSuperClient(util.GetClientIDFromContext(ctx)) {
+		return nil, status.Error(codes.PermissionDenied, "no permission")
+	}
+
+	if !triggerFullSync() {
+		return nil, status.Error(codes.Aborted, "conflict")
+	}
+	return &pb.FullSyncResponse{}, nil
+}
+
+// validateGRPCSearchRequests validate the requests by the binding tags, and check the systems match the client
+func validateGRPCSearchRequests(ctx context.Context, requests ...*types.SearchRequest) error {
+	systemIDs := set.NewStringSet()
+	for _, req := range requests {
+		if err := binding.Validator.ValidateStruct(req); err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad request:%s", util.ValidationErrorMessage(err))
+		}
+		if err := validateSingleAction(req); err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad request:%s", err.Error())
+		}
+		systemIDs.Add(req.System)
+	}
+
+	// check system
+	clientID := util.GetClientIDFromContext(ctx)
+	if isSuperClient(clientID) {
+		return nil
+	}
+	for _, systemID := range systemIDs.ToSlice() {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad request:%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// grpcSystemError the internal error with the request id, the same as util.SystemErrorJSONResponse
+func grpcSystemError(ctx context.Context, err error) error {
+	return status.Errorf(
+		codes.Internal, "system error[request_id=%v]: %s", ctx.Value(util.ContextRequestIDKey), err.Error(),
+	)
+}
+
+// newSearchRequest convert the grpc request into the search request, the attribute id is filled by the resource id
+func newSearchRequest(in *pb.SearchRequest) *types.SearchRequest {
+	req := &types.SearchRequest{
+		System:           in.System,
+		Action:           types.Action{ID: in.GetAction().GetId()},
+		SubjectType:      in.SubjectType,
+		Limit:            int(in.Limit),
+		ExpandGroups:     in.ExpandGroups,
+		WithPolicies:     in.WithPolicies,
+		TemplateIDs:      in.TemplateIds,
+		ExcludeTemplates: in.ExcludeTemplates,
+		TimeoutMs:        int(in.TimeoutMs),
+	}
+
+	if len(in.Resource) > 0 {
+		req.Resource = make(types.Resource, 0, len(in.Resource))
+		for _, node := range in.Resource {
+			req.Resource = append(req.Resource, types.ResourceNode{
+				System:    node.System,
+				Type:      node.Type,
+				ID:        node.Id,
+				Attribute: node.Attribute.AsMap(),
+			})
+		}
+		normalizeResource(req.Resource)
+	}
+
+	if len(in.Subjects) > 0 {
+		req.Subjects = make([]types.Subject, 0, len(in.Subjects))
+		for _, subject := range in.Subjects {
+			req.Subjects = append(req.Subjects, types.Subject{Type: subject.Type, ID: subject.Id})
+		}
+	}
+	return req
+}
+
+// toPBSubjects ...
+func toPBSubjects(subjects []types.Subject) []*pb.Subject {
+	pbSubjects := make([]*pb.Subject, 0, len(subjects))
+	for _, subject := range subjects {
+		pbSubject := &pb.Subject{
+			Type: subject.Type,
+			Id:   subject.ID,
+			Name: subject.Name,
+		}
+		for _, p := range subject.Policies {
+			pbSubject.Policies = append(pbSubject.Policies, &pb.MatchedPolicy{
+				Id:         p.ID,
+				TemplateId: p.TemplateID,
+				ExpiredAt:  p.ExpiredAt,
+				Type:       string(p.Type),
+			})
+		}
+		pbSubjects = append(pbSubjects, pbSubject)
+	}
+	return pbSubjects
+}
+
+// toPBSearchPhases ...
+func toPBSearchPhases(phases types.SearchPhases) *pb.SearchPhases {
+	return &pb.SearchPhases{Doc: phases.Doc, Eval: phases.Eval}
+}
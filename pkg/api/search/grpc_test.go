@@ -0,0 +1,174 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package search
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"engine/pkg/api/search/pb"
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/types"
+	"engine/pkg/util"
+)
+
+var _ = Describe("GRPC", func() {
+	BeforeEach(func() {
+		config.InitSuperAppCode("bk_iam")
+		impls.LocalSystemClientsCache = memory.NewCache(
+			"mockCache", false, func(key cache.Key) (interface{}, error) {
+				return []string{"bk_cmdb"}, nil
+			}, time.Minute)
+	})
+
+	Describe("newSearchRequest", func() {
+		It("ok", func() {
+			attribute, err := structpb.NewStruct(map[string]interface{}{"name": "web", "id": "2"})
+			assert.NoError(GinkgoT(), err)
+
+			req := newSearchRequest(&pb.SearchRequest{
+				System: "bk_cmdb",
+				Action: &pb.Action{Id: "view_host"},
+				Resource: []*pb.ResourceNode{
+					{System: "bk_cmdb", Type: "host", Id: "1", Attribute: attribute},
+					{System: "bk_cmdb", Type: "biz", Id: "3"},
+				},
+				SubjectType:  types.SubjectTypeUser,
+				Limit:        10,
+				WithPolicies: true,
+				TemplateIds:  []int64{1},
+				Subjects:     []*pb.Subject{{Type: "user", Id: "admin"}},
+				TimeoutMs:    100,
+			})
+			assert.Equal(GinkgoT(), &types.SearchRequest{
+				System: "bk_cmdb",
+				Action: types.Action{ID: "view_host"},
+				Resource: types.Resource{
+					{
+						System:    "bk_cmdb",
+						Type:      "host",
+						ID:        "1",
+						Attribute: map[string]interface{}{"name": "web", "id": "1"},
+					},
+					{System: "bk_cmdb", Type: "biz", ID: "3", Attribute: map[string]interface{}{"id": "3"}},
+				},
+				SubjectType:  types.SubjectTypeUser,
+				Limit:        10,
+				WithPolicies: true,
+				TemplateIDs:  []int64{1},
+				Subjects:     []types.Subject{{Type: "user", ID: "admin"}},
+				TimeoutMs:    100,
+			}, req)
+		})
+
+		It("empty", func() {
+			req := newSearchRequest(&pb.SearchRequest{System: "bk_cmdb"})
+			assert.Equal(GinkgoT(), "bk_cmdb", req.System)
+			assert.Equal(GinkgoT(), "", req.Action.ID)
+			assert.Nil(GinkgoT(), req.Resource)
+			assert.Nil(GinkgoT(), req.Subjects)
+		})
+	})
+
+	Describe("validateGRPCSearchRequests", func() {
+		var req *types.SearchRequest
+		BeforeEach(func() {
+			req = &types.SearchRequest{
+				System:      "bk_cmdb",
+				Action:      types.Action{ID: "view_host"},
+				Resource:    types.Resource{},
+				SubjectType: types.SubjectTypeUser,
+			}
+		})
+
+		It("ok", func() {
+			ctx := util.WithClientID(context.Background(), "bk_cmdb")
+			assert.NoError(GinkgoT(), validateGRPCSearchRequests(ctx, req))
+		})
+
+		It("super client", func() {
+			req.System = "bk_job"
+			ctx := util.WithClientID(context.Background(), "bk_iam")
+			assert.NoError(GinkgoT(), validateGRPCSearchRequests(ctx, req))
+		})
+
+		It("binding fail", func() {
+			req.SubjectType = "department"
+			ctx := util.WithClientID(context.Background(), "bk_iam")
+			err := validateGRPCSearchRequests(ctx, req)
+			assert.Equal(GinkgoT(), codes.InvalidArgument, status.Code(err))
+		})
+
+		It("multi-action not supported", func() {
+			req.Action = types.Action{}
+			req.Actions = []types.Action{{ID: "view_host"}}
+			ctx := util.WithClientID(context.Background(), "bk_iam")
+			err := validateGRPCSearchRequests(ctx, req)
+			assert.Equal(GinkgoT(), codes.InvalidArgument, status.Code(err))
+			assert.Contains(GinkgoT(), err.Error(), "actions is only supported by search")
+		})
+
+		It("system not match client", func() {
+			other := *req
+			other.System = "bk_job"
+			ctx := util.WithClientID(context.Background(), "bk_job")
+			err := validateGRPCSearchRequests(ctx, req, &other)
+			assert.Equal(GinkgoT(), codes.InvalidArgument, status.Code(err))
+		})
+
+		It("no client", func() {
+			err := validateGRPCSearchRequests(context.Background(), req)
+			assert.Equal(GinkgoT(), codes.InvalidArgument, status.Code(err))
+		})
+	})
+
+	Describe("Stats", func() {
+		It("system not match client", func() {
+			ctx := util.WithClientID(context.Background(), "bk_job")
+			_, err := (&grpcServer{}).Stats(ctx, &pb.StatsRequest{System: "bk_cmdb", Action: "view_host"})
+			assert.Equal(GinkgoT(), codes.InvalidArgument, status.Code(err))
+		})
+
+		It("global stats not super client", func() {
+			ctx := util.WithClientID(context.Background(), "bk_cmdb")
+			_, err := (&grpcServer{}).Stats(ctx, &pb.StatsRequest{})
+			assert.Equal(GinkgoT(), codes.PermissionDenied, status.Code(err))
+
+			_, err = (&grpcServer{}).Stats(ctx, &pb.StatsRequest{System: "bk_cmdb"})
+			assert.Equal(GinkgoT(), codes.PermissionDenied, status.Code(err))
+		})
+	})
+
+	Describe("FullSync", func() {
+		It("not super client", func() {
+			ctx := util.WithClientID(context.Background(), "bk_cmdb")
+			_, err := (&grpcServer{}).FullSync(ctx, &pb.FullSyncRequest{})
+			assert.Equal(GinkgoT(), codes.PermissionDenied, status.Code(err))
+		})
+
+		It("super client, full sync not running", func() {
+			// NOTE: 全量同步任务未启动时信号无法发送, 返回冲突
+			ctx := util.WithClientID(context.Background(), "bk_iam")
+			_, err := (&grpcServer{}).FullSync(ctx, &pb.FullSyncRequest{})
+			assert.Equal(GinkgoT(), codes.Aborted, status.Code(err))
+		})
+	})
+})
@@ -12,6 +12,7 @@
 package search
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
@@ -33,13 +34,19 @@ import (
 // search godoc
 // @Summary search subjects by system/action/resource
 // @Description search the subjects who have the permission of that system/action/resource
+// @Description if timeout_ms is set, return {results, partial, phases}, partial=true if the eval phase timeout
+// @Description the header X-Search-Partial is true if the eval phase timeout, even if timeout_ms is not set
+// @Description if actions is set, return the subjects of each action [{action, subjects}], phases is a list of each action
+// @Description if the header Accept is application/x-ndjson, stream one subject per line, no limit if limit <= 0,
+// @Description the last line is {code, message} if fail after streaming started
 // @ID api-search
 // @Tags api
 // @Accept json
-// @Produce json
+// @Produce json,application/x-ndjson
 // @Param params body types.SearchRequest true "the list request"
 // @Success 200 {object} map[string]interface{}
 // @Header 200 {string} X-Request-Id "the request id"
+// @Header 200 {string} X-Search-Partial "true if the subjects are partial"
 // @Security AppCode
 // @Security AppSecret
 // @Router /api/v1/search [post]
@@ -61,14 +68,410 @@ func search(c *gin.Context) {
 	}
 
 	req.NowTimestamp = time.Now().Unix()
-	for i := range req.Resource {
-		rn := &req.Resource[i]
-		if rn.Attribute == nil {
-			rn.Attribute = make(map[string]interface{})
+	normalizeResource(req.Resource)
+
+	if req.IsMultiAction() {
+		multiActionSearch(c, &req)
+		return
+	}
+	if err := validateSingleAction(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, err.Error())
+		return
+	}
+
+	// NOTE: 结果较多时以ndjson流式返回, 避免在内存中构造完整的subjects列表
+	if util.AcceptNDJSON(c) {
+		streamSearch(c, &req)
+		return
+	}
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntry()
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	// NOTE: 按模板分组需要策略的template_id
+	withPolicies := req.WithPolicies
+	if req.GroupByTemplate {
+		req.WithPolicies = true
+	}
+
+	subjects, phases, err := indexer.Search(util.GetContextWithRequestID(c), &req, entry)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	var data interface{} = subjects
+	if req.GroupByTemplate {
+		data = types.GroupSubjectsByTemplate(subjects, withPolicies)
+	}
+
+	setPartialHeader(c, phases.Partial())
+	// NOTE: 兼容旧的调用方, 只有指定了timeout_ms时才返回partial/phases
+	if req.TimeoutMs > 0 {
+		data = gin.H{
+			"results": data,
+			"partial": phases.Partial(),
+			"phases":  phases,
+		}
+	}
+	util.SuccessJSONResponseWithDebug(c, "ok", data, entry)
+}
+
+// streamSearch write the subjects page by page in ndjson, one subject per line
+func streamSearch(c *gin.Context, req *types.SearchRequest) {
+	// NOTE: 流式返回只支持逐个subject写出, 不支持需要完整结果的参数
+	switch {
+	case req.ExpandGroups:
+		util.BadRequestErrorJSONResponse(c, "expand_groups is not supported by stream search")
+		return
+	case req.WithPolicies:
+		util.BadRequestErrorJSONResponse(c, "with_policies is not supported by stream search")
+		return
+	case req.GroupByTemplate:
+		util.BadRequestErrorJSONResponse(c, "group_by_template is not supported by stream search")
+		return
+	}
+	if _, isDebug := c.GetQuery("debug"); isDebug {
+		util.BadRequestErrorJSONResponse(c, "debug is not supported by stream search")
+		return
+	}
+
+	w := util.NewNDJSONWriter(c)
+	err := indexer.StreamSearch(util.GetContextWithRequestID(c), req, nil, func(subjects []types.Subject) error {
+		items := make([]interface{}, 0, len(subjects))
+		for _, subject := range subjects {
+			items = append(items, subject)
+		}
+		return w.Write(items...)
+	})
+	if err == nil {
+		w.Close()
+		return
+	}
+
+	if w.Started() {
+		w.WriteError(err)
+		return
+	}
+	util.SystemErrorJSONResponse(c, err)
+}
+
+// multiActionSearch search the subjects of each action, the doc engine of all actions is searched by one msearch
+func multiActionSearch(c *gin.Context, req *types.SearchRequest) {
+	// NOTE: 每个action返回subjects列表, 不支持按模板分组
+	if req.GroupByTemplate {
+		util.BadRequestErrorJSONResponse(c, "group_by_template is not supported by multi-action search")
+		return
+	}
+
+	requests := req.ActionRequests()
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntryWithFixedSubEntries(len(requests))
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	results, statuses := indexer.BatchSearch(util.GetContextWithRequestID(c), requests, entry)
+
+	if err := checkActionStatuses(requests, statuses); err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	actionSubjects := make([]types.ActionSubjects, 0, len(requests))
+	phases := make([]types.SearchPhases, 0, len(requests))
+	partial := false
+	for idx, status := range statuses {
+		actionSubjects = append(actionSubjects, types.ActionSubjects{
+			Action:   requests[idx].Action,
+			Subjects: results[idx],
+		})
+		phases = append(phases, status.Phases)
+		partial = partial || status.Partial
+	}
+
+	setPartialHeader(c, partial)
+	var data interface{} = actionSubjects
+	// NOTE: 兼容旧的调用方, 只有指定了timeout_ms时才返回partial/phases
+	if req.TimeoutMs > 0 {
+		data = gin.H{
+			"results": actionSubjects,
+			"partial": partial,
+			"phases":  phases,
+		}
+	}
+	util.SuccessJSONResponseWithDebug(c, "ok", data, entry)
+}
+
+// checkActionStatuses return the error of the first action fail
+// NOTE: 与单个action的检索一致, 只有eval超时时返回部分结果, 其它失败时返回错误
+func checkActionStatuses(requests []*types.SearchRequest, statuses []types.BatchSearchItemStatus) error {
+	for idx, status := range statuses {
+		if status.Status != types.BatchSearchStatusOK && !status.Partial {
+			return fmt.Errorf("search action `%s` fail: %s", requests[idx].Action.ID, status.Message)
+		}
+	}
+	return nil
+}
+
+// resourceActionsSearch godoc
+// @Summary search subjects of all the actions by system/resource
+// @Description search the subjects of all the actions applicable to the resource types,
+// @Description return {results: action => subjects, partial, phases: action => phases},
+// @Description partial=true if the eval phase of any action timeout, the subjects of the action are partial
+// @Description the actions are discovered from the policies of the system, any or having the resource types
+// @ID api-resource-actions-search
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.ResourceActionsSearchRequest true "the resource actions search request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Header 200 {string} X-Search-Partial "true if the subjects of any action are partial"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/resource-actions-search [post]
+func resourceActionsSearch(c *gin.Context) {
+	var req types.ResourceActionsSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+
+	// check system
+	systemID := req.System
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+	normalizeResource(req.Resource)
+
+	actions, err := indexer.ListActionsByResource(req.System, req.Resource)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+	requests := req.ActionRequests(actions)
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntryWithFixedSubEntries(len(requests))
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	results, statuses := indexer.BatchSearch(util.GetContextWithRequestID(c), requests, entry)
+	if err := checkActionStatuses(requests, statuses); err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	// NOTE: 策略已过期或不匹配资源实例的操作没有subjects, 不返回; eval超时的操作即使为空也需要返回
+	actionSubjects := make(map[string][]types.Subject, len(requests))
+	phases := make(map[string]types.SearchPhases, len(requests))
+	partial := false
+	for idx, req := range requests {
+		if len(results[idx]) > 0 || statuses[idx].Partial {
+			actionSubjects[req.Action.ID] = results[idx]
+		}
+		phases[req.Action.ID] = statuses[idx].Phases
+		partial = partial || statuses[idx].Partial
+	}
+
+	setPartialHeader(c, partial)
+	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{
+		"results": actionSubjects,
+		"partial": partial,
+		"phases":  phases,
+	}, entry)
+}
+
+// cursorSearch godoc
+// @Summary search subjects by system/action/resource page by page
+// @Description search the subjects who have the permission of that system/action/resource, use the next_cursor to fetch the next page, limit is the page size
+// @ID api-cursor-search
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.SearchRequest true "the list request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/cursor-search [post]
+func cursorSearch(c *gin.Context) {
+	var req types.SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+	if err := validateSingleAction(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, err.Error())
+		return
+	}
+
+	// check system
+	systemID := req.System
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	// NOTE: 展开后的用户无法按subject uid排序分页
+	if req.ExpandGroups {
+		util.BadRequestErrorJSONResponse(c, "expand_groups is not supported by cursor search")
+		return
+	}
+
+	cursor, err := types.DecodeSearchCursor(req.Cursor)
+	if err != nil {
+		util.BadRequestErrorJSONResponse(c, err.Error())
+		return
+	}
+	req.SearchCursor = cursor
+
+	req.NowTimestamp = time.Now().Unix()
+	normalizeResource(req.Resource)
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntry()
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	subjects, nextCursor, err := indexer.PageSearch(util.GetContextWithRequestID(c), &req, entry)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{
+		"results":     subjects,
+		"next_cursor": nextCursor,
+	}, entry)
+}
+
+// count godoc
+// @Summary count subjects by system/action/resource
+// @Description count the distinct subjects who have the permission of that system/action/resource, the limit will be ignored
+// @ID api-count
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.SearchRequest true "the count request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/count [post]
+func count(c *gin.Context) {
+	var req types.SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+	if err := validateSingleAction(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, err.Error())
+		return
+	}
+
+	// check system
+	systemID := req.System
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	if req.ExpandGroups {
+		util.BadRequestErrorJSONResponse(c, "expand_groups is not supported by count")
+		return
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+	normalizeResource(req.Resource)
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntry()
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	cnt, err := indexer.Count(util.GetContextWithRequestID(c), &req, entry)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{"count": cnt}, entry)
+}
+
+// expiringSearch godoc
+// @Summary search subjects whose permission will expire soon by system/action/resource
+// @Description search the subjects whose latest expired_at of the policies granting the permission is within the days, sorted by expired_at
+// @ID api-expiring-search
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.ExpiringSearchRequest true "the expiring search request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/expiring-search [post]
+func expiringSearch(c *gin.Context) {
+	var req types.ExpiringSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+	if err := validateSingleAction(&req.SearchRequest); err != nil {
+		util.BadRequestErrorJSONResponse(c, err.Error())
+		return
+	}
+
+	// check system
+	systemID := req.System
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
 		}
-		rn.Attribute["id"] = rn.ID
 	}
 
+	// NOTE: 用户组成员的过期时间不在索引中, 无法计算展开后用户的过期时间
+	if req.ExpandGroups {
+		util.BadRequestErrorJSONResponse(c, "expand_groups is not supported by expiring search")
+		return
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+	normalizeResource(req.Resource)
+
 	// enable debug
 	var entry *debug.Entry
 	_, isDebug := c.GetQuery("debug")
@@ -77,7 +480,7 @@ func search(c *gin.Context) {
 		defer debug.ReleaseDebugEntry(entry)
 	}
 
-	subjects, err := indexer.Search(util.GetContextWithRequestID(c), &req, entry)
+	subjects, err := indexer.ExpiringSearch(util.GetContextWithRequestID(c), &req, entry)
 	if err != nil {
 		util.SystemErrorJSONResponse(c, err)
 		return
@@ -89,6 +492,8 @@ func search(c *gin.Context) {
 // batchSearch godoc
 // @Summary batch search subjects by system/action/resource
 // @Description batch search the subjects who have the permission of that system/action/resource
+// @Description the status of each request is returned in `statuses`, ok/timeout/error(empty subjects)
+// @Description partial=true if the eval phase timeout after the doc phase done, the subjects are partial
 // @ID api-batch-search
 // @Tags api
 // @Accept json
@@ -105,6 +510,12 @@ func batchSearch(c *gin.Context) {
 		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
 		return
 	}
+	for _, req := range body {
+		if err := validateSingleAction(req); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
 
 	// check system
 	clientID := util.GetClientID(c)
@@ -124,13 +535,75 @@ func batchSearch(c *gin.Context) {
 
 	now := time.Now().Unix()
 	for _, req := range body {
-		for i := range req.Resource {
-			rn := &req.Resource[i]
-			if rn.Attribute == nil {
-				rn.Attribute = make(map[string]interface{})
+		normalizeResource(req.Resource)
+		req.NowTimestamp = now
+	}
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntryWithFixedSubEntries(len(body))
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	// NOTE: 单个请求失败/超时不影响整体, 每个请求的状态在statuses中返回
+	ctx := util.GetContextWithRequestID(c)
+	results, statuses := indexer.BatchSearch(ctx, body, entry)
+
+	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{"results": results, "statuses": statuses}, entry)
+}
+
+// batchCount godoc
+// @Summary batch count subjects by system/action/resource
+// @Description batch count the distinct subjects who have the permission of that system/action/resource, the limit will be ignored
+// @ID api-batch-count
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body []types.SearchRequest true "the count request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/batch-count [post]
+func batchCount(c *gin.Context) {
+	var body []*types.SearchRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+	for _, req := range body {
+		if err := validateSingleAction(req); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	// check system
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		systemIDs := set.NewStringSet()
+		for _, req := range body {
+			systemIDs.Add(req.System)
+		}
+
+		for _, systemID := range systemIDs.ToSlice() {
+			if err := validateSystemMatchClient(systemID, clientID); err != nil {
+				util.BadRequestErrorJSONResponse(c, err.Error())
+				return
 			}
-			rn.Attribute["id"] = rn.ID
 		}
+	}
+
+	now := time.Now().Unix()
+	for _, req := range body {
+		if req.ExpandGroups {
+			util.BadRequestErrorJSONResponse(c, "expand_groups is not supported by count")
+			return
+		}
+
+		normalizeResource(req.Resource)
 		req.NowTimestamp = now
 	}
 
@@ -143,7 +616,7 @@ func batchSearch(c *gin.Context) {
 	}
 
 	ctx := util.GetContextWithRequestID(c)
-	results, err := indexer.BatchSearch(ctx, body, entry)
+	results, err := indexer.BatchCount(ctx, body, entry)
 	if err != nil {
 		util.SystemErrorJSONResponse(c, err)
 		return
@@ -152,6 +625,100 @@ func batchSearch(c *gin.Context) {
 	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{"results": results}, entry)
 }
 
+// reverseSearch godoc
+// @Summary search resources by system/action/subject
+// @Description list the resources which the subject has the permission of that system/action
+// @ID api-reverse-search
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.ReverseSearchRequest true "the reverse search request"
+// @Success 200 {object} types.ReverseSearchResult
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/reverse-search [post]
+func reverseSearch(c *gin.Context) {
+	var req types.ReverseSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+
+	// check system
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(req.System, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+
+	// enable debug
+	var entry *debug.Entry
+	_, isDebug := c.GetQuery("debug")
+	if isDebug {
+		entry = debug.NewDebugEntry()
+		defer debug.ReleaseDebugEntry(entry)
+	}
+
+	result, err := indexer.ReverseSearch(util.GetContextWithRequestID(c), &req, entry)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	util.SuccessJSONResponseWithDebug(c, "ok", result, entry)
+}
+
+// explain godoc
+// @Summary explain why the subject has the permission of system/action/resource
+// @Description return all the policies granting the permission to the subject, with the evaluation trace of eval policies
+// @ID api-explain
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param params body types.ExplainRequest true "the explain request"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} X-Request-Id "the request id"
+// @Security AppCode
+// @Security AppSecret
+// @Router /api/v1/explain [post]
+func explain(c *gin.Context) {
+	var req types.ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequestErrorJSONResponse(c, util.ValidationErrorMessage(err))
+		return
+	}
+
+	// check system
+	systemID := req.System
+	clientID := util.GetClientID(c)
+	if !isSuperClient(clientID) {
+		if err := validateSystemMatchClient(systemID, clientID); err != nil {
+			util.BadRequestErrorJSONResponse(c, err.Error())
+			return
+		}
+	}
+
+	req.NowTimestamp = time.Now().Unix()
+	normalizeResource(req.Resource)
+
+	// NOTE: explain always enable debug
+	entry := debug.NewDebugEntry()
+	defer debug.ReleaseDebugEntry(entry)
+
+	policies, err := indexer.Explain(util.GetContextWithRequestID(c), &req, entry)
+	if err != nil {
+		util.SystemErrorJSONResponse(c, err)
+		return
+	}
+
+	util.SuccessJSONResponseWithDebug(c, "ok", gin.H{"policies": policies}, entry)
+}
+
 // batchSearch godoc
 // @Summary get iam search engine stats
 // @Description get iam search engine stats
@@ -188,19 +755,25 @@ func stats(c *gin.Context) {
 			return
 		}
 
-		stats = indexer.TotalStats()
-
-		// 查询最近的同步时间
-		fullSyncLastTime, _ := storage.SyncSnapshotStorage.GetFullSyncLastSyncTime()
-		incrSyncLastTime, _ := storage.SyncSnapshotStorage.GetIncrSyncLastSyncTime()
-
-		stats["full_sync_last_time"] = uint64(fullSyncLastTime)
-		stats["incr_sync_last_time"] = uint64(incrSyncLastTime)
+		stats = totalStats()
 	}
 
 	util.SuccessJSONResponse(c, "ok", stats)
 }
 
+// totalStats return the global stats with the last sync time
+func totalStats() map[string]uint64 {
+	stats := indexer.TotalStats()
+
+	// 查询最近的同步时间
+	fullSyncLastTime, _ := storage.SyncSnapshotStorage.GetFullSyncLastSyncTime()
+	incrSyncLastTime, _ := storage.SyncSnapshotStorage.GetIncrSyncLastSyncTime()
+
+	stats["full_sync_last_time"] = uint64(fullSyncLastTime)
+	stats["incr_sync_last_time"] = uint64(incrSyncLastTime)
+	return stats
+}
+
 // batchSearch godoc
 // @Summary trigger iam search engine full sync task
 // @Description trigger iam search engine full sync task
@@ -221,13 +794,20 @@ func fullSync(c *gin.Context) {
 		return
 	}
 
-	// 触发全量同步
-	select {
-	case task.FullSyncSignal <- struct{}{}:
-	default:
+	if !triggerFullSync() {
 		util.ConflictJSONResponse(c, "")
 		return
 	}
 
 	util.SuccessJSONResponse(c, "ok", nil)
 }
+
+// triggerFullSync 触发全量同步, 已有全量同步在执行时返回false
+func triggerFullSync() bool {
+	select {
+	case task.FullSyncSignal <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
@@ -19,8 +19,22 @@ import (
 func Register(r *gin.RouterGroup) {
 	r.POST("/search", search)
 
+	r.POST("/cursor-search", cursorSearch)
+
 	r.POST("/batch-search", batchSearch)
 
+	r.POST("/reverse-search", reverseSearch)
+
+	r.POST("/count", count)
+
+	r.POST("/batch-count", batchCount)
+
+	r.POST("/expiring-search", expiringSearch)
+
+	r.POST("/resource-actions-search", resourceActionsSearch)
+
+	r.POST("/explain", explain)
+
 	r.GET("/stats", stats)
 
 	r.POST("/full-sync", fullSync)
@@ -14,8 +14,12 @@ package search
 import (
 	"fmt"
 
+	"github.com/gin-gonic/gin"
+
 	"engine/pkg/cache/impls"
 	"engine/pkg/config"
+	"engine/pkg/types"
+	"engine/pkg/util"
 )
 
 func validateSystemMatchClient(systemID, clientID string) error {
@@ -40,3 +44,33 @@ func validateSystemMatchClient(systemID, clientID string) error {
 func isSuperClient(clientID string) bool {
 	return config.SuperAppCodeSet.Has(clientID)
 }
+
+// validateSingleAction the actions is only supported by /search, other apis require the action
+func validateSingleAction(req *types.SearchRequest) error {
+	if req.IsMultiAction() {
+		return fmt.Errorf("actions is only supported by search, use action instead")
+	}
+	if req.Action.ID == "" {
+		return fmt.Errorf("action is required")
+	}
+	return nil
+}
+
+// normalizeResource fill the id of each resource node into its attribute, the attribute `id` is matched by the policies
+func normalizeResource(resource types.Resource) {
+	for i := range resource {
+		rn := &resource[i]
+		if rn.Attribute == nil {
+			rn.Attribute = make(map[string]interface{})
+		}
+		rn.Attribute["id"] = rn.ID
+	}
+}
+
+// setPartialHeader set the header X-Search-Partial if the subjects are partial
+// NOTE: 未指定timeout_ms时eval也会在默认超时后返回部分结果, 响应体保持兼容, 通过header告知调用方
+func setPartialHeader(c *gin.Context, partial bool) {
+	if partial {
+		c.Header(util.SearchPartialHeaderKey, "true")
+	}
+}
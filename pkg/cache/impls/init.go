@@ -22,6 +22,7 @@ var (
 	LocalAPIGatewayJWTClientIDCache memory.Cache
 	LocalSystemClientsCache         memory.Cache
 	LocalAppCodeAppSecretCache      memory.Cache
+	LocalResourceTypeSystemsCache   memory.Cache
 )
 
 // Cache should only know about get/retrieve data
@@ -47,4 +48,11 @@ func InitCaches(disabled bool) {
 		retrieveSystemClients,
 		10*time.Minute,
 	)
+
+	LocalResourceTypeSystemsCache = memory.NewCache(
+		"local_resource_type_systems",
+		disabled,
+		retrieveResourceTypeSystems,
+		10*time.Minute,
+	)
 }
@@ -0,0 +1,62 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package impls
+
+import (
+	"fmt"
+
+	"engine/pkg/cache"
+	"engine/pkg/components"
+)
+
+// retrieveResourceTypeSystems return the resource type => system of the related resource types of all the actions
+func retrieveResourceTypeSystems(k cache.Key) (interface{}, error) {
+	k1 := k.(cache.StringKey)
+
+	systemID := k1.Key()
+
+	actions, err := components.NewIAMClient().ListSystemAction(systemID)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceTypeSystems := make(map[string]string, len(actions))
+	for _, action := range actions {
+		for _, rt := range action.RelatedResourceTypes {
+			resourceTypeSystems[rt.ID] = rt.SystemID
+		}
+	}
+	return resourceTypeSystems, nil
+}
+
+// GetResourceTypeSystems return the resource type => system of the system's actions
+func GetResourceTypeSystems(systemID string) (resourceTypeSystems map[string]string, err error) {
+	key := cache.NewStringKey(systemID)
+
+	var value interface{}
+	value, err = LocalResourceTypeSystemsCache.Get(key)
+	if err != nil {
+		err = fmt.Errorf("GetResourceTypeSystems: LocalResourceTypeSystemsCache.Get key=`%s` fail", key.Key())
+		return
+	}
+
+	var ok bool
+	resourceTypeSystems, ok = value.(map[string]string)
+	if !ok {
+		err = fmt.Errorf(
+			"GetResourceTypeSystems: LocalResourceTypeSystemsCache.Get key=`%s` fail, not map[string]string in cache",
+			systemID)
+		return
+	}
+
+	return resourceTypeSystems, nil
+}
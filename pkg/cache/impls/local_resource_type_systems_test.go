@@ -0,0 +1,51 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package impls
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetResourceTypeSystems(t *testing.T) {
+	expiration := 5 * time.Minute
+
+	// valid
+	retrieveFunc := func(key cache.Key) (interface{}, error) {
+		return map[string]string{"host": "bk_cmdb", "script": "bk_job"}, nil
+	}
+	mockCache := memory.NewCache(
+		"mockCache", false, retrieveFunc, expiration)
+	LocalResourceTypeSystemsCache = mockCache
+
+	systems, err := GetResourceTypeSystems("bk_job")
+	assert.NoError(t, err)
+	assert.Equal(t, "bk_cmdb", systems["host"])
+	assert.Equal(t, "bk_job", systems["script"])
+
+	// error
+	retrieveFunc = func(key cache.Key) (interface{}, error) {
+		return nil, errors.New("error here")
+	}
+	mockCache = memory.NewCache(
+		"mockCache", false, retrieveFunc, expiration)
+	LocalResourceTypeSystemsCache = mockCache
+
+	_, err = GetResourceTypeSystems("bk_job")
+	assert.Error(t, err)
+}
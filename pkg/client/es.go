@@ -133,12 +133,12 @@ func (c *EsClient) Index(indexName string, docID string, doc map[string]interfac
 	return nil
 }
 
-// DeleteByQuery ...
-func (c *EsClient) DeleteByQuery(indexName string, query types.H) error {
+// DeleteByQuery will delete the docs matched, return the count of docs deleted
+func (c *EsClient) DeleteByQuery(indexName string, query types.H) (int, error) {
 	// speed up the marshal
 	data, err := jsoniter.Marshal(query)
 	if err != nil {
-		return fmt.Errorf("marshal doc fail: %w", err)
+		return 0, fmt.Errorf("marshal doc fail: %w", err)
 	}
 
 	refresh := true
@@ -152,14 +152,22 @@ func (c *EsClient) DeleteByQuery(indexName string, query types.H) error {
 	// Perform the request with the client.
 	res, err := req.Do(context.Background(), c.client)
 	if err != nil {
-		return fmt.Errorf("error getting response: %s", err)
+		return 0, fmt.Errorf("error getting response: %s", err)
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		return fmt.Errorf("[%s] Error delete by query", res.Status())
+		return 0, fmt.Errorf("[%s] Error delete by query", res.Status())
 	}
-	return nil
+
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	err = jsoniter.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing the response body: %w", err)
+	}
+	return result.Deleted, nil
 }
 
 // BulkIndex ...
@@ -322,17 +330,22 @@ func (c *EsClient) search(
 		return
 	}
 
-	start := time.Now()
-	res, err = c.client.Search(
+	options := []func(*esapi.SearchRequest){
 		c.client.Search.WithContext(context.Background()),
-		c.client.Search.WithIndex(indexName),
 		c.client.Search.WithBody(&buf),
 		c.client.Search.WithTrackTotalHits(true),
 		c.client.Search.WithPretty(),
 		c.client.Search.WithFrom(from),
 		c.client.Search.WithSize(pageSize),
 		c.client.Search.WithSource(fields...),
-	)
+	}
+	// NOTE: 使用point in time查询时不能指定索引
+	if indexName != "" {
+		options = append(options, c.client.Search.WithIndex(indexName))
+	}
+
+	start := time.Now()
+	res, err = c.client.Search(options...)
 
 	duration := time.Since(start)
 	metric.EsSearchDuration.Observe(float64(duration / time.Millisecond))
@@ -447,6 +460,52 @@ func (c *EsClient) Msearch(
 	return decodeSearchResponse(res)
 }
 
+// OpenPointInTime open a point in time of the index, return the id
+func (c *EsClient) OpenPointInTime(ctx context.Context, indexName string, keepAlive string) (string, error) {
+	res, err := c.client.OpenPointInTime(
+		[]string{indexName},
+		c.client.OpenPointInTime.WithContext(ctx),
+		c.client.OpenPointInTime.WithKeepAlive(keepAlive),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error getting response: %w", err)
+	}
+	defer res.Body.Close()
+
+	r, err := decodeSearchResponse(res)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := r["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid open point in time response, no id")
+	}
+	return id, nil
+}
+
+// ClosePointInTime ...
+func (c *EsClient) ClosePointInTime(ctx context.Context, pitID string) error {
+	data, err := jsoniter.Marshal(types.H{"id": pitID})
+	if err != nil {
+		return fmt.Errorf("marshal point in time id fail: %w", err)
+	}
+
+	res, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithContext(ctx),
+		c.client.ClosePointInTime.WithBody(bytes.NewReader(data)),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting response: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("[%s] Error closing point in time", res.Status())
+	}
+	return nil
+}
+
 func decodeSearchResponse(res *esapi.Response) (r types.H, err error) {
 	if res.IsError() {
 		var e types.H
@@ -484,6 +543,14 @@ func (c *EsClient) CreateIndex(index string, mapping string) (*esapi.Response, e
 	})
 }
 
+// PutMapping ...
+func (c *EsClient) PutMapping(index string, mapping string) (*esapi.Response, error) {
+	return c.client.Indices.PutMapping(
+		strings.NewReader(mapping),
+		c.client.Indices.PutMapping.WithIndex(index),
+	)
+}
+
 // IndexExists ...
 func (c *EsClient) IndexExists(index string) (*esapi.Response, error) {
 	return c.client.Indices.Exists([]string{index})
@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/conv"
@@ -77,7 +78,10 @@ type IAMBackendClient interface {
 	ListPolicyBetweenID(timestamp, minID, maxID int64) ([]types.Policy, error)
 	ListPolicyByIDs(ids []int64) ([]types.Policy, error)
 
+	ListGroupMember(groupIDs []string) ([]types.GroupMember, error)
+
 	GetSystem(systemID string) (System, error)
+	ListSystemAction(systemID string) ([]Action, error)
 
 	CredentialsVerify(appCode, appSecret string) (exists bool, err error)
 }
@@ -100,6 +104,16 @@ type ListPolicyIDResponse struct {
 	IDs []int64
 }
 
+// ListGroupMemberResponse ...
+type ListGroupMemberResponse struct {
+	Results []types.GroupMember
+}
+
+// ListActionResponse ...
+type ListActionResponse struct {
+	Results []Action
+}
+
 // GetMaxIDResponse ...
 type GetMaxIDResponse struct {
 	ID int64
@@ -309,6 +323,26 @@ func (c *iamBackendClient) ListPolicyByIDs(ids []int64) ([]types.Policy, error)
 	return responsePolicies.Results, nil
 }
 
+// ListGroupMember 查询指定用户组的成员, 包含成员关系的过期时间
+func (c *iamBackendClient) ListGroupMember(groupIDs []string) ([]types.GroupMember, error) {
+	path := "/api/v1/engine/groups/members"
+	query := map[string]interface{}{
+		"group_ids": strings.Join(groupIDs, ","),
+	}
+	data, err := c.callWithReturnMapData(GET, path, query, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	responseMembers := ListGroupMemberResponse{}
+	err = mapstructure.Decode(data, &responseMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	return responseMembers.Results, nil
+}
+
 // GetSystem ...
 func (c *iamBackendClient) GetSystem(systemID string) (system System, err error) {
 	path := fmt.Sprintf("/api/v1/engine/systems/%s", systemID)
@@ -326,6 +360,24 @@ func (c *iamBackendClient) GetSystem(systemID string) (system System, err error)
 	return
 }
 
+// ListSystemAction 查询系统的操作及其关联的资源类型, 资源类型可能来自其他系统
+func (c *iamBackendClient) ListSystemAction(systemID string) ([]Action, error) {
+	path := fmt.Sprintf("/api/v1/engine/systems/%s/actions", systemID)
+	query := map[string]interface{}{}
+	data, err := c.callWithReturnMapData(GET, path, query, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	responseActions := ListActionResponse{}
+	err = mapstructure.Decode(data, &responseActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return responseActions.Results, nil
+}
+
 // CredentialsVerify ...
 func (c *iamBackendClient) CredentialsVerify(appCode, appSecret string) (exists bool, err error) {
 	path := "/api/v1/engine/credentials/verify"
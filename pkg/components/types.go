@@ -21,3 +21,15 @@ type System struct {
 	Clients        string                 `json:"clients" structs:"clients"`
 	ProviderConfig map[string]interface{} `json:"provider_config" structs:"provider_config"`
 }
+
+// Action the action of the system with the related resource types
+type Action struct {
+	ID                   string                `json:"id" mapstructure:"id"`
+	RelatedResourceTypes []RelatedResourceType `json:"related_resource_types" mapstructure:"related_resource_types"`
+}
+
+// RelatedResourceType the resource type may be from another system
+type RelatedResourceType struct {
+	SystemID string `json:"system_id" mapstructure:"system_id"`
+	ID       string `json:"id" mapstructure:"id"`
+}
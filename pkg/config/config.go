@@ -19,6 +19,8 @@ import (
 type Server struct {
 	Host string
 	Port int
+	// the port of the grpc api, 0 for disabled
+	GRPCPort int
 
 	GraceTimeout int64
 
@@ -43,9 +45,50 @@ type ElasticSearch struct {
 	IndexName string
 }
 
+// IndexEngineES ...
+const (
+	IndexEngineES     = "es"
+	IndexEngineMemory = "memory"
+)
+
 // Index ...
 type Index struct {
+	// the engine of any/doc policies, es or memory, default es
+	Engine string
+
 	ElasticSearch ElasticSearch
+
+	SearchCache SearchCache
+
+	SearchTimeout SearchTimeout
+}
+
+// SearchTimeout the timeout milliseconds of search, the request can set timeout_ms bounded by the max
+type SearchTimeout struct {
+	// the default timeout of /search, /count, /cursor-search, /reverse-search and /explain, default 100
+	Search int
+	// the default timeout of /batch-search, /batch-count, /expiring-search and each page of the stream search,
+	// default 500
+	BatchSearch int
+	// the max timeout_ms of the request, default 5000
+	Max int
+}
+
+// SearchCache the cache of search results, invalidated by system+action when the policies changed
+type SearchCache struct {
+	Enabled bool
+	// the expiration seconds of local cache, default 10
+	Expiration int
+
+	// share the cache between the replicas by redis
+	RedisEnabled bool
+	// the expiration seconds of redis cache, default 60
+	RedisExpiration int
+}
+
+// UseMemoryEngine ...
+func (i *Index) UseMemoryEngine() bool {
+	return i.Engine == IndexEngineMemory
 }
 
 // Logger ...
@@ -13,7 +13,9 @@ package doc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
@@ -25,6 +27,24 @@ import (
 	"engine/pkg/types"
 )
 
+// reverseSearchSize the page size of the reverse search and explain, all the pages will be searched
+// NOTE: 单个subject在同一个操作下的策略数量一般不会太多, 超出时按id翻页
+const reverseSearchSize = 1000
+
+// expiredAtSearchSize the max subjects of the expired_at aggregation, sorted by the latest expired_at
+// NOTE: 只关心最早过期的subject, 超出的部分不返回
+const expiredAtSearchSize = 10000
+
+// pointInTimeKeepAlive the keep alive of the point in time, extended by each page search
+const pointInTimeKeepAlive = "1m"
+
+// countExcludedTermsSize the max subjects of one terms query excluded by the count query,
+// less than the default es index.max_terms_count 65536
+const countExcludedTermsSize = 10000
+
+// countPrecisionThreshold the max precision_threshold of es cardinality aggregation
+const countPrecisionThreshold = 40000
+
 // EsEngine ...
 type EsEngine struct {
 	client        *client.EsClient
@@ -33,7 +53,7 @@ type EsEngine struct {
 }
 
 // NewEsEngine ...
-func NewEsEngine(cfg *config.Index) (types.Engine, error) {
+func NewEsEngine(cfg *config.Index) (types.DocEngine, error) {
 	esClient, err := client.NewEsClient(&cfg.ElasticSearch)
 	if err != nil {
 		return nil, fmt.Errorf("new es client error:%w", err)
@@ -81,10 +101,254 @@ func (e *EsEngine) Search(
 	if err != nil {
 		return &EsSearchResult{}, fmt.Errorf("index search fail %w", err)
 	}
-	esQuerySubjects := getSearchResultByResponses(r["responses"].([]interface{}), entry)
+	responses, err := getMsearchResponses(r, len(queries))
+	if err != nil {
+		return &EsSearchResult{}, err
+	}
+
+	esQuerySubjects := getSearchResultByResponses(responses, entry)
 	return esQuerySubjects, nil
 }
 
+// getMsearchResponses return the responses of the msearch, error if the count mismatch or any query fail
+// NOTE: msearch中单个查询失败时只在该查询的response中返回error, 需要检查避免解析时panic
+func getMsearchResponses(r types.H, count int) ([]interface{}, error) {
+	responses, ok := r["responses"].([]interface{})
+	if !ok || len(responses) != count {
+		return nil, fmt.Errorf("index search fail, invalid responses, expected count %d", count)
+	}
+
+	for i, response := range responses {
+		if reason, ok := response.(map[string]interface{})["error"]; ok {
+			return nil, fmt.Errorf("index search fail, the query %d error: %v", i, reason)
+		}
+	}
+	return responses, nil
+}
+
+// ReverseSearch ...
+func (e *EsEngine) ReverseSearch(
+	ctx context.Context,
+	req *types.ReverseSearchRequest,
+	entry *debug.Entry,
+) (*types.ReverseSearchResult, error) {
+	query := genReverseQuery(req)
+	debug.WithValue(entry, "reverse_query", query)
+
+	docs, err := e.searchAllSources(ctx, query, []string{"type", "resource", andFieldsKey})
+	if err != nil {
+		return nil, fmt.Errorf("index reverse search fail %w", err)
+	}
+
+	result := types.NewReverseSearchResult()
+	parseReverseSearchDocs(docs, result)
+
+	return result, nil
+}
+
+// searchAllSources return the _source of all the docs matched, search page by page sorted by id
+func (e *EsEngine) searchAllSources(ctx context.Context, query types.H, fields []string) ([]types.H, error) {
+	query["sort"] = []interface{}{types.H{"id": "asc"}}
+
+	sources := make([]types.H, 0, 10)
+	for {
+		r, err := e.client.Search(ctx, e.indexName, query, 0, reverseSearchSize, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		hits, err := parseSearchHits(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range hits {
+			sources = append(sources, hit.Source)
+		}
+
+		if len(hits) < reverseSearchSize {
+			return sources, nil
+		}
+		// NOTE: es client不感知ctx, 翻页前检查是否已超时
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("search the next page fail: %w", ctx.Err())
+		}
+		query["search_after"] = hits[len(hits)-1].Sort
+	}
+}
+
+// PageSearch ...
+func (e *EsEngine) PageSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	size int,
+	entry *debug.Entry,
+) (*types.SearchPage, error) {
+	query := genPageQuery(req)
+	debug.WithValue(entry, "page_query", query)
+
+	// NOTE: point in time已经指定了索引
+	indexName := e.indexName
+	if req.SearchCursor != nil && req.SearchCursor.PitID != "" {
+		indexName = ""
+	}
+
+	r, err := e.client.Search(ctx, indexName, query, 0, size, []string{"subject"})
+	if err != nil {
+		return nil, fmt.Errorf("index page search fail %w", err)
+	}
+
+	hits, err := parseSearchHits(r)
+	if err != nil {
+		return nil, fmt.Errorf("index page search fail %w", err)
+	}
+	page := &types.SearchPage{
+		Subjects: make([]types.Subject, 0, len(hits)),
+		// NOTE: 一个subject可能有多条文档, 返回的hits满了则认为还有下一页
+		HasMore: len(hits) == size,
+	}
+	page.PitID, _ = r["pit_id"].(string)
+	for _, hit := range hits {
+		subject, ok := hit.Source["subject"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("index page search fail, invalid doc without subject")
+		}
+
+		s := types.Subject{}
+		s.Type, _ = subject["type"].(string)
+		s.ID, _ = subject["id"].(string)
+		s.Name, _ = subject["name"].(string)
+		s.UID, _ = subject["uid"].(string)
+		// hits sorted by subject uid, so only need to compare with the last one
+		if s.UID == page.LastSubjectUID() {
+			continue
+		}
+
+		page.Subjects = append(page.Subjects, s)
+	}
+	return page, nil
+}
+
+// OpenPointInTime open the point in time of the index, the pages searched with it are consistent
+func (e *EsEngine) OpenPointInTime(ctx context.Context) (string, error) {
+	pitID, err := e.client.OpenPointInTime(ctx, e.indexName, pointInTimeKeepAlive)
+	if err != nil {
+		return "", fmt.Errorf("index open point in time fail %w", err)
+	}
+	return pitID, nil
+}
+
+// ClosePointInTime ...
+func (e *EsEngine) ClosePointInTime(ctx context.Context, pitID string) error {
+	if err := e.client.ClosePointInTime(ctx, pitID); err != nil {
+		return fmt.Errorf("index close point in time fail %w", err)
+	}
+	return nil
+}
+
+// SearchExpiredAt return the subjects with the latest expired_at, at most expiredAtSearchSize subjects expire first
+func (e *EsEngine) SearchExpiredAt(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	query := genExpiredAtQuery(req)
+	debug.WithValue(entry, "expired_at_query", query)
+
+	r, err := e.client.Search(ctx, e.indexName, query, 0, 0, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("index search expired_at fail %w", err)
+	}
+
+	return parseSubjectExpiriesAggs(r), nil
+}
+
+// Count will return the count of distinct subjects, exclude the subjects in excludedSubjectUIDs
+func (e *EsEngine) Count(
+	ctx context.Context,
+	req *types.SearchRequest,
+	excludedSubjectUIDs []string,
+	entry *debug.Entry,
+) (uint64, error) {
+	query := genCountQuery(req, excludedSubjectUIDs)
+	debug.WithValue(entry, "count_query", query)
+
+	r, err := e.client.Search(ctx, e.indexName, query, 0, 0, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("index count fail %w", err)
+	}
+
+	count, err := parseCountAggs(r)
+	if err != nil {
+		return 0, fmt.Errorf("index count fail %w", err)
+	}
+	return count, nil
+}
+
+// SearchPolicies return all the any/doc policies matched of each subject, not limited by the limit of the request
+func (e *EsEngine) SearchPolicies(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) (map[string][]types.MatchedPolicy, error) {
+	query := types.H{"query": genAnyOrDocQuery(req)}
+	debug.WithValue(entry, "policies_query", query)
+
+	sources, err := e.searchAllSources(ctx, query, []string{"subject", "id", "template_id", "expired_at", "type"})
+	if err != nil {
+		return nil, fmt.Errorf("index search policies fail %w", err)
+	}
+
+	policies := make(map[string][]types.MatchedPolicy, len(sources))
+	for _, source := range sources {
+		subject, _ := source["subject"].(map[string]interface{})
+		subjectUID, _ := subject["uid"].(string)
+		id, _ := source["id"].(float64)
+		templateID, _ := source["template_id"].(float64)
+		expiredAt, _ := source["expired_at"].(float64)
+		docType, _ := source["type"].(string)
+		policies[subjectUID] = append(policies[subjectUID], types.MatchedPolicy{
+			ID:         int64(id),
+			TemplateID: int64(templateID),
+			ExpiredAt:  int64(expiredAt),
+			Type:       types.ExpressionType(docType),
+		})
+	}
+	return policies, nil
+}
+
+// Explain ...
+func (e *EsEngine) Explain(
+	ctx context.Context,
+	req *types.ExplainRequest,
+	entry *debug.Entry,
+) ([]types.ExplainPolicy, error) {
+	query := genExplainQuery(req)
+	debug.WithValue(entry, "explain_query", query)
+
+	sources, err := e.searchAllSources(ctx, query, []string{"id", "template_id", "expired_at", "type"})
+	if err != nil {
+		return nil, fmt.Errorf("index explain fail %w", err)
+	}
+
+	policies := make([]types.ExplainPolicy, 0, len(sources))
+	for _, source := range sources {
+		id, _ := source["id"].(float64)
+		templateID, _ := source["template_id"].(float64)
+		expiredAt, _ := source["expired_at"].(float64)
+		docType, _ := source["type"].(string)
+		policy := types.ExplainPolicy{
+			ID:         int64(id),
+			TemplateID: int64(templateID),
+			ExpiredAt:  int64(expiredAt),
+			Type:       types.ExpressionType(docType),
+		}
+
+		policies = append(policies, policy)
+		debug.AddPolicy(entry, policy)
+	}
+	return policies, nil
+}
+
 func (e *EsEngine) makeDocs(policies []*types.Policy) (docs []types.H, err error) {
 	docs = make([]types.H, 0, len(policies))
 	for _, p := range policies {
@@ -116,9 +380,12 @@ func (e *EsEngine) BatchSearch(
 		return nil, fmt.Errorf("index search fail %w", err)
 	}
 
-	searchResults := make([]types.SearchResult, 0, len(requests))
+	responses, err := getMsearchResponses(r, len(queries))
+	if err != nil {
+		return nil, err
+	}
 
-	responses := r["responses"].([]interface{})
+	searchResults := make([]types.SearchResult, 0, len(requests))
 	for i := 0; i < len(requests); i++ {
 		subEntry := debug.GetSubEntryByIndex(entry, i)
 		esQuerySubjects := getSearchResultByResponses(responses[i*2:i*2+2], subEntry)
@@ -144,8 +411,8 @@ func (e *EsEngine) BulkDelete(ids []int64, logger *log.Entry) error {
 	return nil
 }
 
-func (e *EsEngine) deleteByQuery(query types.H, logger *log.Entry) (err error) {
-	err = e.client.DeleteByQuery(e.indexName, query)
+func (e *EsEngine) deleteByQuery(query types.H, logger *log.Entry) (count int, err error) {
+	count, err = e.client.DeleteByQuery(e.indexName, query)
 	if err != nil {
 		logger.WithError(err).WithFields(log.Fields{
 			"index":      e.indexName,
@@ -159,7 +426,56 @@ func (e *EsEngine) deleteByQuery(query types.H, logger *log.Entry) (err error) {
 // BulkDeleteBySubjects ...
 func (e *EsEngine) BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Subject, logger *log.Entry) error {
 	query := genSubjectsQuery(beforeUpdatedAt, subjects)
-	return e.deleteByQuery(query, logger)
+	_, err := e.deleteByQuery(query, logger)
+	return err
+}
+
+// PurgeExpired will delete the docs expired before the timestamp by delete-by-query
+func (e *EsEngine) PurgeExpired(beforeExpiredAt int64, logger *log.Entry) (uint64, error) {
+	count, err := e.deleteByQuery(genExpiredQuery(beforeExpiredAt), logger)
+	if err != nil {
+		return 0, fmt.Errorf("delete the expired docs fail: %w", err)
+	}
+	return uint64(count), nil
+}
+
+// ListActionsByIDs ...
+func (e *EsEngine) ListActionsByIDs(ids []int64) ([]types.SystemAction, error) {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.FormatInt(id, 10))
+	}
+
+	query := types.H{
+		"query": types.H{
+			"ids": types.H{"values": values},
+		},
+	}
+	return e.listActions(query)
+}
+
+// ListActionsBySubjects ...
+func (e *EsEngine) ListActionsBySubjects(
+	beforeUpdatedAt int64,
+	subjects []types.Subject,
+) ([]types.SystemAction, error) {
+	return e.listActions(genSubjectsQuery(beforeUpdatedAt, subjects))
+}
+
+// ListActionsByResource ...
+func (e *EsEngine) ListActionsByResource(system string, resource types.Resource) ([]types.SystemAction, error) {
+	return e.listActions(genResourceActionsQuery(system, resource))
+}
+
+func (e *EsEngine) listActions(query types.H) ([]types.SystemAction, error) {
+	query["aggs"] = genSystemActionsAggs()
+
+	result, err := e.client.Search(context.Background(), e.indexName, query, 0, 0, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("es client search fail: %w", err)
+	}
+
+	return parseSystemActionsAggs(result), nil
 }
 
 func (e *EsEngine) getActionCount(system, action string) (int, error) {
@@ -193,6 +509,19 @@ func (e *EsEngine) getCount(query types.H) (int, error) {
 
 // LoadSnapshot ...
 func (e *EsEngine) LoadSnapshot(data []types.SnapRecord) error {
+	// NOTE: 快照是memory engine生成的, es中的any/doc策略可能不是最新的, 需要全量同步
+	if isSnapshotFromMemoryEngine(data) {
+		return errors.New("snapshot taken by memory doc engine, the es index may be out of date")
+	}
+
+	// NOTE: 索引中存在旧版本结构的doc, 需要全量同步重建
+	count, err := e.getCount(genOutdatedDocQuery())
+	if err != nil {
+		return fmt.Errorf("count the outdated docs fail: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w, %d docs in es index", ErrDocSchemaVersionOutdated, count)
+	}
 	return nil
 }
 
@@ -231,6 +560,9 @@ func genQuery(genFn esSearchQueryFunc, req *types.SearchRequest, size int) (quer
 	query["from"] = 0
 	query["size"] = size
 	query["_source"] = "subject"
+	if req.WithPolicies {
+		query["_source"] = []string{"subject", "id", "template_id", "expired_at", "type"}
+	}
 	query["track_total_hits"] = "true"
 	return
 }
@@ -260,6 +592,27 @@ func genQueriesByRequest(req *types.SearchRequest, entry *debug.Entry) []types.H
 type EsSearchResult struct {
 	anySubjects []types.Subject
 	docSubjects []types.Subject
+
+	// subject uid => the policies matched, only for the search with_policies
+	policies map[string][]types.MatchedPolicy
+}
+
+// Partial ES 查询超时会直接返回错误, 不会有部分结果
+func (e *EsSearchResult) Partial() bool {
+	return false
+}
+
+// MatchedPolicies ...
+func (e *EsSearchResult) MatchedPolicies() map[string][]types.MatchedPolicy {
+	return e.policies
+}
+
+// addPolicy ...
+func (e *EsSearchResult) addPolicy(subjectUID string, policy types.MatchedPolicy) {
+	if e.policies == nil {
+		e.policies = make(map[string][]types.MatchedPolicy)
+	}
+	e.policies[subjectUID] = append(e.policies[subjectUID], policy)
 }
 
 // GetSubjects ...
@@ -296,6 +649,19 @@ func getSearchResultByResponses(responses []interface{}, entry *debug.Entry) *Es
 			}
 
 			subjects = append(subjects, s)
+
+			// NOTE: with_policies 时 _source 中包含策略的字段
+			if id, ok := source["id"].(float64); ok {
+				templateID, _ := source["template_id"].(float64)
+				expiredAt, _ := source["expired_at"].(float64)
+				_type, _ := source["type"].(string)
+				esQuerySubjects.addPolicy(subjectUID, types.MatchedPolicy{
+					ID:         int64(id),
+					TemplateID: int64(templateID),
+					ExpiredAt:  int64(expiredAt),
+					Type:       types.ExpressionType(_type),
+				})
+			}
 		}
 
 		switch i {
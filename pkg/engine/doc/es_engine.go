@@ -12,65 +12,145 @@
 package doc
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 
 	"engine/pkg/types"
+	"engine/pkg/util"
 )
 
-// NOTE 当前ES的索引都是动态mapping, 所以text类型字段在默认查询时都会分词, 但是term要求精确匹配, 所以必须加上keyword
-// https://segmentfault.com/q/1010000017312707
-func genDocQuery(req *types.SearchRequest) types.H {
-	var sqs []types.H
+// docTerm the field of doc should be equal to the value, the field is `type.attribute` under the system
+type docTerm struct {
+	System string
+	Field  string
+	Value  interface{}
+}
 
-	system := req.System
-	action := req.Action.ID
+// Path ...
+func (t docTerm) Path() string {
+	return docFieldPath(t.System, t.Field)
+}
+
+// docRange the number bound field of the doc matched the range query of the request value
+type docRange struct {
+	System string
+	Field  string
+	OP     string
+	Value  float64
+}
+
+// Path ...
+func (r docRange) Path() string {
+	return docFieldPath(r.System, r.Field)
+}
+
+// genDocRanges will convert the number attributes of the request resource into range queries of the bound fields
+func genDocRanges(req *types.SearchRequest) []docRange {
+	var ranges []docRange
 
-	// NOTE: 这里req.Resource可能是多个, 理论上, 跨系统资源依赖不应该出现到doc search
+	for _, resourceNode := range req.Resource {
+		for key, value := range resourceNode.Attribute {
+			if key == types.BkIAMPathKey {
+				continue
+			}
+
+			field := fmt.Sprintf("%s.%s", resourceNode.Type, key)
+			for _, v := range toValueList(value) {
+				number, ok := util.ToFloat64(v)
+				if !ok {
+					continue
+				}
+
+				for _, f := range numberCompareFields {
+					ranges = append(ranges, docRange{
+						System: resourceNode.System,
+						Field:  field + f.Suffix,
+						OP:     f.RangeOP,
+						Value:  number,
+					})
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// genDocTerms will convert the request resource into terms, the doc matched any of the terms has the permission
+func genDocTerms(req *types.SearchRequest) []docTerm {
+	var terms []docTerm
+
+	// NOTE: 这里req.Resource可能是多个, 跨系统资源依赖时, field在resource node所属的系统下
 	for _, resourceNode := range req.Resource {
 		for key, value := range resourceNode.Attribute {
 			// 如果key是 _bk_iam_path_ 那么需要 拆分成多个 OR 关系去直接匹配(不走前缀匹配)
 			if key == types.BkIAMPathKey {
 				// if  x._bk_iam_path_ starts_with /biz,1/cluster,2/ =>  x._bk_iam_path_ in [/biz,1/, /biz,1/cluster,2/]
 				paths := generateBkIAMPathList(value)
-				term := fmt.Sprintf("resource.%s.%s.%s", system, resourceNode.Type, key)
+				field := fmt.Sprintf("%s.%s", resourceNode.Type, key)
 				for _, path := range paths {
-					sqs = append(sqs, types.H{
-						"term": types.H{term: path},
-					})
+					terms = append(terms, docTerm{System: resourceNode.System, Field: field, Value: path})
 				}
 
 				// if x._bk_iam_path_ starts_with /biz,1/cluster,2/ =>  x._bk_iam_path_contains_ in [/biz,1/, /cluster,2/]
 				nodes := generateBkIAMPathNodes(value)
-				containsTerm := fmt.Sprintf("resource.%s.%s.%s", system, resourceNode.Type, types.BkIAMPathContainsKey)
+				containsField := fmt.Sprintf("%s.%s", resourceNode.Type, types.BkIAMPathContainsKey)
 				for _, node := range nodes {
-					sqs = append(sqs, types.H{
-						"term": types.H{containsTerm: node},
-					})
+					terms = append(terms, docTerm{System: resourceNode.System, Field: containsField, Value: node})
 				}
 
 				continue
 			}
 
-			fieldName := fmt.Sprintf("resource.%s.%s.%s", system, resourceNode.Type, key)
-			sqs = append(sqs, types.H{
-				"term": types.H{fieldName: value},
-			})
-
+			field := fmt.Sprintf("%s.%s", resourceNode.Type, key)
+			terms = append(terms, docTerm{System: resourceNode.System, Field: field, Value: value})
 		}
 	}
+	return terms
+}
 
-	var subQuery types.H
-	switch len(sqs) {
-	case 0:
+// NOTE 当前ES的索引都是动态mapping, 所以text类型字段在默认查询时都会分词, 但是term要求精确匹配, 所以必须加上keyword
+// https://segmentfault.com/q/1010000017312707
+func genDocQuery(req *types.SearchRequest) types.H {
+	system := req.System
+	action := req.Action.ID
+
+	terms := genDocTerms(req)
+	ranges := genDocRanges(req)
+	if len(terms) == 0 && len(ranges) == 0 {
 		return nil
-	case 1:
-		subQuery = sqs[0]
-	default:
-		subQuery = types.H{
-			"bool": types.H{
-				"should": sqs,
+	}
+
+	sqs := make([]types.H, 0, len(terms)+len(ranges))
+	for _, t := range terms {
+		fieldName := "resource." + t.Path()
+		sqs = append(sqs, types.H{
+			"term": types.H{fieldName: t.Value},
+		})
+	}
+	for _, r := range ranges {
+		fieldName := "resource." + r.Path()
+		sqs = append(sqs, types.H{
+			"range": types.H{fieldName: types.H{r.OP: r.Value}},
+		})
+	}
+
+	// any of the terms matched, the doc not AND
+	orQuery := types.H{
+		"bool": types.H{
+			"should":               sqs,
+			"minimum_should_match": 1,
+			"must_not": types.H{
+				"exists": types.H{"field": andFieldsKey},
 			},
-		}
+		},
+	}
+
+	subQuery := types.H{
+		"bool": types.H{
+			"should":               []interface{}{orQuery, genANDDocQuery(terms)},
+			"minimum_should_match": 1,
+		},
 	}
 
 	must := []interface{}{
@@ -88,12 +168,14 @@ func genDocQuery(req *types.SearchRequest) types.H {
 	}
 
 	// filter the subject not the req.SubjectType
-	if req.SubjectType != types.SubjectTypeAll {
+	if req.SearchSubjectType() != types.SubjectTypeAll {
 		must = append(must, types.H{
-			"term": types.H{"subject.type": req.SubjectType},
+			"term": types.H{"subject.type": req.SearchSubjectType()},
 		})
 	}
 
+	must = append(must, genRequestFilters(req)...)
+
 	// subQuery AND expired_at > now
 	query := types.H{
 		"query": types.H{
@@ -106,6 +188,330 @@ func genDocQuery(req *types.SearchRequest) types.H {
 	return query
 }
 
+// genANDDocQuery all the fields of the AND doc should be matched
+// 1. terms_set: the and_fields of the doc are all in the fields of the request
+// 2. for each field of the request: the field not in the and_fields of the doc, or the field value matched
+func genANDDocQuery(terms []docTerm) types.H {
+	// NOTE: the field of and_fields is `system.type.attribute`
+	fields := make([]string, 0, len(terms))
+	fieldValues := make(map[string][]interface{}, len(terms))
+	for _, t := range terms {
+		path := t.Path()
+		values, ok := fieldValues[path]
+		if !ok {
+			fields = append(fields, path)
+		}
+		fieldValues[path] = append(values, toValueList(t.Value)...)
+	}
+
+	must := make([]interface{}, 0, len(fields)+1)
+	must = append(must, types.H{
+		"terms_set": types.H{
+			andFieldsKey: types.H{
+				"terms":                      fields,
+				"minimum_should_match_field": andFieldsCountKey,
+			},
+		},
+	})
+	for _, field := range fields {
+		fieldName := "resource." + field
+		must = append(must, types.H{
+			"bool": types.H{
+				"should": []interface{}{
+					types.H{"bool": types.H{"must_not": types.H{"term": types.H{andFieldsKey: field}}}},
+					types.H{"terms": types.H{fieldName: fieldValues[field]}},
+				},
+				"minimum_should_match": 1,
+			},
+		})
+	}
+
+	return types.H{
+		"bool": types.H{
+			"must": must,
+		},
+	}
+}
+
+// genRequestFilters filter the docs by the templates and the candidate subjects of the request
+func genRequestFilters(req *types.SearchRequest) []interface{} {
+	filters := make([]interface{}, 0, 2)
+	if templateFilter := genTemplateFilter(req); templateFilter != nil {
+		filters = append(filters, templateFilter)
+	}
+	if subjectUIDs := req.SubjectUIDSet(); subjectUIDs != nil {
+		uids := subjectUIDs.ToSlice()
+		sort.Strings(uids)
+
+		subjectFilter := types.H{"terms": types.H{"subject.uid": uids}}
+		// NOTE: 展开用户组时, 所有用户组都需要检索, 展开成员后再过滤
+		if req.ExpandGroups && req.SubjectType != types.SubjectTypeGroup {
+			subjectFilter = types.H{
+				"bool": types.H{
+					"should": []interface{}{
+						subjectFilter,
+						types.H{"term": types.H{"subject.type": types.SubjectTypeGroup}},
+					},
+					"minimum_should_match": 1,
+				},
+			}
+		}
+		filters = append(filters, subjectFilter)
+	}
+	return filters
+}
+
+// genTemplateFilter filter the docs by the templates of the request, nil if all the docs
+func genTemplateFilter(req *types.SearchRequest) types.H {
+	if req.ExcludeTemplates {
+		return types.H{"term": types.H{"template_id": 0}}
+	}
+	if len(req.TemplateIDs) > 0 {
+		return types.H{"terms": types.H{"template_id": req.TemplateIDs}}
+	}
+	return nil
+}
+
+// genReverseQuery 查询subject在system/action下的所有any/doc策略
+func genReverseQuery(req *types.ReverseSearchRequest) types.H {
+	return types.H{
+		"query": types.H{
+			"bool": types.H{
+				"filter": []interface{}{
+					types.H{
+						"range": types.H{
+							"expired_at": types.H{
+								"gte": req.NowTimestamp,
+							},
+						},
+					},
+					types.H{"term": types.H{"system": req.System}},
+					types.H{"term": types.H{"actions.id": req.Action.ID}},
+					types.H{"term": types.H{"subject.uid": req.SubjectUID()}},
+				},
+			},
+		},
+	}
+}
+
+// genOutdatedDocQuery query the docs not in the current doc schema version
+func genOutdatedDocQuery() types.H {
+	return types.H{
+		"query": types.H{
+			"bool": types.H{
+				"must_not": types.H{
+					"term": types.H{"schema_version": docSchemaVersion},
+				},
+			},
+		},
+	}
+}
+
+// genAnyOrDocQuery merge the any query and doc query into one: any OR doc
+func genAnyOrDocQuery(req *types.SearchRequest) types.H {
+	should := make([]interface{}, 0, 2)
+	for _, genFn := range []esSearchQueryFunc{genAnyQuery, genDocQuery} {
+		query := genFn(req)
+		if query == nil {
+			continue
+		}
+		should = append(should, query["query"])
+	}
+
+	return types.H{
+		"bool": types.H{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// genPageQuery sort the any OR doc query by subject uid for the cursor search
+func genPageQuery(req *types.SearchRequest) types.H {
+	query := types.H{
+		"query": genAnyOrDocQuery(req),
+		// NOTE: id作为第二排序字段, 保证search_after的位置是确定的
+		"sort": []interface{}{
+			types.H{"subject.uid": "asc"},
+			types.H{"id": "asc"},
+		},
+	}
+
+	if req.SearchCursor == nil {
+		return query
+	}
+	if len(req.SearchCursor.SearchAfter) > 0 {
+		query["search_after"] = req.SearchCursor.SearchAfter
+	}
+	if req.SearchCursor.PitID != "" {
+		query["pit"] = types.H{"id": req.SearchCursor.PitID, "keep_alive": pointInTimeKeepAlive}
+	}
+	return query
+}
+
+// genExplainQuery query the any OR doc policies of the subject
+func genExplainQuery(req *types.ExplainRequest) types.H {
+	return types.H{
+		"query": types.H{
+			"bool": types.H{
+				"filter": []interface{}{
+					genAnyOrDocQuery(req.ToSearchRequest()),
+					types.H{"term": types.H{"subject.uid": req.SubjectUID()}},
+				},
+			},
+		},
+	}
+}
+
+// genCountQuery count the distinct subjects of the any OR doc query, the excluded subjects will not be counted
+// NOTE: cardinality在precision_threshold以内的计数是接近精确的
+func genCountQuery(req *types.SearchRequest, excludedSubjectUIDs []string) types.H {
+	boolQuery := types.H{
+		"filter": []interface{}{genAnyOrDocQuery(req)},
+	}
+	// NOTE: 单个terms查询的值数量受es index.max_terms_count限制, 排除的subject分批放入多个terms查询
+	if len(excludedSubjectUIDs) > 0 {
+		mustNot := make([]interface{}, 0, len(excludedSubjectUIDs)/countExcludedTermsSize+1)
+		for start := 0; start < len(excludedSubjectUIDs); start += countExcludedTermsSize {
+			end := start + countExcludedTermsSize
+			if end > len(excludedSubjectUIDs) {
+				end = len(excludedSubjectUIDs)
+			}
+			mustNot = append(mustNot, types.H{"terms": types.H{"subject.uid": excludedSubjectUIDs[start:end]}})
+		}
+		boolQuery["must_not"] = mustNot
+	}
+
+	return types.H{
+		"query": types.H{
+			"bool": boolQuery,
+		},
+		"aggs": types.H{
+			"subject_count": types.H{
+				"cardinality": types.H{
+					"field":               "subject.uid",
+					"precision_threshold": countPrecisionThreshold,
+				},
+			},
+		},
+	}
+}
+
+// parseCountAggs parse the result of genCountQuery, error if the aggregation is missing
+func parseCountAggs(result types.H) (uint64, error) {
+	aggs, ok := result["aggregations"].(map[string]interface{})
+	if !ok {
+		return 0, errors.New("invalid count response, no aggregations")
+	}
+	subjectCount, ok := aggs["subject_count"].(map[string]interface{})
+	if !ok {
+		return 0, errors.New("invalid count response, no subject_count aggregation")
+	}
+	count, ok := subjectCount["value"].(float64)
+	if !ok {
+		return 0, errors.New("invalid count response, no subject_count value")
+	}
+	return uint64(count), nil
+}
+
+// genExpiredAtQuery aggregate the latest expired_at of each subject, sorted by the latest expired_at
+func genExpiredAtQuery(req *types.SearchRequest) types.H {
+	return types.H{
+		"query": genAnyOrDocQuery(req),
+		"aggs": types.H{
+			"subjects": types.H{
+				"terms": types.H{
+					"field": "subject.uid",
+					"size":  expiredAtSearchSize,
+					"order": types.H{"latest_expired_at": "asc"},
+				},
+				"aggs": types.H{
+					"latest_expired_at": types.H{
+						"max": types.H{"field": "expired_at"},
+					},
+					"subject": types.H{
+						"top_hits": types.H{
+							"size":    1,
+							"_source": types.H{"includes": []string{"subject"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// parseSubjectExpiriesAggs parse the result of genExpiredAtQuery
+func parseSubjectExpiriesAggs(result types.H) []types.SubjectExpiry {
+	subjects := make([]types.SubjectExpiry, 0, 10)
+
+	aggs, ok := result["aggregations"].(map[string]interface{})
+	if !ok {
+		return subjects
+	}
+
+	subjectAggs, _ := aggs["subjects"].(map[string]interface{})
+	buckets, _ := subjectAggs["buckets"].([]interface{})
+	for _, bucket := range buckets {
+		b, _ := bucket.(map[string]interface{})
+		latest, _ := b["latest_expired_at"].(map[string]interface{})
+		expiredAt, _ := latest["value"].(float64)
+
+		topHits, _ := b["subject"].(map[string]interface{})
+		hits, _ := topHits["hits"].(map[string]interface{})
+		hitList, _ := hits["hits"].([]interface{})
+		if len(hitList) == 0 {
+			continue
+		}
+		hit, _ := hitList[0].(map[string]interface{})
+		source, _ := hit["_source"].(map[string]interface{})
+		subject, _ := source["subject"].(map[string]interface{})
+
+		s := types.Subject{}
+		s.Type, _ = subject["type"].(string)
+		s.ID, _ = subject["id"].(string)
+		s.Name, _ = subject["name"].(string)
+		s.UID, _ = subject["uid"].(string)
+
+		subjects = append(subjects, types.SubjectExpiry{Subject: s, ExpiredAt: int64(expiredAt)})
+	}
+	return subjects
+}
+
+// searchHit the _source and the sort values of the hit
+type searchHit struct {
+	Source types.H
+	Sort   []interface{}
+}
+
+// parseSearchHits parse the hits of the search response, error if the response is not valid
+func parseSearchHits(result types.H) ([]searchHit, error) {
+	hitsObj, ok := result["hits"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid search response, no hits")
+	}
+	hitList, ok := hitsObj["hits"].([]interface{})
+	if !ok {
+		return nil, errors.New("invalid search response, no hits")
+	}
+
+	hits := make([]searchHit, 0, len(hitList))
+	for _, hit := range hitList {
+		h, ok := hit.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid search response, hit is not an object")
+		}
+		source, ok := h["_source"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid search response, hit without _source")
+		}
+		sortValues, _ := h["sort"].([]interface{})
+
+		hits = append(hits, searchHit{Source: source, Sort: sortValues})
+	}
+	return hits, nil
+}
+
 // genSubjectsQuery ...
 func genSubjectsQuery(timestamp int64, subjects []types.Subject) types.H {
 	subQuery := genSubjectsBoolCondition(subjects)
@@ -129,6 +535,87 @@ func genSubjectsQuery(timestamp int64, subjects []types.Subject) types.H {
 	return query
 }
 
+// genExpiredQuery query the docs expired before the timestamp
+func genExpiredQuery(timestamp int64) types.H {
+	return types.H{
+		"query": types.H{
+			"range": types.H{
+				"expired_at": types.H{
+					"lt": timestamp,
+				},
+			},
+		},
+	}
+}
+
+// genResourceActionsQuery query the docs of the system, any or having the fields of the resource types
+func genResourceActionsQuery(system string, resource types.Resource) types.H {
+	should := make([]interface{}, 0, len(resource)+1)
+	should = append(should, types.H{"term": types.H{"type": string(types.Any)}})
+	for _, node := range resource {
+		// NOTE: resource下按资源类型所属系统分组, exists对象字段时匹配任意子字段
+		should = append(should, types.H{
+			"exists": types.H{"field": "resource." + node.System + "." + node.Type},
+		})
+	}
+
+	return types.H{
+		"query": types.H{
+			"bool": types.H{
+				"filter": []interface{}{
+					types.H{"term": types.H{"system": system}},
+					types.H{
+						"bool": types.H{
+							"should":               should,
+							"minimum_should_match": 1,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// genSystemActionsAggs aggregate the distinct system actions of the docs
+func genSystemActionsAggs() types.H {
+	return types.H{
+		"systems": types.H{
+			"terms": types.H{"field": "system", "size": 1000},
+			"aggs": types.H{
+				"actions": types.H{
+					"terms": types.H{"field": "actions.id", "size": 10000},
+				},
+			},
+		},
+	}
+}
+
+// parseSystemActionsAggs parse the result of genSystemActionsAggs
+func parseSystemActionsAggs(result types.H) []types.SystemAction {
+	actions := make([]types.SystemAction, 0, 2)
+
+	aggs, ok := result["aggregations"].(map[string]interface{})
+	if !ok {
+		return actions
+	}
+
+	systems, _ := aggs["systems"].(map[string]interface{})
+	systemBuckets, _ := systems["buckets"].([]interface{})
+	for _, systemBucket := range systemBuckets {
+		sb, _ := systemBucket.(map[string]interface{})
+		system, _ := sb["key"].(string)
+
+		actionAggs, _ := sb["actions"].(map[string]interface{})
+		actionBuckets, _ := actionAggs["buckets"].([]interface{})
+		for _, actionBucket := range actionBuckets {
+			ab, _ := actionBucket.(map[string]interface{})
+			action, _ := ab["key"].(string)
+			actions = append(actions, types.SystemAction{System: system, Action: action})
+		}
+	}
+	return actions
+}
+
 func genSubjectsBoolCondition(subjects []types.Subject) types.H {
 	var sqs []types.H
 	for _, subject := range subjects {
@@ -176,12 +663,14 @@ func genAnyQuery(req *types.SearchRequest) types.H {
 	}
 
 	// filter the subject not the req.SubjectType
-	if req.SubjectType != types.SubjectTypeAll {
+	if req.SearchSubjectType() != types.SubjectTypeAll {
 		filter = append(filter, types.H{
-			"term": types.H{"subject.type": req.SubjectType},
+			"term": types.H{"subject.type": req.SearchSubjectType()},
 		})
 	}
 
+	filter = append(filter, genRequestFilters(req)...)
+
 	// use the `filter` replace the `must`
 	query := types.H{
 		"query": types.H{
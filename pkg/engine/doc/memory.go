@@ -0,0 +1,951 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package doc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	log "github.com/sirupsen/logrus"
+
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+// memoryEngineName the doc engine name in snapshot
+const memoryEngineName = "memory"
+
+// ErrSnapshotNotFromMemoryEngine the snapshot not contains the any/doc policies
+var ErrSnapshotNotFromMemoryEngine = errors.New("snapshot not taken by memory doc engine")
+
+// MemoryEngine the in-memory inverted index of any/doc policies, can be used instead of the EsEngine
+// NOTE: 索引结构与ES的文档一致: system/action => type.attribute => value => policy ids
+type MemoryEngine struct {
+	engines       sync.Map
+	lastIndexTime time.Time
+}
+
+// NewMemoryEngine ...
+func NewMemoryEngine() (types.DocEngine, error) {
+	return &MemoryEngine{
+		lastIndexTime: time.Time{},
+	}, nil
+}
+
+func (e *MemoryEngine) genKey(system, action string) string {
+	return system + ":" + action
+}
+
+func (e *MemoryEngine) getActionEngine(system, action string) (engine *actionMemoryEngine, ok bool) {
+	value, ok := e.engines.Load(e.genKey(system, action))
+	if !ok {
+		return nil, false
+	}
+	return value.(*actionMemoryEngine), true
+}
+
+func (e *MemoryEngine) getOrCreateActionEngine(system, action string) *actionMemoryEngine {
+	value, _ := e.engines.LoadOrStore(e.genKey(system, action), newActionMemoryEngine(system, action))
+	return value.(*actionMemoryEngine)
+}
+
+func (e *MemoryEngine) engineRange(f func(engine *actionMemoryEngine)) {
+	e.engines.Range(func(key, value interface{}) bool {
+		f(value.(*actionMemoryEngine))
+		return true
+	})
+}
+
+// Size ...
+func (e *MemoryEngine) Size(system, action string) uint64 {
+	engine, ok := e.getActionEngine(system, action)
+	if ok {
+		return engine.size()
+	}
+	return 0
+}
+
+// Total ...
+func (e *MemoryEngine) Total() (size uint64) {
+	// NOTE: 与es一致, 一条策略有多个操作时只计算一次
+	ids := map[int64]struct{}{}
+	e.engineRange(func(engine *actionMemoryEngine) {
+		for _, id := range engine.ids() {
+			ids[id] = struct{}{}
+		}
+	})
+	return uint64(len(ids))
+}
+
+// GetLastIndexTime ...
+func (e *MemoryEngine) GetLastIndexTime() time.Time {
+	return e.lastIndexTime
+}
+
+// BulkAdd ...
+func (e *MemoryEngine) BulkAdd(policies []*types.Policy) error {
+	docs := make([]*memoryDoc, 0, len(policies))
+	ids := make([]int64, 0, len(policies))
+	for _, p := range policies {
+		doc, err := newMemoryDoc(p)
+		if err != nil {
+			return fmt.Errorf("make doc fail: %w", err)
+		}
+
+		docs = append(docs, doc)
+		ids = append(ids, p.ID)
+	}
+
+	// NOTE: 策略的操作可能变更, 先从所有操作中删除, 与es的覆盖写入保持一致
+	e.engineRange(func(engine *actionMemoryEngine) {
+		engine.bulkDelete(ids)
+	})
+
+	for _, doc := range docs {
+		for _, action := range doc.policy.Actions {
+			e.getOrCreateActionEngine(doc.policy.System, action.ID).add(doc)
+		}
+	}
+
+	e.lastIndexTime = time.Now()
+	return nil
+}
+
+// BulkDelete ...
+func (e *MemoryEngine) BulkDelete(ids []int64, logger *log.Entry) error {
+	e.engineRange(func(engine *actionMemoryEngine) {
+		engine.bulkDelete(ids)
+	})
+	e.lastIndexTime = time.Now()
+	return nil
+}
+
+// BulkDeleteBySubjects ...
+func (e *MemoryEngine) BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Subject, logger *log.Entry) error {
+	matchFunc := subjectsMatchFunc(beforeUpdatedAt, subjects)
+	e.engineRange(func(engine *actionMemoryEngine) {
+		engine.bulkDeleteByMatchFunc(matchFunc)
+	})
+	e.lastIndexTime = time.Now()
+	return nil
+}
+
+// PurgeExpired ...
+func (e *MemoryEngine) PurgeExpired(beforeExpiredAt int64, logger *log.Entry) (count uint64, err error) {
+	e.engineRange(func(engine *actionMemoryEngine) {
+		count += uint64(engine.bulkDeleteByMatchFunc(func(policy *types.Policy) bool {
+			return policy.ExpiredAt < beforeExpiredAt
+		}))
+	})
+	if count > 0 {
+		e.lastIndexTime = time.Now()
+	}
+	return count, nil
+}
+
+// ListActionsByIDs ...
+func (e *MemoryEngine) ListActionsByIDs(ids []int64) ([]types.SystemAction, error) {
+	return e.listActions(func(engine *actionMemoryEngine) bool {
+		return engine.hasAny(ids)
+	}), nil
+}
+
+// ListActionsBySubjects ...
+func (e *MemoryEngine) ListActionsBySubjects(
+	beforeUpdatedAt int64,
+	subjects []types.Subject,
+) ([]types.SystemAction, error) {
+	matchFunc := subjectsMatchFunc(beforeUpdatedAt, subjects)
+	return e.listActions(func(engine *actionMemoryEngine) bool {
+		return engine.hasMatched(matchFunc)
+	}), nil
+}
+
+// ListActionsByResource ...
+func (e *MemoryEngine) ListActionsByResource(system string, resource types.Resource) ([]types.SystemAction, error) {
+	return e.listActions(func(engine *actionMemoryEngine) bool {
+		return engine.system == system && engine.hasMatched(func(policy *types.Policy) bool {
+			return policy.MatchResourceTypes(resource)
+		})
+	}), nil
+}
+
+func (e *MemoryEngine) listActions(f func(engine *actionMemoryEngine) bool) []types.SystemAction {
+	actions := make([]types.SystemAction, 0, 2)
+	e.engineRange(func(engine *actionMemoryEngine) {
+		if f(engine) {
+			actions = append(actions, types.SystemAction{System: engine.system, Action: engine.action})
+		}
+	})
+	return actions
+}
+
+// subjectsMatchFunc return the func matching the policies of the subjects updated before the timestamp
+func subjectsMatchFunc(beforeUpdatedAt int64, subjects []types.Subject) func(policy *types.Policy) bool {
+	subjectUIDs := set.NewFixedLengthStringSet(len(subjects))
+	for _, subject := range subjects {
+		subjectUIDs.Add(subject.Type + ":" + subject.ID)
+	}
+
+	return func(policy *types.Policy) bool {
+		return subjectUIDs.Has(policy.Subject.UID) && policy.UpdatedAt < beforeUpdatedAt
+	}
+}
+
+// Search ...
+func (e *MemoryEngine) Search(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) (types.SearchResult, error) {
+	result := &EsSearchResult{}
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return result, nil
+	}
+
+	anyPolicies, docPolicies := engine.search(req)
+	result.anySubjects = distinctSubjects(anyPolicies, req.Limit)
+	result.docSubjects = distinctSubjects(docPolicies, req.Limit)
+
+	if req.WithPolicies {
+		for _, p := range anyPolicies {
+			result.addPolicy(p.Subject.UID, types.NewMatchedPolicy(p, types.Any))
+		}
+		for _, p := range docPolicies {
+			result.addPolicy(p.Subject.UID, types.NewMatchedPolicy(p, types.Doc))
+		}
+	}
+
+	// NOTE: 复用es的debug信息, doc记录的是匹配的terms
+	debug.WithEsQuery(entry, string(types.Any), nil)
+	debug.WithEsQuery(entry, string(types.Doc), genDocTerms(req))
+	debug.WithEsQuerySubjects(entry, string(types.Any), result.anySubjects)
+	debug.WithEsQuerySubjects(entry, string(types.Doc), result.docSubjects)
+	return result, nil
+}
+
+// SearchPolicies ...
+func (e *MemoryEngine) SearchPolicies(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) (map[string][]types.MatchedPolicy, error) {
+	policies := make(map[string][]types.MatchedPolicy)
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return policies, nil
+	}
+
+	anyPolicies, docPolicies := engine.search(req)
+	for _, p := range anyPolicies {
+		policies[p.Subject.UID] = append(policies[p.Subject.UID], types.NewMatchedPolicy(p, types.Any))
+	}
+	for _, p := range docPolicies {
+		policies[p.Subject.UID] = append(policies[p.Subject.UID], types.NewMatchedPolicy(p, types.Doc))
+	}
+	return policies, nil
+}
+
+// BatchSearch ...
+func (e *MemoryEngine) BatchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SearchResult, error) {
+	results := make([]types.SearchResult, 0, len(requests))
+	for idx, req := range requests {
+		result, err := e.Search(ctx, req, debug.GetSubEntryByIndex(entry, idx))
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ReverseSearch ...
+func (e *MemoryEngine) ReverseSearch(
+	ctx context.Context,
+	req *types.ReverseSearchRequest,
+	entry *debug.Entry,
+) (*types.ReverseSearchResult, error) {
+	result := types.NewReverseSearchResult()
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return result, nil
+	}
+
+	parseReverseSearchDocs(engine.subjectDocs(req.SubjectUID(), req.NowTimestamp), result)
+	return result, nil
+}
+
+// PageSearch ...
+func (e *MemoryEngine) PageSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	size int,
+	entry *debug.Entry,
+) (*types.SearchPage, error) {
+	page := &types.SearchPage{}
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return page, nil
+	}
+
+	after := ""
+	if req.SearchCursor != nil && len(req.SearchCursor.SearchAfter) > 0 {
+		after, _ = req.SearchCursor.SearchAfter[0].(string)
+	}
+
+	anyPolicies, docPolicies := engine.search(req)
+	subjects := distinctSubjects(append(anyPolicies, docPolicies...), -1)
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].UID < subjects[j].UID
+	})
+
+	// skip the subjects before the cursor
+	begin := sort.Search(len(subjects), func(i int) bool {
+		return subjects[i].UID > after
+	})
+	subjects = subjects[begin:]
+
+	if len(subjects) > size {
+		subjects = subjects[:size]
+		page.HasMore = true
+	}
+	page.Subjects = subjects
+	return page, nil
+}
+
+// OpenPointInTime not support, the pages are searched from the latest policies
+func (e *MemoryEngine) OpenPointInTime(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// ClosePointInTime ...
+func (e *MemoryEngine) ClosePointInTime(ctx context.Context, pitID string) error {
+	return nil
+}
+
+// SearchExpiredAt ...
+func (e *MemoryEngine) SearchExpiredAt(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return nil, nil
+	}
+
+	anyPolicies, docPolicies := engine.search(req)
+	return latestExpiries(append(anyPolicies, docPolicies...)), nil
+}
+
+// Count ...
+func (e *MemoryEngine) Count(
+	ctx context.Context,
+	req *types.SearchRequest,
+	excludedSubjectUIDs []string,
+	entry *debug.Entry,
+) (uint64, error) {
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return 0, nil
+	}
+
+	anyPolicies, docPolicies := engine.search(req)
+	result := &EsSearchResult{
+		anySubjects: distinctSubjects(anyPolicies, -1),
+		docSubjects: distinctSubjects(docPolicies, -1),
+	}
+	return uint64(len(result.GetSubjects(set.NewStringSetWithValues(excludedSubjectUIDs)))), nil
+}
+
+// Explain ...
+func (e *MemoryEngine) Explain(
+	ctx context.Context,
+	req *types.ExplainRequest,
+	entry *debug.Entry,
+) ([]types.ExplainPolicy, error) {
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return nil, nil
+	}
+
+	subjectUID := req.SubjectUID()
+	anyPolicies, docPolicies := engine.search(req.ToSearchRequest())
+
+	policies := make([]types.ExplainPolicy, 0, 2)
+	for _, p := range append(anyPolicies, docPolicies...) {
+		if p.Subject.UID != subjectUID {
+			continue
+		}
+
+		policy := types.ExplainPolicy{
+			ID:         p.ID,
+			TemplateID: p.TemplateID,
+			ExpiredAt:  p.ExpiredAt,
+			Type:       p.ExpressionType,
+		}
+		policies = append(policies, policy)
+		debug.AddPolicy(entry, policy)
+	}
+	return policies, nil
+}
+
+// TakeSnapshot ...
+func (e *MemoryEngine) TakeSnapshot() []types.SnapRecord {
+	data := make([]types.SnapRecord, 0, 10)
+	e.engineRange(func(engine *actionMemoryEngine) {
+		data = append(data, types.SnapRecord{
+			System:                engine.system,
+			Action:                engine.action,
+			LastModifiedTimestamp: engine.getLastIndexTime().Unix(),
+			DocEngine:             memoryEngineName,
+			DocPolicies:           engine.dump(),
+			DocSchemaVersion:      docSchemaVersion,
+		})
+	})
+
+	// NOTE: 没有任何策略时, 也需要标记快照来自memory engine, 否则加载时会认为快照中没有any/doc策略
+	if len(data) == 0 {
+		data = append(data, types.SnapRecord{DocEngine: memoryEngineName, DocSchemaVersion: docSchemaVersion})
+	}
+	return data
+}
+
+// LoadSnapshot ...
+func (e *MemoryEngine) LoadSnapshot(data []types.SnapRecord) error {
+	// NOTE: 快照不是memory engine生成的(之前使用的es), 需要全量同步
+	if !isSnapshotFromMemoryEngine(data) {
+		return ErrSnapshotNotFromMemoryEngine
+	}
+
+	// NOTE: 旧版本的快照中策略没有记录资源类型所属的系统, 需要全量同步
+	for _, record := range data {
+		if record.DocEngine == memoryEngineName && record.DocSchemaVersion != docSchemaVersion {
+			return ErrDocSchemaVersionOutdated
+		}
+	}
+
+	for _, record := range data {
+		if len(record.DocPolicies) == 0 {
+			continue
+		}
+
+		err := e.BulkAdd(record.DocPolicies)
+		if err != nil {
+			return err
+		}
+
+		engine, ok := e.getActionEngine(record.System, record.Action)
+		if ok {
+			engine.setLastIndexTime(time.Unix(record.LastModifiedTimestamp, 0))
+		}
+	}
+	return nil
+}
+
+func isSnapshotFromMemoryEngine(data []types.SnapRecord) bool {
+	for _, record := range data {
+		if record.DocEngine == memoryEngineName {
+			return true
+		}
+	}
+	return false
+}
+
+// distinctSubjects return the subjects of the policies, at most limit if limit > 0
+func distinctSubjects(policies []*types.Policy, limit int) []types.Subject {
+	subjects := make([]types.Subject, 0, len(policies))
+	subjectUIDs := set.NewFixedLengthStringSet(len(policies))
+	for _, p := range policies {
+		if limit > 0 && len(subjects) >= limit {
+			break
+		}
+		if subjectUIDs.Has(p.Subject.UID) {
+			continue
+		}
+
+		subjects = append(subjects, p.Subject)
+		subjectUIDs.Add(p.Subject.UID)
+	}
+	return subjects
+}
+
+// latestExpiries return the subjects of the policies with the latest expired_at, sorted by expired_at
+func latestExpiries(policies []*types.Policy) []types.SubjectExpiry {
+	subjects := make([]types.SubjectExpiry, 0, len(policies))
+	subjectIndex := make(map[string]int, len(policies))
+	for _, p := range policies {
+		if idx, ok := subjectIndex[p.Subject.UID]; ok {
+			if p.ExpiredAt > subjects[idx].ExpiredAt {
+				subjects[idx].ExpiredAt = p.ExpiredAt
+			}
+			continue
+		}
+
+		subjectIndex[p.Subject.UID] = len(subjects)
+		subjects = append(subjects, types.SubjectExpiry{Subject: p.Subject, ExpiredAt: p.ExpiredAt})
+	}
+
+	sort.SliceStable(subjects, func(i, j int) bool {
+		return subjects[i].ExpiredAt < subjects[j].ExpiredAt
+	})
+	return subjects
+}
+
+// memoryDoc the policy with the doc object, same as the `resource` of the es doc
+type memoryDoc struct {
+	policy *types.Policy
+
+	// system.type.attribute => values
+	fields map[string][]interface{}
+	// system.type.attribute__gte => number bound of the number compare expression
+	bounds map[string]float64
+	// all the fields should be matched if the policy is AND expression
+	and bool
+}
+
+func newMemoryDoc(policy *types.Policy) (*memoryDoc, error) {
+	resource, err := makeDocResource(policy.ExpressionType, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string][]interface{}, 2)
+	bounds := make(map[string]float64)
+	for system, object := range resource {
+		for field, value := range object.(types.H) {
+			path := docFieldPath(system, field)
+			if _, _, ok := parseNumberCompareField(field); ok {
+				bounds[path], _ = value.(float64)
+				continue
+			}
+			fields[path] = toValueList(value)
+		}
+	}
+	return &memoryDoc{
+		policy: policy,
+		fields: fields,
+		bounds: bounds,
+		and:    isANDDoc(policy.ExpressionType, policy),
+	}, nil
+}
+
+// matchAll return true if all the fields of the doc matched the term values
+func (d *memoryDoc) matchAll(termValues map[string]map[string]struct{}) bool {
+	for path, values := range d.fields {
+		matched := false
+		for _, value := range values {
+			if _, ok := termValues[path][memoryValueKey(value)]; ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// toMap convert into the es doc _source format
+func (d *memoryDoc) toMap() types.H {
+	resource := map[string]interface{}{
+		d.policy.System: map[string]interface{}{},
+	}
+	setField := func(path string, value interface{}) {
+		system, field := splitDocFieldPath(path)
+		object, ok := resource[system].(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{}
+			resource[system] = object
+		}
+		object[field] = value
+	}
+
+	paths := make([]string, 0, len(d.fields))
+	for path, values := range d.fields {
+		setField(path, values)
+		paths = append(paths, path)
+	}
+	for path, bound := range d.bounds {
+		setField(path, bound)
+		paths = append(paths, path)
+	}
+
+	doc := types.H{
+		"type":     string(d.policy.ExpressionType),
+		"resource": resource,
+	}
+	if d.and {
+		sort.Strings(paths)
+		doc[andFieldsKey] = paths
+	}
+	return doc
+}
+
+// memoryValueKey the value of term, `1` and `"1"` are the same, like the es keyword
+func memoryValueKey(value interface{}) string {
+	return fmt.Sprintf("%v", value)
+}
+
+// actionMemoryEngine ...
+type actionMemoryEngine struct {
+	system string
+	action string
+
+	docs   map[int64]*memoryDoc
+	anyIDs map[int64]struct{}
+	// system.type.attribute => value => policy ids
+	index map[string]map[string]map[int64]struct{}
+	// system.type.attribute__gte => policy id => number bound
+	bounds map[string]map[int64]float64
+
+	lastIndexTime time.Time
+
+	mu *sync.RWMutex
+}
+
+func newActionMemoryEngine(system, action string) *actionMemoryEngine {
+	return &actionMemoryEngine{
+		system: system,
+		action: action,
+
+		docs:   make(map[int64]*memoryDoc, 10),
+		anyIDs: make(map[int64]struct{}, 10),
+		index:  make(map[string]map[string]map[int64]struct{}, 10),
+		bounds: make(map[string]map[int64]float64),
+
+		lastIndexTime: time.Now(),
+
+		mu: new(sync.RWMutex),
+	}
+}
+
+// size ...
+func (e *actionMemoryEngine) size() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return uint64(len(e.docs))
+}
+
+// ids ...
+func (e *actionMemoryEngine) ids() []int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ids := make([]int64, 0, len(e.docs))
+	for id := range e.docs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// add ...
+func (e *actionMemoryEngine) add(doc *memoryDoc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := doc.policy.ID
+	e.docs[id] = doc
+
+	if doc.policy.ExpressionType == types.Any {
+		e.anyIDs[id] = struct{}{}
+	}
+
+	for field, values := range doc.fields {
+		valueIDs, ok := e.index[field]
+		if !ok {
+			valueIDs = make(map[string]map[int64]struct{}, len(values))
+			e.index[field] = valueIDs
+		}
+
+		for _, value := range values {
+			key := memoryValueKey(value)
+			ids, ok := valueIDs[key]
+			if !ok {
+				ids = make(map[int64]struct{}, 1)
+				valueIDs[key] = ids
+			}
+			ids[id] = struct{}{}
+		}
+	}
+
+	for field, bound := range doc.bounds {
+		idBounds, ok := e.bounds[field]
+		if !ok {
+			idBounds = make(map[int64]float64, 1)
+			e.bounds[field] = idBounds
+		}
+		idBounds[id] = bound
+	}
+
+	e.lastIndexTime = time.Now()
+}
+
+// bulkDelete ...
+func (e *actionMemoryEngine) bulkDelete(ids []int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	deleted := false
+	for _, id := range ids {
+		if e.delete(id) {
+			deleted = true
+		}
+	}
+
+	if deleted {
+		e.lastIndexTime = time.Now()
+	}
+}
+
+// hasAny return true if any of the policies in the engine
+func (e *actionMemoryEngine) hasAny(ids []int64) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, id := range ids {
+		if _, ok := e.docs[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMatched return true if any policy in the engine matched
+func (e *actionMemoryEngine) hasMatched(matchFunc func(policy *types.Policy) bool) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, doc := range e.docs {
+		if matchFunc(doc.policy) {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkDeleteByMatchFunc delete the policies matched, return the count of policies deleted
+func (e *actionMemoryEngine) bulkDeleteByMatchFunc(matchFunc func(policy *types.Policy) bool) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	deleteIDs := make([]int64, 0, 10)
+	for id, doc := range e.docs {
+		if matchFunc(doc.policy) {
+			deleteIDs = append(deleteIDs, id)
+		}
+	}
+
+	for _, id := range deleteIDs {
+		e.delete(id)
+	}
+
+	e.lastIndexTime = time.Now()
+	return len(deleteIDs)
+}
+
+// delete will remove the doc from the index, should be called with the lock held
+func (e *actionMemoryEngine) delete(id int64) bool {
+	doc, ok := e.docs[id]
+	if !ok {
+		return false
+	}
+
+	for field, values := range doc.fields {
+		valueIDs := e.index[field]
+		for _, value := range values {
+			key := memoryValueKey(value)
+			delete(valueIDs[key], id)
+			if len(valueIDs[key]) == 0 {
+				delete(valueIDs, key)
+			}
+		}
+		if len(valueIDs) == 0 {
+			delete(e.index, field)
+		}
+	}
+
+	for field := range doc.bounds {
+		delete(e.bounds[field], id)
+		if len(e.bounds[field]) == 0 {
+			delete(e.bounds, field)
+		}
+	}
+
+	delete(e.anyIDs, id)
+	delete(e.docs, id)
+	return true
+}
+
+// search will return the any policies and the doc policies matched, sorted by id
+func (e *actionMemoryEngine) search(req *types.SearchRequest) (anyPolicies, docPolicies []*types.Policy) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	subjectUIDs := req.SubjectUIDSet()
+
+	// 1. any
+	for id := range e.anyIDs {
+		if p := e.docs[id].policy; e.isValid(req, subjectUIDs, p) {
+			anyPolicies = append(anyPolicies, p)
+		}
+	}
+
+	// 2. doc, match any of the terms
+	matchedIDs := map[int64]struct{}{}
+	// system.type.attribute => value keys of the terms
+	termValues := map[string]map[string]struct{}{}
+	for _, t := range genDocTerms(req) {
+		path := t.Path()
+		values, ok := termValues[path]
+		if !ok {
+			values = map[string]struct{}{}
+			termValues[path] = values
+		}
+
+		valueIDs := e.index[path]
+		for _, value := range toValueList(t.Value) {
+			key := memoryValueKey(value)
+			values[key] = struct{}{}
+
+			for id := range valueIDs[key] {
+				matchedIDs[id] = struct{}{}
+			}
+		}
+	}
+	// 3. doc, the number bound in the range of the request value
+	for _, r := range genDocRanges(req) {
+		for id, bound := range e.bounds[r.Path()] {
+			if inRange(bound, r.OP, r.Value) {
+				matchedIDs[id] = struct{}{}
+			}
+		}
+	}
+
+	for id := range matchedIDs {
+		doc := e.docs[id]
+		// NOTE: AND的doc需要所有field都命中
+		if doc.and && !doc.matchAll(termValues) {
+			continue
+		}
+
+		if p := doc.policy; e.isValid(req, subjectUIDs, p) {
+			docPolicies = append(docPolicies, p)
+		}
+	}
+
+	sortPoliciesByID(anyPolicies)
+	sortPoliciesByID(docPolicies)
+	return anyPolicies, docPolicies
+}
+
+// isValid check the policy is not expired, the subject type / template matched,
+// and the subject in the candidate subjects if subjectUIDs not nil
+func (e *actionMemoryEngine) isValid(req *types.SearchRequest, subjectUIDs *set.StringSet, p *types.Policy) bool {
+	if p.ExpiredAt < req.NowTimestamp {
+		return false
+	}
+
+	if !req.MatchTemplate(p.TemplateID) {
+		return false
+	}
+
+	if !req.IsCandidate(subjectUIDs, &p.Subject) {
+		return false
+	}
+
+	subjectType := req.SearchSubjectType()
+	return subjectType == types.SubjectTypeAll || subjectType == p.Subject.Type
+}
+
+// subjectDocs return the docs of the subject not expired, in the es doc _source format
+func (e *actionMemoryEngine) subjectDocs(subjectUID string, nowTimestamp int64) []types.H {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	docs := make([]types.H, 0, 2)
+	for _, doc := range e.docs {
+		if doc.policy.Subject.UID != subjectUID || doc.policy.ExpiredAt < nowTimestamp {
+			continue
+		}
+		docs = append(docs, doc.toMap())
+	}
+	return docs
+}
+
+// dump ...
+func (e *actionMemoryEngine) dump() []*types.Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ps := make([]*types.Policy, 0, len(e.docs))
+	for _, doc := range e.docs {
+		ps = append(ps, doc.policy)
+	}
+	return ps
+}
+
+// getLastIndexTime ...
+func (e *actionMemoryEngine) getLastIndexTime() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.lastIndexTime
+}
+
+// setLastIndexTime ...
+func (e *actionMemoryEngine) setLastIndexTime(lastIndexTime time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastIndexTime = lastIndexTime
+}
+
+// inRange return true if the bound matched the range query `bound rangeOP value`
+func inRange(bound float64, rangeOP string, value float64) bool {
+	switch rangeOP {
+	case "gt":
+		return bound > value
+	case "gte":
+		return bound >= value
+	case "lt":
+		return bound < value
+	case "lte":
+		return bound <= value
+	default:
+		return false
+	}
+}
+
+func sortPoliciesByID(policies []*types.Policy) {
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+}
@@ -0,0 +1,573 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package doc
+
+import (
+	"context"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
+)
+
+func newTestPolicy(
+	id int64,
+	subjectType, subjectID string,
+	exprType types.ExpressionType,
+	expr expression.ExprCell,
+) *types.Policy {
+	p := &types.Policy{
+		ID:             id,
+		System:         "bk_cmdb",
+		Actions:        []types.Action{{ID: "view_host"}},
+		Subject:        types.Subject{Type: subjectType, ID: subjectID, Name: subjectID},
+		Expression:     expr,
+		ExpiredAt:      200,
+		UpdatedAt:      100,
+		ExpressionType: exprType,
+	}
+	_ = p.FillUniqueFields()
+	return p
+}
+
+func newTestSearchRequest(attribute map[string]interface{}) *types.SearchRequest {
+	return &types.SearchRequest{
+		System: "bk_cmdb",
+		Action: types.Action{ID: "view_host"},
+		Resource: []types.ResourceNode{
+			{System: "bk_cmdb", Type: "host", ID: "1", Attribute: attribute},
+		},
+		SubjectType:  types.SubjectTypeAll,
+		NowTimestamp: 100,
+	}
+}
+
+func subjectUIDs(subjects []types.Subject) []string {
+	uids := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		uids = append(uids, s.UID)
+	}
+	return uids
+}
+
+func expirySubjectUIDs(subjects []types.SubjectExpiry) []string {
+	uids := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		uids = append(uids, s.UID)
+	}
+	return uids
+}
+
+var _ = Describe("MemoryEngine", func() {
+	var e types.DocEngine
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		e, _ = NewMemoryEngine()
+		_ = e.BulkAdd([]*types.Policy{
+			newTestPolicy(1, "user", "any", types.Any, expression.ExprCell{OP: operator.Any, Field: "host.id"}),
+			newTestPolicy(2, "user", "eq", types.Doc, expression.ExprCell{
+				OP: operator.Eq, Field: "host.id", Value: "1",
+			}),
+			newTestPolicy(3, "group", "in", types.Doc, expression.ExprCell{
+				OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"},
+			}),
+			newTestPolicy(4, "user", "path", types.Doc, expression.ExprCell{
+				OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/set,*/",
+			}),
+			newTestPolicy(5, "user", "contains", types.Doc, expression.ExprCell{
+				OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,3/",
+			}),
+			newTestPolicy(6, "user", "other", types.Doc, expression.ExprCell{
+				OP: operator.Eq, Field: "host.id", Value: "2",
+			}),
+		})
+	})
+
+	It("size", func() {
+		assert.Equal(GinkgoT(), uint64(6), e.Size("bk_cmdb", "view_host"))
+		assert.Equal(GinkgoT(), uint64(0), e.Size("bk_cmdb", "edit_host"))
+		assert.Equal(GinkgoT(), uint64(6), e.Total())
+	})
+
+	It("search", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1", "_bk_iam_path_": "/biz,1/set,3/"})
+		result, err := e.Search(ctx, req, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(),
+			[]string{"user:any", "user:eq", "group:in", "user:path", "user:contains"},
+			subjectUIDs(result.GetSubjects(set.NewStringSet())),
+		)
+	})
+
+	It("search with policies", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		result, _ := e.Search(ctx, req, nil)
+		assert.Empty(GinkgoT(), result.MatchedPolicies())
+
+		req.WithPolicies = true
+		result, _ = e.Search(ctx, req, nil)
+		assert.Equal(GinkgoT(), []types.MatchedPolicy{{ID: 1, ExpiredAt: 200, Type: types.Any}},
+			result.MatchedPolicies()["user:any"])
+		assert.Equal(GinkgoT(), []types.MatchedPolicy{{ID: 2, ExpiredAt: 200, Type: types.Doc}},
+			result.MatchedPolicies()["user:eq"])
+	})
+
+	It("search policies", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		req.Limit = 1
+		req.Subjects = []types.Subject{{Type: "user", ID: "eq"}}
+		policies, err := e.SearchPolicies(ctx, req, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), map[string][]types.MatchedPolicy{
+			"user:eq": {{ID: 2, ExpiredAt: 200, Type: types.Doc}},
+		}, policies)
+
+		policies, err = e.SearchPolicies(ctx, newTestSearchRequest(map[string]interface{}{"id": "1"}), nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Len(GinkgoT(), policies, 3)
+	})
+
+	It("search by templates", func() {
+		p := newTestPolicy(10, "user", "template", types.Doc, expression.ExprCell{
+			OP: operator.Eq, Field: "host.id", Value: "1",
+		})
+		p.TemplateID = 1
+		_ = e.BulkAdd([]*types.Policy{p})
+
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		req.TemplateIDs = []int64{1, 2}
+		result, _ := e.Search(ctx, req, nil)
+		assert.Equal(GinkgoT(), []string{"user:template"}, subjectUIDs(result.GetSubjects(set.NewStringSet())))
+
+		req.TemplateIDs = nil
+		req.ExcludeTemplates = true
+		result, _ = e.Search(ctx, req, nil)
+		assert.Equal(GinkgoT(),
+			[]string{"user:any", "user:eq", "group:in"},
+			subjectUIDs(result.GetSubjects(set.NewStringSet())),
+		)
+	})
+
+	It("search in candidate subjects", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		req.Subjects = []types.Subject{{Type: "user", ID: "eq"}, {Type: "user", ID: "other"}, {Type: "group", ID: "in"}}
+		req.Limit = 1
+		result, _ := e.Search(ctx, req, nil)
+		assert.Equal(GinkgoT(), []string{"user:eq"}, subjectUIDs(result.GetSubjects(set.NewStringSet())))
+
+		count, _ := e.Count(ctx, req, nil, nil)
+		assert.Equal(GinkgoT(), uint64(2), count)
+	})
+
+	It("search subject type and expired", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		req.SubjectType = "group"
+		result, _ := e.Search(ctx, req, nil)
+		assert.Equal(GinkgoT(), []string{"group:in"}, subjectUIDs(result.GetSubjects(set.NewStringSet())))
+
+		req = newTestSearchRequest(map[string]interface{}{"id": "1"})
+		req.NowTimestamp = 300
+		result, _ = e.Search(ctx, req, nil)
+		assert.Empty(GinkgoT(), result.GetSubjects(set.NewStringSet()))
+	})
+
+	It("upsert and delete", func() {
+		// change the action
+		p := newTestPolicy(2, "user", "eq", types.Doc, expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"})
+		p.Actions = []types.Action{{ID: "edit_host"}}
+		_ = e.BulkAdd([]*types.Policy{p})
+		assert.Equal(GinkgoT(), uint64(5), e.Size("bk_cmdb", "view_host"))
+		assert.Equal(GinkgoT(), uint64(1), e.Size("bk_cmdb", "edit_host"))
+
+		_ = e.BulkDelete([]int64{1, 2}, nil)
+		assert.Equal(GinkgoT(), uint64(4), e.Size("bk_cmdb", "view_host"))
+		assert.Equal(GinkgoT(), uint64(0), e.Size("bk_cmdb", "edit_host"))
+
+		_ = e.BulkDeleteBySubjects(101, []types.Subject{{Type: "group", ID: "in"}}, nil)
+		assert.Equal(GinkgoT(), uint64(3), e.Size("bk_cmdb", "view_host"))
+
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		result, _ := e.Search(ctx, req, nil)
+		assert.Empty(GinkgoT(), result.GetSubjects(set.NewStringSet()))
+	})
+
+	It("list actions", func() {
+		p := newTestPolicy(2, "user", "eq", types.Doc, expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"})
+		p.Actions = []types.Action{{ID: "edit_host"}}
+		_ = e.BulkAdd([]*types.Policy{p})
+
+		actions, err := e.ListActionsByIDs([]int64{1, 100})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "view_host"}}, actions)
+
+		actions, err = e.ListActionsByIDs([]int64{100})
+		assert.NoError(GinkgoT(), err)
+		assert.Empty(GinkgoT(), actions)
+
+		actions, err = e.ListActionsBySubjects(101, []types.Subject{{Type: "user", ID: "eq"}})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "edit_host"}}, actions)
+
+		actions, err = e.ListActionsBySubjects(100, []types.Subject{{Type: "user", ID: "eq"}})
+		assert.NoError(GinkgoT(), err)
+		assert.Empty(GinkgoT(), actions)
+	})
+
+	It("list actions by resource", func() {
+		p := newTestPolicy(10, "user", "biz", types.Doc, expression.ExprCell{OP: operator.Eq, Field: "biz.id", Value: "1"})
+		p.Actions = []types.Action{{ID: "view_biz"}}
+		_ = e.BulkAdd([]*types.Policy{p})
+
+		host := types.Resource{{System: "bk_cmdb", Type: "host", ID: "1"}}
+		actions, err := e.ListActionsByResource("bk_cmdb", host)
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "view_host"}}, actions)
+
+		biz := types.Resource{{System: "bk_cmdb", Type: "biz", ID: "1"}}
+		actions, err = e.ListActionsByResource("bk_cmdb", biz)
+		assert.NoError(GinkgoT(), err)
+		// the any policy of view_host
+		assert.ElementsMatch(GinkgoT(), []types.SystemAction{
+			{System: "bk_cmdb", Action: "view_host"}, {System: "bk_cmdb", Action: "view_biz"},
+		}, actions)
+
+		actions, err = e.ListActionsByResource("bk_job", host)
+		assert.NoError(GinkgoT(), err)
+		assert.Empty(GinkgoT(), actions)
+	})
+
+	It("purge expired", func() {
+		p := newTestPolicy(10, "user", "expired", types.Doc, expression.ExprCell{
+			OP: operator.Eq, Field: "host.id", Value: "1",
+		})
+		p.ExpiredAt = 50
+		_ = e.BulkAdd([]*types.Policy{p})
+		total := e.Total()
+
+		count, err := e.PurgeExpired(100, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), uint64(1), count)
+		assert.Equal(GinkgoT(), total-1, e.Total())
+
+		count, err = e.PurgeExpired(100, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Zero(GinkgoT(), count)
+	})
+
+	It("search expired_at", func() {
+		p := newTestPolicy(10, "user", "eq", types.Doc, expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"})
+		p.ExpiredAt = 300
+		_ = e.BulkAdd([]*types.Policy{p})
+
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		subjects, err := e.SearchExpiredAt(ctx, req, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []string{"user:any", "group:in", "user:eq"}, expirySubjectUIDs(subjects))
+		assert.Equal(GinkgoT(), int64(300), subjects[2].ExpiredAt)
+	})
+
+	It("page search", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1", "_bk_iam_path_": "/biz,1/set,3/"})
+		page, _ := e.PageSearch(ctx, req, 2, nil)
+		assert.Equal(GinkgoT(), []string{"group:in", "user:any"}, subjectUIDs(page.Subjects))
+		assert.True(GinkgoT(), page.HasMore)
+
+		req.SearchCursor = types.NewSearchCursor(page.LastSubjectUID())
+		page, _ = e.PageSearch(ctx, req, 5, nil)
+		assert.Equal(GinkgoT(), []string{"user:contains", "user:eq", "user:path"}, subjectUIDs(page.Subjects))
+		assert.False(GinkgoT(), page.HasMore)
+	})
+
+	It("count", func() {
+		req := newTestSearchRequest(map[string]interface{}{"id": "1"})
+		count, _ := e.Count(ctx, req, []string{"user:any"}, nil)
+		assert.Equal(GinkgoT(), uint64(2), count)
+	})
+
+	It("explain", func() {
+		policies, _ := e.Explain(ctx, &types.ExplainRequest{
+			System: "bk_cmdb",
+			Action: types.Action{ID: "view_host"},
+			Resource: []types.ResourceNode{
+				{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+			},
+			SubjectType:  "group",
+			SubjectID:    "in",
+			NowTimestamp: 100,
+		}, nil)
+		assert.Len(GinkgoT(), policies, 1)
+		assert.Equal(GinkgoT(), int64(3), policies[0].ID)
+		assert.Equal(GinkgoT(), types.Doc, policies[0].Type)
+	})
+
+	It("reverse search", func() {
+		result, _ := e.ReverseSearch(ctx, &types.ReverseSearchRequest{
+			System:       "bk_cmdb",
+			Action:       types.Action{ID: "view_host"},
+			SubjectType:  "group",
+			SubjectID:    "in",
+			NowTimestamp: 100,
+		}, nil)
+		assert.False(GinkgoT(), result.Any)
+		assert.Len(GinkgoT(), result.Instances, 2)
+	})
+
+	It("snapshot", func() {
+		data := e.TakeSnapshot()
+		assert.Len(GinkgoT(), data, 1)
+		assert.Len(GinkgoT(), data[0].DocPolicies, 6)
+
+		e2, _ := NewMemoryEngine()
+		assert.NoError(GinkgoT(), e2.LoadSnapshot(data))
+		assert.Equal(GinkgoT(), uint64(6), e2.Size("bk_cmdb", "view_host"))
+
+		// not from memory engine
+		assert.ErrorIs(GinkgoT(), e2.LoadSnapshot([]types.SnapRecord{{System: "bk_cmdb"}}), ErrSnapshotNotFromMemoryEngine)
+
+		// empty engine
+		e3, _ := NewMemoryEngine()
+		assert.True(GinkgoT(), isSnapshotFromMemoryEngine(e3.TakeSnapshot()))
+	})
+})
+
+var _ = Describe("MemoryEngine AND doc", func() {
+	ctx := context.Background()
+
+	andExpr := func(content ...expression.ExprCell) expression.ExprCell {
+		return expression.ExprCell{OP: operator.AND, Content: content}
+	}
+
+	policies := []*types.Policy{
+		newTestPolicy(1, "user", "id_path", types.Doc, andExpr(
+			expression.ExprCell{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"}},
+			expression.ExprCell{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/"},
+		)),
+		newTestPolicy(2, "user", "id_os", types.Doc, andExpr(
+			expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "3"},
+			expression.ExprCell{OP: operator.Eq, Field: "host.os", Value: "linux"},
+		)),
+		newTestPolicy(3, "user", "path_os", types.Doc, andExpr(
+			expression.ExprCell{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/set,*/"},
+			expression.ExprCell{OP: operator.In, Field: "host.os", Value: []interface{}{"linux", "windows"}},
+		)),
+		newTestPolicy(4, "user", "contains_id", types.Doc, andExpr(
+			expression.ExprCell{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,2/"},
+			expression.ExprCell{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "3"}},
+		)),
+		newTestPolicy(5, "user", "path_contains", types.Doc, andExpr(
+			expression.ExprCell{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,2/"},
+			expression.ExprCell{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,3/"},
+		)),
+		newTestPolicy(6, "user", "or", types.Doc, expression.ExprCell{
+			OP: operator.OR,
+			Content: []expression.ExprCell{
+				{OP: operator.In, Field: "host.id", Value: []interface{}{"4"}},
+				{OP: operator.In, Field: "host.os", Value: []interface{}{"mac"}},
+			},
+		}),
+	}
+
+	It("equivalent to eval", func() {
+		e, _ := NewMemoryEngine()
+		assert.NoError(GinkgoT(), e.BulkAdd(policies))
+
+		for _, id := range []string{"1", "2", "3", "4"} {
+			for _, path := range []string{"/biz,1/set,2/", "/biz,1/set,3/", "/biz,2/set,3/", "/biz,1/"} {
+				for _, os := range []string{"linux", "mac", ""} {
+					attribute := map[string]interface{}{"id": id, "_bk_iam_path_": path}
+					if os != "" {
+						attribute["os"] = os
+					}
+
+					obj := expression.NewObjectSet()
+					obj.Set("host", attribute)
+					want := []string{}
+					for _, p := range policies {
+						if p.Expression.Eval(obj) {
+							want = append(want, p.Subject.UID)
+						}
+					}
+
+					result, err := e.Search(ctx, newTestSearchRequest(attribute), nil)
+					assert.NoError(GinkgoT(), err)
+					assert.Equal(GinkgoT(), want, subjectUIDs(result.GetSubjects(set.NewStringSet())), attribute)
+				}
+			}
+		}
+	})
+
+	It("reverse search", func() {
+		e, _ := NewMemoryEngine()
+		_ = e.BulkAdd(policies[:1])
+
+		result, _ := e.ReverseSearch(ctx, &types.ReverseSearchRequest{
+			System:       "bk_cmdb",
+			Action:       types.Action{ID: "view_host"},
+			SubjectType:  "user",
+			SubjectID:    "id_path",
+			NowTimestamp: 100,
+		}, nil)
+		assert.Empty(GinkgoT(), result.Instances)
+		assert.Empty(GinkgoT(), result.Paths)
+		assert.Len(GinkgoT(), result.Expressions, 1)
+
+		obj := expression.NewObjectSet()
+		obj.Set("host", map[string]interface{}{"id": "2", "_bk_iam_path_": "/biz,1/set,2/"})
+		assert.True(GinkgoT(), result.Expressions[0].Eval(obj))
+		obj.Set("host", map[string]interface{}{"id": "3", "_bk_iam_path_": "/biz,1/set,2/"})
+		assert.False(GinkgoT(), result.Expressions[0].Eval(obj))
+	})
+})
+
+var _ = Describe("MemoryEngine number compare doc", func() {
+	ctx := context.Background()
+
+	policies := []*types.Policy{
+		newTestPolicy(1, "user", "gt", types.Doc, expression.ExprCell{
+			OP: operator.Gt, Field: "host.cpu_cores", Value: float64(8),
+		}),
+		newTestPolicy(2, "user", "gte", types.Doc, expression.ExprCell{
+			OP: operator.Gte, Field: "host.cpu_cores", Value: float64(8),
+		}),
+		newTestPolicy(3, "user", "lt", types.Doc, expression.ExprCell{
+			OP: operator.Lt, Field: "host.cpu_cores", Value: float64(4),
+		}),
+		newTestPolicy(4, "user", "lte", types.Doc, expression.ExprCell{
+			OP: operator.Lte, Field: "host.cpu_cores", Value: 4.5,
+		}),
+		newTestPolicy(5, "user", "mem", types.Doc, expression.ExprCell{
+			OP: operator.Gte, Field: "host.mem", Value: float64(8),
+		}),
+	}
+
+	It("equivalent to eval", func() {
+		e, _ := NewMemoryEngine()
+		assert.NoError(GinkgoT(), e.BulkAdd(policies))
+
+		for _, cores := range []interface{}{float64(2), float64(4), 4.5, float64(8), float64(16), "16", []interface{}{1, 9}} {
+			attribute := map[string]interface{}{"id": "1", "cpu_cores": cores}
+
+			obj := expression.NewObjectSet()
+			obj.Set("host", attribute)
+			want := []string{}
+			for _, p := range policies {
+				if p.Expression.Eval(obj) {
+					want = append(want, p.Subject.UID)
+				}
+			}
+
+			result, err := e.Search(ctx, newTestSearchRequest(attribute), nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), want, subjectUIDs(result.GetSubjects(set.NewStringSet())), attribute)
+		}
+	})
+
+	It("delete", func() {
+		e, _ := NewMemoryEngine()
+		_ = e.BulkAdd(policies)
+		_ = e.BulkDelete([]int64{1, 2}, nil)
+
+		result, _ := e.Search(ctx, newTestSearchRequest(map[string]interface{}{"cpu_cores": float64(16)}), nil)
+		assert.Empty(GinkgoT(), result.GetSubjects(set.NewStringSet()))
+	})
+
+	It("reverse search", func() {
+		e, _ := NewMemoryEngine()
+		_ = e.BulkAdd(policies)
+
+		result, _ := e.ReverseSearch(ctx, &types.ReverseSearchRequest{
+			System:       "bk_cmdb",
+			Action:       types.Action{ID: "view_host"},
+			SubjectType:  "user",
+			SubjectID:    "gte",
+			NowTimestamp: 100,
+		}, nil)
+		assert.Empty(GinkgoT(), result.Attributes)
+		assert.Equal(GinkgoT(), []expression.ExprCell{
+			{OP: operator.Gte, Field: "host.cpu_cores", Value: float64(8)},
+		}, result.Expressions)
+	})
+})
+
+var _ = Describe("MemoryEngine cross system doc", func() {
+	ctx := context.Background()
+
+	newCrossSystemRequest := func(hostSystem, scriptID, hostID string) *types.SearchRequest {
+		return &types.SearchRequest{
+			System: "bk_job",
+			Action: types.Action{ID: "execute_script"},
+			Resource: []types.ResourceNode{
+				{System: "bk_job", Type: "script", ID: scriptID, Attribute: map[string]interface{}{"id": scriptID}},
+				{System: hostSystem, Type: "host", ID: hostID, Attribute: map[string]interface{}{"id": hostID}},
+			},
+			SubjectType:  types.SubjectTypeAll,
+			NowTimestamp: 100,
+		}
+	}
+
+	var e types.Engine
+	BeforeEach(func() {
+		p := newTestPolicy(1, "user", "admin", types.Doc, expression.ExprCell{
+			OP: operator.AND,
+			Content: []expression.ExprCell{
+				{OP: operator.Eq, Field: "script.id", Value: "1"},
+				{OP: operator.In, Field: "host.id", Value: []interface{}{"2", "3"}},
+			},
+		})
+		p.System = "bk_job"
+		p.Actions = []types.Action{{ID: "execute_script"}}
+		p.ResourceTypeSystems = map[string]string{"host": "bk_cmdb"}
+
+		e, _ = NewMemoryEngine()
+		_ = e.BulkAdd([]*types.Policy{p})
+	})
+
+	It("search", func() {
+		result, _ := e.Search(ctx, newCrossSystemRequest("bk_cmdb", "1", "2"), nil)
+		assert.Equal(GinkgoT(), []string{"user:admin"}, subjectUIDs(result.GetSubjects(set.NewStringSet())))
+
+		result, _ = e.Search(ctx, newCrossSystemRequest("bk_cmdb", "1", "4"), nil)
+		assert.Empty(GinkgoT(), result.GetSubjects(set.NewStringSet()))
+
+		// the host not in the system of the resource type
+		result, _ = e.Search(ctx, newCrossSystemRequest("bk_job", "1", "2"), nil)
+		assert.Empty(GinkgoT(), result.GetSubjects(set.NewStringSet()))
+	})
+
+	It("reverse search", func() {
+		result, _ := e.ReverseSearch(ctx, &types.ReverseSearchRequest{
+			System:       "bk_job",
+			Action:       types.Action{ID: "execute_script"},
+			SubjectType:  "user",
+			SubjectID:    "admin",
+			NowTimestamp: 100,
+		}, nil)
+		assert.Len(GinkgoT(), result.Expressions, 1)
+		assert.Len(GinkgoT(), result.Expressions[0].Content, 2)
+	})
+
+	It("snapshot schema version", func() {
+		data := e.TakeSnapshot()
+		assert.Equal(GinkgoT(), docSchemaVersion, data[0].DocSchemaVersion)
+
+		e2, _ := NewMemoryEngine()
+		assert.NoError(GinkgoT(), e2.LoadSnapshot(data))
+
+		data[0].DocSchemaVersion = 0
+		assert.ErrorIs(GinkgoT(), e2.LoadSnapshot(data), ErrDocSchemaVersionOutdated)
+	})
+})
@@ -13,16 +13,34 @@ package doc
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
 	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
 
 	"engine/pkg/types"
 	"engine/pkg/util"
 )
 
+const (
+	// andFieldsKey the fields of the AND doc
+	andFieldsKey = "and_fields"
+	// andFieldsCountKey the count of the and_fields, used by the terms_set query
+	andFieldsCountKey = "and_fields_count"
+)
+
+// docSchemaVersion the version of the doc structure, the index should be rebuilt if the doc schema changed
+// 1. the resource object under the policy system
+// 2. the resource object under the system of the resource type, and_fields with the system prefix
+const docSchemaVersion = 2
+
+// ErrDocSchemaVersionOutdated the docs are not in the current schema version, should do full sync to rebuild
+var ErrDocSchemaVersionOutdated = errors.New("doc schema version outdated")
+
 func splitBKIAMPath(value string) (paths []string) {
 	// value = /biz,1/set,2/module,3/host,4/
 	if value == "" {
@@ -108,8 +126,6 @@ func splitBKIAMPathIntoNodes(value string) (nodes []string) {
 
 // makeDoc ...
 func makeDoc(docType types.ExpressionType, policy *types.Policy) (map[string]interface{}, error) {
-	object := types.H{}
-
 	system := policy.System
 	// action := policy.Action.ID
 
@@ -118,37 +134,11 @@ func makeDoc(docType types.ExpressionType, policy *types.Policy) (map[string]int
 		actions = append(actions, types.H{"id": a.ID})
 	}
 
-	// if docType == "any", do nothing
-	// else, build the object for eval
-	if docType == "doc" {
-		if policy.Expression.OP == operator.Eq {
-			object[policy.Expression.Field] = []interface{}{policy.Expression.Value}
-		} else if policy.Expression.OP == operator.In {
-			object[policy.Expression.Field] = policy.Expression.Value
-		} else if policy.Expression.OP == operator.StartsWith {
-			if util.IsValueTypeArray(policy.Expression.Value) {
-				object[policy.Expression.Field] = policy.Expression.Value
-			} else {
-				object[policy.Expression.Field] = []interface{}{policy.Expression.Value}
-			}
-		} else if policy.Expression.OP == operator.StringContains {
-			// a._bk_iam_path_ string_contains "/project,1/"
-			// trans to:
-			// a._bk_iam_path_contains_ = ["/project,1/"]
-			field := types.ConvertBKIAMPathSuffixToBKIAMPathContainsSuffix(policy.Expression.Field)
-			object[field] = []interface{}{policy.Expression.Value}
-		} else if policy.Expression.OP == operator.OR {
-			// NOTE: not a simple expression, but the OR expression with same object different fields
-			// TODO: 考虑 写得更通用些, or A.a = 1 or A.a =2 or A.c = 3 能够正常合并
-			for _, c := range policy.Expression.Content {
-				object[c.Field] = c.Value
-			}
-		} else {
-			return nil, errors.New("not a simple expression")
-		}
+	resource, err := makeDocResource(docType, policy)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: 这里没有包含 跨系统资源依赖的情况, resourceType chain来自于不同系统
 	doc := types.H{
 		"type":    docType,
 		"id":      policy.ID,
@@ -170,14 +160,340 @@ func makeDoc(docType types.ExpressionType, policy *types.Policy) (map[string]int
 		"template_id": policy.TemplateID,
 
 		// NOTE: 这里的system目的是为了避免不同系统的同一个resourceType名字一样类型不一样导致索引失败
-		"resource": types.H{
-			system: object,
-		},
+		"resource": resource,
 
 		"expired_at": policy.ExpiredAt,
 		"updated_at": policy.UpdatedAt,
+
+		"schema_version": docSchemaVersion,
+	}
+
+	// NOTE: AND的doc需要记录所有的field, 检索时要求所有field都命中
+	if isANDDoc(docType, policy) {
+		fields := docFieldPaths(resource)
+		doc[andFieldsKey] = fields
+		doc[andFieldsCountKey] = len(fields)
 	}
 	return doc, nil
 }
 
+// makeDocResource build the resource of the doc, the object is grouped by the system of the resource type
+// NOTE: 跨系统资源依赖时, 资源类型的field放在其所属系统下, 与检索时resource node的system一致
+func makeDocResource(docType types.ExpressionType, policy *types.Policy) (types.H, error) {
+	object, err := makeDocObject(docType, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := types.H{
+		policy.System: types.H{},
+	}
+	for field, value := range object {
+		system := policy.ResourceTypeSystem(strings.SplitN(field, ".", 2)[0])
+
+		systemObject, ok := resource[system].(types.H)
+		if !ok {
+			systemObject = types.H{}
+			resource[system] = systemObject
+		}
+		systemObject[field] = value
+	}
+	return resource, nil
+}
+
+// docFieldPath the path of the field under the doc resource: `system.type.attribute`
+func docFieldPath(system, field string) string {
+	return system + "." + field
+}
+
+// splitDocFieldPath split the path into the system and the field `type.attribute`
+func splitDocFieldPath(path string) (system, field string) {
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) != 2 {
+		return "", path
+	}
+	return parts[0], parts[1]
+}
+
+// docFieldPaths return the sorted field paths of the doc resource
+func docFieldPaths(resource types.H) []string {
+	paths := make([]string, 0, 2)
+	for system, object := range resource {
+		for field := range object.(types.H) {
+			paths = append(paths, docFieldPath(system, field))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// makeDocObject build the object of the doc, the key is `type.attribute`
+func makeDocObject(docType types.ExpressionType, policy *types.Policy) (types.H, error) {
+	object := types.H{}
+
+	// if docType == "any", do nothing
+	// else, build the object for eval
+	if docType == "doc" {
+		switch policy.Expression.OP {
+		case operator.OR:
+			// NOTE: not a simple expression, but the merged OR expression,
+			//       the fields / operators / objects can be different, any of the fields matched
+			for i := range policy.Expression.Content {
+				err := fillDocObjectField(object, &policy.Expression.Content[i])
+				if err != nil {
+					return nil, err
+				}
+			}
+		case operator.AND:
+			// NOTE: the AND expression with same object different fields, all the fields should be matched
+			for i := range policy.Expression.Content {
+				err := fillDocObjectField(object, &policy.Expression.Content[i])
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			err := fillDocObjectField(object, &policy.Expression)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return object, nil
+}
+
+// fillDocObjectField set the field of the simple expression into the doc object
+// NOTE: 多个表达式对应doc的同一个field时, 合并所有的值
+func fillDocObjectField(object types.H, expr *expression.ExprCell) error {
+	if expr.OP == operator.Eq || expr.OP == operator.In || expr.OP == operator.StartsWith {
+		appendDocObjectValues(object, expr.Field, toValueList(expr.Value))
+	} else if expr.OP == operator.StringContains {
+		// a._bk_iam_path_ string_contains "/project,1/"
+		// trans to:
+		// a._bk_iam_path_contains_ = ["/project,1/"]
+		field := types.ConvertBKIAMPathSuffixToBKIAMPathContainsSuffix(expr.Field)
+		appendDocObjectValues(object, field, toValueList(expr.Value))
+	} else if suffix, ok := numberCompareFieldSuffix(expr.OP); ok {
+		// a.cpu_cores gte 8
+		// trans to:
+		// a.cpu_cores__gte = 8
+		value, ok := util.ToFloat64(expr.Value)
+		if !ok {
+			return errors.New("the value of number compare expression is not a number")
+		}
+		object[expr.Field+suffix] = value
+	} else {
+		return errors.New("not a simple expression")
+	}
+	return nil
+}
+
+func appendDocObjectValues(object types.H, field string, values []interface{}) {
+	if existed, ok := object[field].([]interface{}); ok {
+		values = append(existed, values...)
+	}
+	object[field] = values
+}
+
+// numberCompareField the number compare operator stored as the bound field of the doc,
+// e.g. `host.cpu_cores gte 8` => `host.cpu_cores__gte: 8`
+// the request value v matched if `v gte 8`, it's the inverse range query of the doc field: `host.cpu_cores__gte lte v`
+type numberCompareField struct {
+	OP      operator.OP
+	Suffix  string
+	RangeOP string
+}
+
+var numberCompareFields = []numberCompareField{
+	{OP: operator.Gt, Suffix: "__gt", RangeOP: "lt"},
+	{OP: operator.Gte, Suffix: "__gte", RangeOP: "lte"},
+	{OP: operator.Lt, Suffix: "__lt", RangeOP: "gt"},
+	{OP: operator.Lte, Suffix: "__lte", RangeOP: "gte"},
+}
+
+func numberCompareFieldSuffix(op operator.OP) (string, bool) {
+	for _, f := range numberCompareFields {
+		if f.OP == op {
+			return f.Suffix, true
+		}
+	}
+	return "", false
+}
+
+// parseNumberCompareField return the operator and the origin field of the doc bound field
+func parseNumberCompareField(field string) (op operator.OP, originField string, ok bool) {
+	for _, f := range numberCompareFields {
+		if strings.HasSuffix(field, f.Suffix) {
+			return f.OP, strings.TrimSuffix(field, f.Suffix), true
+		}
+	}
+	return "", "", false
+}
+
+// isANDDoc return true if the doc policy is the AND expression, the doc matched only if all the fields matched
+func isANDDoc(docType types.ExpressionType, policy *types.Policy) bool {
+	return docType == types.Doc && policy.Expression.OP == operator.AND
+}
+
+// docObjectFields return the sorted fields of the doc object
+func docObjectFields(object types.H) []string {
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func toValueList(value interface{}) []interface{} {
+	if util.IsValueTypeArray(value) {
+		values, _ := util.ToSlice(value)
+		return values
+	}
+	return []interface{}{value}
+}
+
+// parseReverseSearchDocs will parse the resource of any/doc docs into resource instances/paths/attributes
+func parseReverseSearchDocs(docs []types.H, result *types.ReverseSearchResult) {
+	uniqKeys := set.NewStringSet()
+	attributes := make(map[string]*types.ResourceAttribute)
+
+	for _, doc := range docs {
+		if doc["type"] == string(types.Any) {
+			result.Any = true
+			continue
+		}
+
+		resource, ok := doc["resource"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// NOTE: AND的doc无法展开为资源实例/路径/属性的并集, 返回原始表达式
+		//       跨系统资源依赖时, field分布在多个系统下, 需要合并为一个表达式
+		if _, isAND := doc[andFieldsKey]; isAND {
+			object := make(map[string]interface{}, 2)
+			for _, systemObject := range resource {
+				fields, _ := systemObject.(map[string]interface{})
+				for field, value := range fields {
+					object[field] = value
+				}
+			}
+			result.Expressions = append(result.Expressions, andDocObjectToExpression(object))
+			continue
+		}
+
+		for system, object := range resource {
+			fields, ok := object.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			// NOTE: makeDoc 生成的field为 `type.attribute`
+			for field, value := range fields {
+				// 数字比较无法展开, 返回原始表达式
+				if op, originField, ok := parseNumberCompareField(field); ok {
+					result.Expressions = append(result.Expressions, expression.ExprCell{
+						OP:    op,
+						Field: originField,
+						Value: value,
+					})
+					continue
+				}
+
+				dotIdx := strings.IndexByte(field, '.')
+				if dotIdx == -1 {
+					continue
+				}
+				_type, attribute := field[:dotIdx], field[dotIdx+1:]
+
+				for _, v := range toValueList(value) {
+					key := fmt.Sprintf("%s:%s:%s:%v", system, _type, attribute, v)
+					if uniqKeys.Has(key) {
+						continue
+					}
+					uniqKeys.Add(key)
+
+					switch attribute {
+					case "id":
+						result.Instances = append(result.Instances, types.ResourceInstance{
+							System: system,
+							Type:   _type,
+							ID:     v,
+						})
+					case types.BkIAMPathKey, types.BkIAMPathContainsKey:
+						op := operator.StartsWith
+						if attribute == types.BkIAMPathContainsKey {
+							op = operator.StringContains
+						}
+
+						path, _ := v.(string)
+						result.Paths = append(result.Paths, types.ResourcePath{
+							System:   system,
+							Type:     _type,
+							Operator: string(op),
+							Path:     path,
+						})
+					default:
+						attrKey := fmt.Sprintf("%s:%s:%s", system, _type, attribute)
+						attr, ok := attributes[attrKey]
+						if !ok {
+							attr = &types.ResourceAttribute{
+								System:    system,
+								Type:      _type,
+								Attribute: attribute,
+								Values:    make([]interface{}, 0, 1),
+							}
+							attributes[attrKey] = attr
+						}
+						attr.Values = append(attr.Values, v)
+					}
+				}
+			}
+		}
+	}
+
+	for _, attr := range attributes {
+		result.Attributes = append(result.Attributes, *attr)
+	}
+}
+
+// andDocObjectToExpression convert the object of the AND doc back into the AND expression
+func andDocObjectToExpression(object map[string]interface{}) expression.ExprCell {
+	fields := docObjectFields(object)
+
+	content := make([]expression.ExprCell, 0, len(fields))
+	for _, field := range fields {
+		values := toValueList(object[field])
+
+		var op operator.OP
+		switch {
+		case strings.HasSuffix(field, types.BkIAMPathContainsSuffix):
+			op = operator.StringContains
+			field = strings.ReplaceAll(field, types.BkIAMPathContainsSuffix, types.BkIAMPathSuffix)
+		case strings.HasSuffix(field, types.BkIAMPathSuffix):
+			op = operator.StartsWith
+		default:
+			content = append(content, expression.ExprCell{OP: operator.In, Field: field, Value: values})
+			continue
+		}
+
+		// _bk_iam_path_ 的多个值是OR关系
+		cells := make([]expression.ExprCell, 0, len(values))
+		for _, v := range values {
+			cells = append(cells, expression.ExprCell{OP: op, Field: field, Value: v})
+		}
+		if len(cells) == 1 {
+			content = append(content, cells[0])
+		} else {
+			content = append(content, expression.ExprCell{OP: operator.OR, Content: cells})
+		}
+	}
+
+	return expression.ExprCell{
+		OP:      operator.AND,
+		Content: content,
+	}
+}
+
 type esSearchQueryFunc func(req *types.SearchRequest) types.H
@@ -12,10 +12,15 @@
 package doc
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
 	. "github.com/onsi/ginkgo"
 	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
 )
 
 var _ = Describe("Doc", func() {
@@ -49,6 +54,487 @@ var _ = Describe("Doc", func() {
 			assert.Contains(GinkgoT(), paths, "/biz,1/set,2/module,*/")
 		})
 	})
+
+	Describe("parseReverseSearchDocs", func() {
+		It("any", func() {
+			result := types.NewReverseSearchResult()
+			parseReverseSearchDocs([]types.H{
+				{"type": "any", "resource": map[string]interface{}{"bk_cmdb": map[string]interface{}{}}},
+			}, result)
+			assert.True(GinkgoT(), result.Any)
+			assert.Empty(GinkgoT(), result.Instances)
+		})
+
+		It("doc", func() {
+			result := types.NewReverseSearchResult()
+			parseReverseSearchDocs([]types.H{
+				{
+					"type": "doc",
+					"resource": map[string]interface{}{
+						"bk_cmdb": map[string]interface{}{
+							"host.id":                     []interface{}{"1", "2"},
+							"host._bk_iam_path_":          []interface{}{"/biz,1/"},
+							"host._bk_iam_path_contains_": []interface{}{"/set,2/"},
+							"host.owner":                  []interface{}{"admin"},
+						},
+					},
+				},
+				{
+					"type": "doc",
+					"resource": map[string]interface{}{
+						"bk_cmdb": map[string]interface{}{
+							"host.id": []interface{}{"2"},
+						},
+					},
+				},
+			}, result)
+
+			assert.False(GinkgoT(), result.Any)
+			assert.Len(GinkgoT(), result.Instances, 2)
+			assert.Contains(GinkgoT(), result.Instances, types.ResourceInstance{System: "bk_cmdb", Type: "host", ID: "1"})
+			assert.Contains(GinkgoT(), result.Paths, types.ResourcePath{
+				System: "bk_cmdb", Type: "host", Operator: "starts_with", Path: "/biz,1/",
+			})
+			assert.Contains(GinkgoT(), result.Paths, types.ResourcePath{
+				System: "bk_cmdb", Type: "host", Operator: "string_contains", Path: "/set,2/",
+			})
+			assert.Equal(GinkgoT(), []types.ResourceAttribute{{
+				System: "bk_cmdb", Type: "host", Attribute: "owner", Values: []interface{}{"admin"},
+			}}, result.Attributes)
+		})
+	})
+
+	Describe("genPageQuery", func() {
+		It("first page", func() {
+			query := genPageQuery(&types.SearchRequest{
+				System:      "bk_cmdb",
+				Action:      types.Action{ID: "view_host"},
+				SubjectType: types.SubjectTypeAll,
+			})
+			should := query["query"].(types.H)["bool"].(types.H)["should"].([]interface{})
+			// no resource attribute, only the any query
+			assert.Len(GinkgoT(), should, 1)
+			assert.NotContains(GinkgoT(), query, "search_after")
+		})
+
+		It("with cursor", func() {
+			query := genPageQuery(&types.SearchRequest{
+				System: "bk_cmdb",
+				Action: types.Action{ID: "view_host"},
+				Resource: []types.ResourceNode{
+					{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+				},
+				SubjectType:  types.SubjectTypeAll,
+				SearchCursor: types.NewSearchCursor("user:admin"),
+			})
+			should := query["query"].(types.H)["bool"].(types.H)["should"].([]interface{})
+			assert.Len(GinkgoT(), should, 2)
+			assert.Equal(GinkgoT(), "user:admin", query["search_after"].([]interface{})[0])
+			assert.NotContains(GinkgoT(), query, "pit")
+		})
+
+		It("with point in time", func() {
+			query := genPageQuery(&types.SearchRequest{
+				System:       "bk_cmdb",
+				Action:       types.Action{ID: "view_host"},
+				SubjectType:  types.SubjectTypeAll,
+				SearchCursor: &types.SearchCursor{PitID: "pit"},
+			})
+			assert.NotContains(GinkgoT(), query, "search_after")
+			assert.Equal(GinkgoT(), types.H{"id": "pit", "keep_alive": pointInTimeKeepAlive}, query["pit"])
+		})
+	})
+
+	Describe("genCountQuery", func() {
+		req := &types.SearchRequest{
+			System:      "bk_cmdb",
+			Action:      types.Action{ID: "view_host"},
+			SubjectType: types.SubjectTypeAll,
+		}
+
+		It("no excluded", func() {
+			query := genCountQuery(req, nil)
+			boolQuery := query["query"].(types.H)["bool"].(types.H)
+			assert.NotContains(GinkgoT(), boolQuery, "must_not")
+			assert.Contains(GinkgoT(), query["aggs"], "subject_count")
+		})
+
+		It("excluded", func() {
+			query := genCountQuery(req, []string{"user:admin"})
+			boolQuery := query["query"].(types.H)["bool"].(types.H)
+			assert.Equal(GinkgoT(), []interface{}{
+				types.H{"terms": types.H{"subject.uid": []string{"user:admin"}}},
+			}, boolQuery["must_not"])
+		})
+
+		It("excluded more than the terms size", func() {
+			uids := make([]string, 0, countExcludedTermsSize+1)
+			for i := 0; i < countExcludedTermsSize+1; i++ {
+				uids = append(uids, fmt.Sprintf("user:%d", i))
+			}
+
+			query := genCountQuery(req, uids)
+			mustNot := query["query"].(types.H)["bool"].(types.H)["must_not"].([]interface{})
+			assert.Len(GinkgoT(), mustNot, 2)
+			terms := func(clause interface{}) interface{} {
+				return clause.(types.H)["terms"].(types.H)["subject.uid"]
+			}
+			assert.Len(GinkgoT(), terms(mustNot[0]), countExcludedTermsSize)
+			assert.Equal(GinkgoT(), []string{uids[countExcludedTermsSize]}, terms(mustNot[1]))
+		})
+	})
+
+	Describe("parseCountAggs", func() {
+		It("ok", func() {
+			count, err := parseCountAggs(types.H{
+				"aggregations": map[string]interface{}{
+					"subject_count": map[string]interface{}{"value": float64(3)},
+				},
+			})
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), uint64(3), count)
+		})
+
+		It("no aggregations", func() {
+			_, err := parseCountAggs(types.H{})
+			assert.Error(GinkgoT(), err)
+		})
+
+		It("no value", func() {
+			_, err := parseCountAggs(types.H{
+				"aggregations": map[string]interface{}{"subject_count": map[string]interface{}{}},
+			})
+			assert.Error(GinkgoT(), err)
+		})
+	})
+
+	Describe("parseSystemActionsAggs", func() {
+		It("ok", func() {
+			result := types.H{
+				"aggregations": map[string]interface{}{
+					"systems": map[string]interface{}{
+						"buckets": []interface{}{
+							map[string]interface{}{
+								"key": "bk_cmdb",
+								"actions": map[string]interface{}{
+									"buckets": []interface{}{
+										map[string]interface{}{"key": "view_host", "doc_count": float64(2)},
+										map[string]interface{}{"key": "edit_host", "doc_count": float64(1)},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			assert.Equal(GinkgoT(), []types.SystemAction{
+				{System: "bk_cmdb", Action: "view_host"},
+				{System: "bk_cmdb", Action: "edit_host"},
+			}, parseSystemActionsAggs(result))
+		})
+
+		It("no aggregations", func() {
+			assert.Empty(GinkgoT(), parseSystemActionsAggs(types.H{}))
+		})
+	})
+
+	Describe("genResourceActionsQuery", func() {
+		It("ok", func() {
+			query := genResourceActionsQuery("bk_cmdb", types.Resource{
+				{System: "bk_cmdb", Type: "host", ID: "1"},
+				{System: "bk_job", Type: "script", ID: "2"},
+			})
+
+			assert.Equal(GinkgoT(), types.H{
+				"query": types.H{
+					"bool": types.H{
+						"filter": []interface{}{
+							types.H{"term": types.H{"system": "bk_cmdb"}},
+							types.H{
+								"bool": types.H{
+									"should": []interface{}{
+										types.H{"term": types.H{"type": "any"}},
+										types.H{"exists": types.H{"field": "resource.bk_cmdb.host"}},
+										types.H{"exists": types.H{"field": "resource.bk_job.script"}},
+									},
+									"minimum_should_match": 1,
+								},
+							},
+						},
+					},
+				},
+			}, query)
+		})
+	})
+
+	Describe("genTemplateFilter", func() {
+		It("ok", func() {
+			req := &types.SearchRequest{}
+			assert.Nil(GinkgoT(), genTemplateFilter(req))
+
+			req.TemplateIDs = []int64{1, 2}
+			assert.Equal(GinkgoT(), types.H{"terms": types.H{"template_id": []int64{1, 2}}}, genTemplateFilter(req))
+
+			req = &types.SearchRequest{ExcludeTemplates: true}
+			assert.Equal(GinkgoT(), types.H{"term": types.H{"template_id": 0}}, genTemplateFilter(req))
+		})
+	})
+
+	Describe("genRequestFilters", func() {
+		It("candidate subjects", func() {
+			req := &types.SearchRequest{
+				SubjectType: types.SubjectTypeAll,
+				Subjects:    []types.Subject{{Type: "user", ID: "tom"}, {Type: "user", ID: "admin"}},
+			}
+			assert.Equal(GinkgoT(), []interface{}{
+				types.H{"terms": types.H{"subject.uid": []string{"user:admin", "user:tom"}}},
+			}, genRequestFilters(req))
+
+			req.ExpandGroups = true
+			filters := genRequestFilters(req)
+			assert.Len(GinkgoT(), filters, 1)
+			assert.Contains(GinkgoT(), filters[0].(types.H), "bool")
+		})
+
+		It("no filter", func() {
+			assert.Empty(GinkgoT(), genRequestFilters(&types.SearchRequest{}))
+		})
+	})
+
+	Describe("getMsearchResponses", func() {
+		hits := map[string]interface{}{"hits": map[string]interface{}{"hits": []interface{}{}}}
+
+		It("ok", func() {
+			responses, err := getMsearchResponses(types.H{"responses": []interface{}{hits, hits}}, 2)
+			assert.NoError(GinkgoT(), err)
+			assert.Len(GinkgoT(), responses, 2)
+		})
+
+		It("count mismatch", func() {
+			_, err := getMsearchResponses(types.H{"responses": []interface{}{hits}}, 2)
+			assert.Error(GinkgoT(), err)
+		})
+
+		It("query error", func() {
+			failed := map[string]interface{}{"error": map[string]interface{}{"type": "search_phase_execution_exception"}}
+			_, err := getMsearchResponses(types.H{"responses": []interface{}{hits, failed}}, 2)
+			assert.Error(GinkgoT(), err)
+		})
+	})
+
+	Describe("parseSubjectExpiriesAggs", func() {
+		It("ok", func() {
+			result := types.H{
+				"aggregations": map[string]interface{}{
+					"subjects": map[string]interface{}{
+						"buckets": []interface{}{
+							map[string]interface{}{
+								"key":               "user:admin",
+								"latest_expired_at": map[string]interface{}{"value": float64(100)},
+								"subject": map[string]interface{}{
+									"hits": map[string]interface{}{
+										"hits": []interface{}{
+											map[string]interface{}{
+												"_source": map[string]interface{}{
+													"subject": map[string]interface{}{
+														"type": "user", "id": "admin", "name": "admin", "uid": "user:admin",
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			assert.Equal(GinkgoT(), []types.SubjectExpiry{{
+				Subject:   types.Subject{Type: "user", ID: "admin", Name: "admin", UID: "user:admin"},
+				ExpiredAt: 100,
+			}}, parseSubjectExpiriesAggs(result))
+		})
+
+		It("no aggregations", func() {
+			assert.Empty(GinkgoT(), parseSubjectExpiriesAggs(types.H{}))
+		})
+	})
+
+	Describe("parseSearchHits", func() {
+		It("ok", func() {
+			result := types.H{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{
+						map[string]interface{}{
+							"_source": map[string]interface{}{"id": float64(1)},
+							"sort":    []interface{}{float64(1)},
+						},
+					},
+				},
+			}
+			hits, err := parseSearchHits(result)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), []searchHit{
+				{Source: types.H{"id": float64(1)}, Sort: []interface{}{float64(1)}},
+			}, hits)
+		})
+
+		It("no hits", func() {
+			_, err := parseSearchHits(types.H{})
+			assert.Error(GinkgoT(), err)
+		})
+
+		It("hit without _source", func() {
+			_, err := parseSearchHits(types.H{
+				"hits": map[string]interface{}{"hits": []interface{}{map[string]interface{}{}}},
+			})
+			assert.Error(GinkgoT(), err)
+		})
+	})
+
+	Describe("number compare doc", func() {
+		It("makeDoc", func() {
+			doc, err := makeDoc(types.Doc, &types.Policy{
+				ID:         1,
+				System:     "bk_cmdb",
+				Expression: expression.ExprCell{OP: operator.Gte, Field: "host.cpu_cores", Value: 8},
+			})
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), types.H{"host.cpu_cores__gte": float64(8)}, doc["resource"].(types.H)["bk_cmdb"])
+		})
+
+		It("genDocRanges", func() {
+			ranges := genDocRanges(&types.SearchRequest{
+				Resource: []types.ResourceNode{
+					{
+						System: "bk_cmdb",
+						Type:   "host",
+						ID:     "1",
+						Attribute: map[string]interface{}{
+							"id":            "1",
+							"cpu_cores":     float64(16),
+							"_bk_iam_path_": "/biz,1/",
+						},
+					},
+				},
+			})
+			assert.Equal(GinkgoT(), []docRange{
+				{System: "bk_cmdb", Field: "host.cpu_cores__gt", OP: "lt", Value: 16},
+				{System: "bk_cmdb", Field: "host.cpu_cores__gte", OP: "lte", Value: 16},
+				{System: "bk_cmdb", Field: "host.cpu_cores__lt", OP: "gt", Value: 16},
+				{System: "bk_cmdb", Field: "host.cpu_cores__lte", OP: "gte", Value: 16},
+			}, ranges)
+		})
+
+		It("parseNumberCompareField", func() {
+			op, field, ok := parseNumberCompareField("host.cpu_cores__gte")
+			assert.True(GinkgoT(), ok)
+			assert.Equal(GinkgoT(), operator.Gte, op)
+			assert.Equal(GinkgoT(), "host.cpu_cores", field)
+
+			_, _, ok = parseNumberCompareField("host.cpu_cores")
+			assert.False(GinkgoT(), ok)
+		})
+	})
+
+	Describe("AND doc", func() {
+		policy := &types.Policy{
+			ID:     1,
+			System: "bk_cmdb",
+			Expression: expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{
+					{OP: operator.Eq, Field: "host.id", Value: "1"},
+					{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,2/"},
+				},
+			},
+		}
+
+		It("makeDoc", func() {
+			doc, err := makeDoc(types.Doc, policy)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(),
+				[]string{"bk_cmdb.host._bk_iam_path_contains_", "bk_cmdb.host.id"},
+				doc[andFieldsKey],
+			)
+			assert.Equal(GinkgoT(), 2, doc[andFieldsCountKey])
+			assert.Equal(GinkgoT(), types.H{
+				"host.id":                     []interface{}{"1"},
+				"host._bk_iam_path_contains_": []interface{}{"/set,2/"},
+			}, doc["resource"].(types.H)["bk_cmdb"])
+		})
+
+		It("makeDoc cross system", func() {
+			doc, err := makeDoc(types.Doc, &types.Policy{
+				ID:     3,
+				System: "bk_job",
+				Expression: expression.ExprCell{
+					OP: operator.AND,
+					Content: []expression.ExprCell{
+						{OP: operator.Eq, Field: "script.id", Value: "1"},
+						{OP: operator.Eq, Field: "host.id", Value: "2"},
+					},
+				},
+				ResourceTypeSystems: map[string]string{"host": "bk_cmdb"},
+			})
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), types.H{
+				"bk_job":  types.H{"script.id": []interface{}{"1"}},
+				"bk_cmdb": types.H{"host.id": []interface{}{"2"}},
+			}, doc["resource"])
+			assert.Equal(GinkgoT(), []string{"bk_cmdb.host.id", "bk_job.script.id"}, doc[andFieldsKey])
+			assert.Equal(GinkgoT(), docSchemaVersion, doc["schema_version"])
+		})
+
+		It("makeDoc not AND", func() {
+			doc, err := makeDoc(types.Doc, &types.Policy{
+				ID:         2,
+				System:     "bk_cmdb",
+				Expression: expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"},
+			})
+			assert.NoError(GinkgoT(), err)
+			assert.NotContains(GinkgoT(), doc, andFieldsKey)
+		})
+
+		It("genANDDocQuery", func() {
+			query := genANDDocQuery([]docTerm{
+				{System: "bk_cmdb", Field: "host.id", Value: "1"},
+				{System: "bk_cmdb", Field: "host._bk_iam_path_", Value: "/biz,1/"},
+				{System: "bk_cmdb", Field: "host._bk_iam_path_", Value: "/biz,1/set,2/"},
+			})
+			must := query["bool"].(types.H)["must"].([]interface{})
+			assert.Len(GinkgoT(), must, 3)
+			assert.Equal(GinkgoT(),
+				[]string{"bk_cmdb.host.id", "bk_cmdb.host._bk_iam_path_"},
+				must[0].(types.H)["terms_set"].(types.H)[andFieldsKey].(types.H)["terms"],
+			)
+			should := must[2].(types.H)["bool"].(types.H)["should"].([]interface{})
+			assert.Equal(GinkgoT(),
+				types.H{"terms": types.H{"resource.bk_cmdb.host._bk_iam_path_": []interface{}{"/biz,1/", "/biz,1/set,2/"}}},
+				should[1],
+			)
+		})
+
+		It("andDocObjectToExpression", func() {
+			expr := andDocObjectToExpression(map[string]interface{}{
+				"host.id":                     []interface{}{"1", "2"},
+				"host._bk_iam_path_":          []interface{}{"/biz,1/", "/biz,2/"},
+				"host._bk_iam_path_contains_": []interface{}{"/set,2/"},
+			})
+			assert.Equal(GinkgoT(), operator.AND, expr.OP)
+			assert.Equal(GinkgoT(), []expression.ExprCell{
+				{
+					OP: operator.OR,
+					Content: []expression.ExprCell{
+						{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/"},
+						{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,2/"},
+					},
+				},
+				{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,2/"},
+				{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"}},
+			}, expr.Content)
+		})
+	})
 })
 
 func BenchmarkSplitBKIAMPath(b *testing.B) {
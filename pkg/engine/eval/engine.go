@@ -13,8 +13,12 @@ package eval
 
 import (
 	"context"
+	"fmt"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
@@ -26,6 +30,13 @@ import (
 	"engine/pkg/util"
 )
 
+const (
+	// the expressions count of one shard, the action with expressions less than it will be evaluated in one shard
+	evalShardSize = 1000
+	// check the ctx every evalCheckInterval expressions in one shard
+	evalCheckInterval = 64
+)
+
 type EvalEngine struct {
 	engines       sync.Map
 	lastIndexTime time.Time
@@ -125,8 +136,11 @@ func (e *EvalEngine) Search(
 		return &EvalSearchResult{}, nil
 	}
 
-	subjects, err := engine.search(ctx, req, entry)
-	return &EvalSearchResult{subjects: subjects}, err
+	subjects, partial := engine.search(ctx, req, req.Limit, entry)
+	if partial {
+		logger.Warnf("eval search of system `%s` action `%s` timeout, return partial subjects", system, action)
+	}
+	return &EvalSearchResult{subjects: subjects, partial: partial}, nil
 }
 
 // BatchSearch ...
@@ -147,6 +161,98 @@ func (e *EvalEngine) BatchSearch(
 	return
 }
 
+// ReverseSearch ...
+func (e *EvalEngine) ReverseSearch(
+	ctx context.Context,
+	req *types.ReverseSearchRequest,
+	entry *debug.Entry,
+) (*types.ReverseSearchResult, error) {
+	result := types.NewReverseSearchResult()
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return result, nil
+	}
+
+	result.Expressions = engine.reverseSearch(req, entry)
+	return result, nil
+}
+
+// PageSearch ...
+func (e *EvalEngine) PageSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	size int,
+	entry *debug.Entry,
+) (*types.SearchPage, error) {
+	page := &types.SearchPage{}
+
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return page, nil
+	}
+
+	// NOTE: 分页需要完整的结果, 不能返回部分结果
+	subjects, partial := engine.search(ctx, req, 0, entry)
+	if partial {
+		return nil, fmt.Errorf("eval page search timeout: %w", ctx.Err())
+	}
+
+	// NOTE: 策略是map无序存储的, 需要全部计算后按subject uid排序
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].UID < subjects[j].UID
+	})
+	if len(subjects) > size {
+		subjects = subjects[:size]
+		page.HasMore = true
+	}
+	page.Subjects = subjects
+	return page, nil
+}
+
+// OpenPointInTime not support, the pages are searched from the latest policies
+func (e *EvalEngine) OpenPointInTime(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// ClosePointInTime ...
+func (e *EvalEngine) ClosePointInTime(ctx context.Context, pitID string) error {
+	return nil
+}
+
+// SearchExpiredAt ...
+func (e *EvalEngine) SearchExpiredAt(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return nil, nil
+	}
+
+	// NOTE: 需要完整的结果计算每个subject最晚的过期时间, 不能返回部分结果
+	subjects, partial := engine.searchExpiredAt(ctx, req, entry)
+	if partial {
+		return nil, fmt.Errorf("eval search expired_at timeout: %w", ctx.Err())
+	}
+	return subjects, nil
+}
+
+// Explain ...
+func (e *EvalEngine) Explain(
+	ctx context.Context,
+	req *types.ExplainRequest,
+	entry *debug.Entry,
+) ([]types.ExplainPolicy, error) {
+	engine, ok := e.getActionEngine(req.System, req.Action.ID)
+	if !ok {
+		return nil, nil
+	}
+
+	return engine.explain(req, entry), nil
+}
+
 // BulkDelete ...
 func (e *EvalEngine) BulkDelete(ids []int64, logger *log.Entry) error {
 	e.engineRange(func(engine *actionEvalEngine) {
@@ -165,6 +271,54 @@ func (e *EvalEngine) BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []type
 	return nil
 }
 
+// PurgeExpired ...
+func (e *EvalEngine) PurgeExpired(beforeExpiredAt int64, logger *log.Entry) (count uint64, err error) {
+	e.engineRange(func(engine *actionEvalEngine) {
+		count += uint64(engine.purgeExpired(beforeExpiredAt))
+	})
+	if count > 0 {
+		e.lastIndexTime = time.Now()
+	}
+	return count, nil
+}
+
+// ListActionsByIDs ...
+func (e *EvalEngine) ListActionsByIDs(ids []int64) ([]types.SystemAction, error) {
+	return e.listActions(func(engine *actionEvalEngine) bool {
+		return engine.hasAny(ids)
+	}), nil
+}
+
+// ListActionsBySubjects ...
+func (e *EvalEngine) ListActionsBySubjects(
+	beforeUpdatedAt int64,
+	subjects []types.Subject,
+) ([]types.SystemAction, error) {
+	matchFunc := subjectsMatchFunc(beforeUpdatedAt, subjects)
+	return e.listActions(func(engine *actionEvalEngine) bool {
+		return engine.hasMatched(matchFunc)
+	}), nil
+}
+
+// ListActionsByResource ...
+func (e *EvalEngine) ListActionsByResource(system string, resource types.Resource) ([]types.SystemAction, error) {
+	return e.listActions(func(engine *actionEvalEngine) bool {
+		return engine.system == system && engine.hasMatched(func(policy *types.Policy) bool {
+			return policy.MatchResourceTypes(resource)
+		})
+	}), nil
+}
+
+func (e *EvalEngine) listActions(f func(engine *actionEvalEngine) bool) []types.SystemAction {
+	actions := make([]types.SystemAction, 0, 2)
+	e.engineRange(func(engine *actionEvalEngine) {
+		if f(engine) {
+			actions = append(actions, types.SystemAction{System: engine.system, Action: engine.action})
+		}
+	})
+	return actions
+}
+
 // Total ...
 func (e *EvalEngine) Total() (size uint64) {
 	e.engineRange(func(engine *actionEvalEngine) {
@@ -208,6 +362,10 @@ func (e *EvalEngine) TakeSnapshot() []types.SnapRecord {
 // LoadSnapshot ...
 func (e *EvalEngine) LoadSnapshot(data []types.SnapRecord) error {
 	for _, record := range data {
+		if len(record.EvalPolicies) == 0 {
+			continue
+		}
+
 		system := record.System
 		action := record.Action
 
@@ -221,6 +379,24 @@ func (e *EvalEngine) LoadSnapshot(data []types.SnapRecord) error {
 // EvalSearchResult ES 查询结果
 type EvalSearchResult struct {
 	subjects []types.Subject
+	// the eval stopped by the ctx deadline, subjects is not complete
+	partial bool
+}
+
+// Partial ...
+func (e *EvalSearchResult) Partial() bool {
+	return e.partial
+}
+
+// MatchedPolicies ...
+func (e *EvalSearchResult) MatchedPolicies() map[string][]types.MatchedPolicy {
+	policies := make(map[string][]types.MatchedPolicy)
+	for _, subject := range e.subjects {
+		if len(subject.Policies) > 0 {
+			policies[subject.UID] = subject.Policies
+		}
+	}
+	return policies
 }
 
 // GetSubjects ...
@@ -242,7 +418,13 @@ type actionEvalEngine struct {
 	system string
 	action string
 
-	policies      map[int64]*types.Policy
+	policies map[int64]*types.Policy
+	// the policies grouped by expression signature
+	groups map[string]*expressionGroup
+	// the index of groups by the resource types and attribute values required
+	prefilter *prefilter
+	// the policies ordered by expired_at, for purging the expired policies
+	expiry        expiryHeap
 	lastIndexTime time.Time
 
 	mu *sync.RWMutex
@@ -255,6 +437,8 @@ func newActionEngine(system, action string) *actionEvalEngine {
 		action: action,
 
 		policies:      make(map[int64]*types.Policy, 10),
+		groups:        make(map[string]*expressionGroup, 10),
+		prefilter:     newPrefilter(),
 		lastIndexTime: time.Now(),
 
 		mu: new(sync.RWMutex),
@@ -276,7 +460,7 @@ func (e *actionEvalEngine) add(p *types.Policy) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.policies[p.ID] = p
+	e.addPolicy(p)
 	e.lastIndexTime = time.Now()
 }
 
@@ -286,80 +470,284 @@ func (e *actionEvalEngine) bulkAdd(policies []*types.Policy) {
 	defer e.mu.Unlock()
 
 	for _, p := range policies {
-		e.policies[p.ID] = p
+		e.addPolicy(p)
 	}
 	e.lastIndexTime = time.Now()
 }
 
-// search ...
+// search will eval the expressions in shards parallel, return the subjects allowed and whether the result is partial
+// the policies matched are kept in the subjects if the request with_policies
+// NOTE:
+//  1. 按表达式签名分组, 每个表达式只计算一次, 有权限时批量返回该表达式的所有subject;
+//     通过prefilter过滤掉资源类型/属性值不可能满足的表达式
+//  2. 表达式分片并行计算, 计算结果由当前goroutine统一收集并去重
+//  3. limit > 0 时, 去重后的subject数量达到limit即停止所有分片的计算
+//  4. ctx 超时后停止计算, 返回已计算出的subjects, 并标记为partial
 func (e *actionEvalEngine) search(
 	ctx context.Context,
 	req *types.SearchRequest,
+	limit int,
 	entry *debug.Entry,
-) ([]types.Subject, error) {
+) ([]types.Subject, bool) {
 	if e.empty() {
-		return nil, nil
+		return nil, false
 	}
 
-	// TODO: add cache here!!!!!!
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
 	subjects := make([]types.Subject, 0, 100)
+	// subject uid => index of subjects
+	subjectIndexes := make(map[string]int, 100)
+	reachLimit, timeout := e.evalAllowed(ctx, req, entry, func(policies []*types.Policy) bool {
+		for _, p := range policies {
+			if idx, ok := subjectIndexes[p.Subject.UID]; ok {
+				if req.WithPolicies {
+					subjects[idx].Policies = append(subjects[idx].Policies, types.NewMatchedPolicy(p, types.Eval))
+				}
+				continue
+			}
+
+			subject := p.Subject
+			if req.WithPolicies {
+				subject.Policies = []types.MatchedPolicy{types.NewMatchedPolicy(p, types.Eval)}
+			}
+			subjectIndexes[p.Subject.UID] = len(subjects)
+			subjects = append(subjects, subject)
+
+			if limit > 0 && len(subjects) >= limit {
+				return true
+			}
+		}
+		return false
+	})
+
+	// reach the limit, the result is complete even if some shards timeout
+	if reachLimit {
+		return subjects, false
+	}
+	return subjects, timeout
+}
+
+// searchExpiredAt will eval all the expressions, return the subjects with the latest expired_at of the policies allowed,
+// and whether the result is partial
+func (e *actionEvalEngine) searchExpiredAt(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, bool) {
+	if e.empty() {
+		return nil, false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	// TODO: 从 sync.Pool 中初始化, 如果从sync.Pool中初始化, 已经扩容的slice会一直占内存吗
-	evaledResults := make(map[string]bool, 100)
+	expiries := make(map[string]*types.SubjectExpiry, 100)
+	_, timeout := e.evalAllowed(ctx, req, entry, func(policies []*types.Policy) bool {
+		for _, p := range policies {
+			if se, ok := expiries[p.Subject.UID]; ok {
+				if p.ExpiredAt > se.ExpiredAt {
+					se.ExpiredAt = p.ExpiredAt
+				}
+				continue
+			}
+			expiries[p.Subject.UID] = &types.SubjectExpiry{Subject: p.Subject, ExpiredAt: p.ExpiredAt}
+		}
+		return false
+	})
 
+	subjects := make([]types.SubjectExpiry, 0, len(expiries))
+	for _, se := range expiries {
+		subjects = append(subjects, *se)
+	}
+	return subjects, timeout
+}
+
+// evalAllowed will eval the expressions in shards parallel, and call the collect func with the policies of each
+// allowed expression in the current goroutine; stop all the shards once the collect func return true
+// return whether stopped by the collect func, and whether stopped by the ctx deadline
+// NOTE: 需要在持有读锁时调用
+func (e *actionEvalEngine) evalAllowed(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+	collect func(policies []*types.Policy) bool,
+) (stopped, timeout bool) {
 	// TODO: 从 sync.Pool 中初始化
 	obj := expression.NewObjectSet()
 	for _, resourceNode := range req.Resource {
 		obj.Set(resourceNode.Type, resourceNode.Attribute)
 	}
 
+	// only eval the groups may be allowed for the resource
+	shards := shardGroups(e.prefilter.candidates(req.Resource))
+	subjectUIDs := req.SubjectUIDSet()
+
+	// the policies of the expressions allowed
+	allowedCh := make(chan []*types.Policy, len(shards))
+	stopCh := make(chan struct{})
+
+	var timeoutFlag int32
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(groups []*expressionGroup) {
+			defer wg.Done()
+			if evalGroups(ctx, stopCh, groups, req, subjectUIDs, obj, allowedCh) {
+				atomic.StoreInt32(&timeoutFlag, 1)
+			}
+		}(shard)
+	}
+	go func() {
+		wg.Wait()
+		close(allowedCh)
+	}()
+
+	for policies := range allowedCh {
+		// NOTE: 停止后需要继续读完channel, 等待所有分片退出
+		if stopped {
+			continue
+		}
+
+		// NOTE: debug entry 不是并发安全的, 在收集结果时记录
+		debug.AddPolicy(entry, policies[0])
+
+		if collect(policies) {
+			stopped = true
+			close(stopCh)
+		}
+	}
+
+	return stopped, atomic.LoadInt32(&timeoutFlag) == 1
+}
+
+// shardGroups will split the expression groups into shards
+func shardGroups(groups []*expressionGroup) [][]*expressionGroup {
+	shardCount := (len(groups) + evalShardSize - 1) / evalShardSize
+	if maxShardCount := runtime.NumCPU(); shardCount > maxShardCount {
+		shardCount = maxShardCount
+	}
+	if shardCount < 1 {
+		shardCount = 1
+	}
+
+	shards := make([][]*expressionGroup, shardCount)
+	idx := 0
+	for _, group := range groups {
+		shards[idx] = append(shards[idx], group)
+		idx = (idx + 1) % shardCount
+	}
+	return shards
+}
+
+// evalGroups will eval the expressions of one shard, send the candidate policies of the allowed expression to allowedCh
+// return true if stopped by the ctx deadline
+func evalGroups(
+	ctx context.Context,
+	stopCh <-chan struct{},
+	groups []*expressionGroup,
+	req *types.SearchRequest,
+	subjectUIDs *set.StringSet,
+	obj expression.ObjectSetInterface,
+	allowedCh chan<- []*types.Policy,
+) bool {
+	for idx, group := range groups {
+		if idx%evalCheckInterval == 0 {
+			// 1. 已经达到limit, 停止计算
+			select {
+			case <-stopCh:
+				return false
+			default:
+			}
+
+			// 2. 超时, 停止计算
+			if ctx.Err() != nil {
+				return true
+			}
+		}
+
+		// 3. 没有需要检索的策略(过期/subject类型不符/不在候选subject中/在cursor之前), 不需要计算
+		policies := group.candidates(req, subjectUIDs)
+		if len(policies) == 0 {
+			continue
+		}
+
+		// 4. eval, 判断有没有权限
+		if !group.expression.Eval(obj) {
+			continue
+		}
+
+		select {
+		case allowedCh <- policies:
+		case <-stopCh:
+			return false
+		}
+	}
+	return false
+}
+
+// reverseSearch will return the expressions of the subject's policies
+func (e *actionEvalEngine) reverseSearch(req *types.ReverseSearchRequest, entry *debug.Entry) []expression.ExprCell {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	subjectUIDs := set.NewStringSet()
+	subjectUID := req.SubjectUID()
+
+	exprs := make([]expression.ExprCell, 0, 2)
+	signatures := set.NewStringSet()
 	for _, p := range e.policies {
-		// 1. 如果已经过期了, 那么不计算
-		if p.ExpiredAt < req.NowTimestamp {
+		if p.ExpiredAt < req.NowTimestamp || p.Subject.UID != subjectUID {
 			continue
 		}
 
-		// filter the subject not the req.SubjectType
-		if req.SubjectType != types.SubjectTypeAll && req.SubjectType != p.Subject.Type {
+		// 模板等配置出来的表达式可能是一样的, 只返回一次
+		if signatures.Has(p.ExpressionSignature) {
 			continue
 		}
+		signatures.Add(p.ExpressionSignature)
 
-		// 2. 如果subject已经有了, 那么跳过
-		// NOTE:这里是个线性执行的, 所以判断subject重复没有问题, 但是如果切换成并行计算, 那么会有问题
-		if subjectUIDs.Has(p.Subject.UID) {
-			continue
-		}
+		exprs = append(exprs, p.Expression)
+		debug.AddPolicy(entry, p)
+	}
+	return exprs
+}
 
-		// 3. 已经执行过的表达式, 不再执行 (使用模板等配置出来的表达式可能是一样的)
-		if hasPermission, ok := evaledResults[p.ExpressionSignature]; ok {
-			if !hasPermission {
-				// 无权限
-				continue
-			} else {
-				// 有权限(此时subject肯定是没有出现过的), 加入到subjects
-				subjects = append(subjects, p.Subject)
-				subjectUIDs.Add(p.Subject.UID)
+// explain will eval all the policies of the subject with trace, return the policies granting the permission
+func (e *actionEvalEngine) explain(req *types.ExplainRequest, entry *debug.Entry) []types.ExplainPolicy {
+	obj := expression.NewObjectSet()
+	for _, resourceNode := range req.Resource {
+		obj.Set(resourceNode.Type, resourceNode.Attribute)
+	}
 
-				continue
-			}
-		}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-		// 4. eval, 判断有没有权限
-		allowed := p.Expression.Eval(obj)
-		evaledResults[p.ExpressionSignature] = allowed
-		if allowed {
-			subjects = append(subjects, p.Subject)
-			subjectUIDs.Add(p.Subject.UID)
+	subjectUID := req.SubjectUID()
+
+	policies := make([]types.ExplainPolicy, 0, 2)
+	for _, p := range e.policies {
+		if p.ExpiredAt < req.NowTimestamp || p.Subject.UID != subjectUID {
+			continue
+		}
 
-			debug.AddPolicy(entry, p)
+		trace := evalWithTrace(&p.Expression, obj)
+		if !trace.Result {
+			continue
 		}
+
+		expr := p.Expression
+		policies = append(policies, types.ExplainPolicy{
+			ID:         p.ID,
+			TemplateID: p.TemplateID,
+			ExpiredAt:  p.ExpiredAt,
+			Type:       types.Eval,
+			Expression: &expr,
+			Trace:      &trace,
+		})
+		debug.AddPolicy(entry, p)
 	}
-	return subjects, nil
+	return policies
 }
 
 // bulkDelete ...
@@ -368,7 +756,7 @@ func (e *actionEvalEngine) bulkDelete(ids []int64) {
 	defer e.mu.Unlock()
 
 	for _, id := range ids {
-		delete(e.policies, id)
+		e.removePolicy(id)
 	}
 
 	e.lastIndexTime = time.Now()
@@ -382,12 +770,43 @@ func toSubjectSet(subjects []types.Subject) *set.StringSet {
 	return subjectSet
 }
 
-// bulkDeleteBySubjects ...
-func (e *actionEvalEngine) bulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Subject) {
+// subjectsMatchFunc return the func matching the policies of the subjects updated before the timestamp
+func subjectsMatchFunc(beforeUpdatedAt int64, subjects []types.Subject) func(policy *types.Policy) bool {
 	subjectSet := toSubjectSet(subjects)
-	e.bulkDeleteByMatchFunc(func(policy *types.Policy) bool {
+	return func(policy *types.Policy) bool {
 		return subjectSet.Has(policy.Subject.UID) && policy.UpdatedAt < beforeUpdatedAt
-	})
+	}
+}
+
+// bulkDeleteBySubjects ...
+func (e *actionEvalEngine) bulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Subject) {
+	e.bulkDeleteByMatchFunc(subjectsMatchFunc(beforeUpdatedAt, subjects))
+}
+
+// hasAny return true if any of the policies in the engine
+func (e *actionEvalEngine) hasAny(ids []int64) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, id := range ids {
+		if _, ok := e.policies[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMatched return true if any policy in the engine matched
+func (e *actionEvalEngine) hasMatched(matchFunc func(policy *types.Policy) bool) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, p := range e.policies {
+		if matchFunc(p) {
+			return true
+		}
+	}
+	return false
 }
 
 func (e *actionEvalEngine) bulkDeleteByMatchFunc(matchFunc func(policy *types.Policy) bool) {
@@ -402,7 +821,7 @@ func (e *actionEvalEngine) bulkDeleteByMatchFunc(matchFunc func(policy *types.Po
 	}
 
 	for _, id := range deleteIDs {
-		delete(e.policies, id)
+		e.removePolicy(id)
 	}
 
 	e.lastIndexTime = time.Now()
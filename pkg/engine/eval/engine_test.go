@@ -11,6 +11,176 @@
 
 package eval
 
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
+)
+
+var _ = Describe("actionEvalEngine search", func() {
+	var engine *actionEvalEngine
+	var req *types.SearchRequest
+
+	newPolicy := func(id int64, subjectID string, hostID string) *types.Policy {
+		p := &types.Policy{
+			ID:         id,
+			System:     "bk_cmdb",
+			Actions:    []types.Action{{ID: "edit_host"}},
+			Subject:    types.Subject{Type: types.SubjectTypeUser, ID: subjectID},
+			Expression: expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: hostID},
+			ExpiredAt:  4102444800,
+		}
+		_ = p.FillUniqueFields()
+		return p
+	}
+
+	BeforeEach(func() {
+		engine = newActionEngine("bk_cmdb", "edit_host")
+		req = &types.SearchRequest{
+			System: "bk_cmdb",
+			Action: types.Action{ID: "edit_host"},
+			Resource: types.Resource{
+				{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+			},
+			SubjectType:  types.SubjectTypeAll,
+			NowTimestamp: time.Now().Unix(),
+		}
+	})
+
+	It("distinct subjects in shards", func() {
+		// 每个subject有3条策略, 数量超过一个分片
+		policies := make([]*types.Policy, 0, evalShardSize*3)
+		for i := 0; i < evalShardSize*3; i++ {
+			hostID := "1"
+			if i%3 == 0 {
+				hostID = "2"
+			}
+			policies = append(policies, newPolicy(int64(i), fmt.Sprintf("user%d", i%evalShardSize), hostID))
+		}
+		engine.bulkAdd(policies)
+
+		subjects, partial := engine.search(context.Background(), req, 0, nil)
+		assert.False(GinkgoT(), partial)
+		// user_i 的三条策略中至少有一条 host.id=1
+		assert.Len(GinkgoT(), subjects, evalShardSize)
+
+		uids := make(map[string]struct{}, len(subjects))
+		for _, subject := range subjects {
+			uids[subject.UID] = struct{}{}
+		}
+		assert.Len(GinkgoT(), uids, evalShardSize)
+	})
+
+	It("stop at limit", func() {
+		policies := make([]*types.Policy, 0, evalShardSize*2)
+		for i := 0; i < evalShardSize*2; i++ {
+			policies = append(policies, newPolicy(int64(i), fmt.Sprintf("user%d", i), "1"))
+		}
+		engine.bulkAdd(policies)
+
+		subjects, partial := engine.search(context.Background(), req, 10, nil)
+		assert.False(GinkgoT(), partial)
+		assert.Len(GinkgoT(), subjects, 10)
+	})
+
+	It("partial when ctx deadline exceeded", func() {
+		engine.bulkAdd([]*types.Policy{newPolicy(1, "admin", "1"), newPolicy(2, "tom", "1")})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+
+		subjects, partial := engine.search(ctx, req, 0, nil)
+		assert.True(GinkgoT(), partial)
+		assert.Empty(GinkgoT(), subjects)
+	})
+
+	It("list actions", func() {
+		e := &EvalEngine{}
+		e.engines.Store(e.genKey("bk_cmdb", "edit_host"), engine)
+		engine.bulkAdd([]*types.Policy{newPolicy(1, "admin", "1")})
+
+		actions, err := e.ListActionsByIDs([]int64{1})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "edit_host"}}, actions)
+
+		actions, err = e.ListActionsBySubjects(1, []types.Subject{{Type: "user", ID: "admin"}})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "edit_host"}}, actions)
+
+		actions, err = e.ListActionsByIDs([]int64{2})
+		assert.NoError(GinkgoT(), err)
+		assert.Empty(GinkgoT(), actions)
+
+		actions, err = e.ListActionsByResource("bk_cmdb", types.Resource{{System: "bk_cmdb", Type: "host", ID: "1"}})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []types.SystemAction{{System: "bk_cmdb", Action: "edit_host"}}, actions)
+
+		actions, err = e.ListActionsByResource("bk_cmdb", types.Resource{{System: "bk_cmdb", Type: "biz", ID: "1"}})
+		assert.NoError(GinkgoT(), err)
+		assert.Empty(GinkgoT(), actions)
+	})
+
+	It("search with policies", func() {
+		engine.bulkAdd([]*types.Policy{newPolicy(1, "admin", "1"), newPolicy(2, "admin", "1"), newPolicy(3, "tom", "2")})
+
+		subjects, _ := engine.search(context.Background(), req, 0, nil)
+		assert.Len(GinkgoT(), subjects, 1)
+		assert.Empty(GinkgoT(), subjects[0].Policies)
+
+		req.WithPolicies = true
+		result := &EvalSearchResult{}
+		result.subjects, _ = engine.search(context.Background(), req, 0, nil)
+		assert.ElementsMatch(GinkgoT(), []types.MatchedPolicy{
+			{ID: 1, ExpiredAt: 4102444800, Type: types.Eval},
+			{ID: 2, ExpiredAt: 4102444800, Type: types.Eval},
+		}, result.MatchedPolicies()["user:admin"])
+	})
+
+	It("search expired_at", func() {
+		p1 := newPolicy(1, "admin", "1")
+		p1.ExpiredAt = req.NowTimestamp + 100
+		p2 := newPolicy(2, "admin", "1")
+		p2.ExpiredAt = req.NowTimestamp + 200
+		// not allowed
+		p3 := newPolicy(3, "admin", "2")
+		p3.ExpiredAt = req.NowTimestamp + 300
+		// expired
+		p4 := newPolicy(4, "tom", "1")
+		p4.ExpiredAt = req.NowTimestamp - 1
+		engine.bulkAdd([]*types.Policy{p1, p2, p3, p4})
+
+		subjects, partial := engine.searchExpiredAt(context.Background(), req, nil)
+		assert.False(GinkgoT(), partial)
+		assert.Len(GinkgoT(), subjects, 1)
+		assert.Equal(GinkgoT(), "user:admin", subjects[0].UID)
+		assert.Equal(GinkgoT(), req.NowTimestamp+200, subjects[0].ExpiredAt)
+	})
+
+	It("page search fail when ctx deadline exceeded", func() {
+		e := &EvalEngine{}
+		e.engines.Store(e.genKey("bk_cmdb", "edit_host"), engine)
+		engine.bulkAdd([]*types.Policy{newPolicy(1, "admin", "1")})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := e.PageSearch(ctx, req, 10, nil)
+		assert.ErrorIs(GinkgoT(), err, context.Canceled)
+
+		result, err := e.Search(ctx, req, nil)
+		assert.NoError(GinkgoT(), err)
+		assert.True(GinkgoT(), result.Partial())
+	})
+})
+
 // func BenchmarkSortPoliciesRaw(b *testing.B) {
 //
 // 	count := 1000000
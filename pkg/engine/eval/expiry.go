@@ -0,0 +1,96 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"container/heap"
+	"time"
+
+	"engine/pkg/types"
+)
+
+// expiryHeapCompactThreshold the min count of heap items to trigger the compaction
+const expiryHeapCompactThreshold = 1024
+
+type expiryItem struct {
+	expiredAt int64
+	id        int64
+}
+
+// expiryHeap the min heap of policies ordered by expired_at
+// NOTE: 删除/更新策略时不从堆中移除, 出堆时与当前策略比对, 已删除或expired_at已变更的项直接丢弃
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiredAt < h[j].expiredAt }
+
+func (h expiryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push ...
+func (h *expiryHeap) Push(x interface{}) {
+	*h = append(*h, x.(expiryItem))
+}
+
+// Pop ...
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// pushExpiry will push the policy into the expiry heap, compact the heap if too many stale items
+// NOTE: 需要在持有写锁时调用
+func (e *actionEvalEngine) pushExpiry(p *types.Policy) {
+	heap.Push(&e.expiry, expiryItem{expiredAt: p.ExpiredAt, id: p.ID})
+
+	if len(e.expiry) > expiryHeapCompactThreshold && len(e.expiry) > 2*len(e.policies) {
+		e.compactExpiry()
+	}
+}
+
+// compactExpiry rebuild the heap from the current policies, drop all the stale items
+func (e *actionEvalEngine) compactExpiry() {
+	items := make(expiryHeap, 0, len(e.policies))
+	for _, p := range e.policies {
+		items = append(items, expiryItem{expiredAt: p.ExpiredAt, id: p.ID})
+	}
+	heap.Init(&items)
+	e.expiry = items
+}
+
+// purgeExpired will remove the policies expired before the timestamp, return the count of policies removed
+func (e *actionEvalEngine) purgeExpired(beforeExpiredAt int64) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	count := 0
+	for len(e.expiry) > 0 && e.expiry[0].expiredAt < beforeExpiredAt {
+		item := heap.Pop(&e.expiry).(expiryItem)
+
+		// skip the stale item, the policy has been deleted or updated
+		p, ok := e.policies[item.id]
+		if !ok || p.ExpiredAt != item.expiredAt {
+			continue
+		}
+
+		e.removePolicy(item.id)
+		count++
+	}
+
+	if count > 0 {
+		e.lastIndexTime = time.Now()
+	}
+	return count
+}
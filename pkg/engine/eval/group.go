@@ -0,0 +1,112 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+
+	"engine/pkg/types"
+)
+
+// expressionGroup the policies with the same expression signature
+// NOTE: 使用模板等配置出来的策略, 大量subject共享少量的表达式, 按签名分组后每个表达式只需要计算一次
+type expressionGroup struct {
+	signature   string
+	expression  expression.ExprCell
+	requirement requirement
+
+	policies map[int64]*types.Policy
+}
+
+func newExpressionGroup(p *types.Policy) *expressionGroup {
+	return &expressionGroup{
+		signature:   p.ExpressionSignature,
+		expression:  p.Expression,
+		requirement: parseRequirement(&p.Expression),
+		policies:    make(map[int64]*types.Policy, 1),
+	}
+}
+
+// candidates return the policies need to be searched, filter by expired_at / subject type / template / cursor,
+// and the candidate subjects if subjectUIDs not nil
+func (g *expressionGroup) candidates(req *types.SearchRequest, subjectUIDs *set.StringSet) []*types.Policy {
+	subjectType := req.SearchSubjectType()
+
+	var policies []*types.Policy
+	for _, p := range g.policies {
+		// 1. 如果已经过期了, 那么不计算
+		if p.ExpiredAt < req.NowTimestamp {
+			continue
+		}
+
+		// filter the subject not the req.SubjectType
+		if subjectType != types.SubjectTypeAll && subjectType != p.Subject.Type {
+			continue
+		}
+
+		// filter the policies not of the templates
+		if !req.MatchTemplate(p.TemplateID) {
+			continue
+		}
+
+		// filter the subjects not in the candidate subjects
+		if !req.IsCandidate(subjectUIDs, &p.Subject) {
+			continue
+		}
+
+		// skip the subjects before the cursor
+		if req.SearchCursor != nil && p.Subject.UID <= req.SearchCursor.EvalAfter {
+			continue
+		}
+
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// addPolicy will add the policy to the group of its expression signature
+// NOTE: 需要在持有写锁时调用
+func (e *actionEvalEngine) addPolicy(p *types.Policy) {
+	// the expression of the policy may be changed, remove from the old group first
+	e.removePolicy(p.ID)
+
+	group, ok := e.groups[p.ExpressionSignature]
+	if !ok {
+		group = newExpressionGroup(p)
+		e.groups[p.ExpressionSignature] = group
+		e.prefilter.add(group)
+	}
+	group.policies[p.ID] = p
+	e.policies[p.ID] = p
+	e.pushExpiry(p)
+}
+
+// removePolicy will remove the policy, and the group if it's empty
+// NOTE: 需要在持有写锁时调用
+func (e *actionEvalEngine) removePolicy(id int64) {
+	p, ok := e.policies[id]
+	if !ok {
+		return
+	}
+	delete(e.policies, id)
+
+	group, ok := e.groups[p.ExpressionSignature]
+	if !ok {
+		return
+	}
+	delete(group.policies, id)
+	if len(group.policies) == 0 {
+		delete(e.groups, p.ExpressionSignature)
+		e.prefilter.remove(group)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
+)
+
+var _ = Describe("expressionGroup", func() {
+	var engine *actionEvalEngine
+
+	newPolicy := func(id int64, subjectType, subjectID string, hostID string, expiredAt int64) *types.Policy {
+		p := &types.Policy{
+			ID:         id,
+			System:     "bk_cmdb",
+			Actions:    []types.Action{{ID: "edit_host"}},
+			Subject:    types.Subject{Type: subjectType, ID: subjectID},
+			Expression: expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: hostID},
+			ExpiredAt:  expiredAt,
+		}
+		_ = p.FillUniqueFields()
+		return p
+	}
+
+	BeforeEach(func() {
+		engine = newActionEngine("bk_cmdb", "edit_host")
+	})
+
+	It("group by expression signature", func() {
+		engine.bulkAdd([]*types.Policy{
+			newPolicy(1, "user", "admin", "1", 100),
+			newPolicy(2, "user", "tom", "1", 100),
+			newPolicy(3, "group", "1", "2", 100),
+		})
+		assert.Len(GinkgoT(), engine.groups, 2)
+		assert.Len(GinkgoT(), engine.groups[engine.policies[1].ExpressionSignature].policies, 2)
+	})
+
+	It("move to the new group when expression changed", func() {
+		engine.add(newPolicy(1, "user", "admin", "1", 100))
+		engine.add(newPolicy(1, "user", "admin", "2", 100))
+
+		assert.Len(GinkgoT(), engine.policies, 1)
+		assert.Len(GinkgoT(), engine.groups, 1)
+		assert.Equal(GinkgoT(), "2", engine.groups[engine.policies[1].ExpressionSignature].expression.Value)
+	})
+
+	It("remove the empty group", func() {
+		engine.bulkAdd([]*types.Policy{
+			newPolicy(1, "user", "admin", "1", 100),
+			newPolicy(2, "user", "tom", "2", 100),
+		})
+		engine.bulkDelete([]int64{1})
+		assert.Len(GinkgoT(), engine.policies, 1)
+		assert.Len(GinkgoT(), engine.groups, 1)
+
+		engine.bulkDeleteBySubjects(200, []types.Subject{{Type: "user", ID: "tom"}})
+		assert.True(GinkgoT(), engine.empty())
+		assert.Empty(GinkgoT(), engine.groups)
+	})
+
+	It("purge expired", func() {
+		engine.bulkAdd([]*types.Policy{
+			newPolicy(1, "user", "admin", "1", 100),
+			newPolicy(2, "user", "tom", "1", 50),
+			newPolicy(3, "group", "1", "2", 80),
+		})
+		// the expired_at of policy 3 updated, the stale heap item should be skipped
+		engine.add(newPolicy(3, "group", "1", "2", 200))
+		// policy 2 deleted
+		engine.bulkDelete([]int64{2})
+
+		assert.Equal(GinkgoT(), 0, engine.purgeExpired(100))
+		assert.Len(GinkgoT(), engine.policies, 2)
+
+		assert.Equal(GinkgoT(), 1, engine.purgeExpired(101))
+		assert.Len(GinkgoT(), engine.policies, 1)
+		assert.Len(GinkgoT(), engine.groups, 1)
+		assert.Contains(GinkgoT(), engine.policies, int64(3))
+	})
+
+	It("compact the expiry heap", func() {
+		for i := 0; i < 2*expiryHeapCompactThreshold; i++ {
+			engine.add(newPolicy(1, "user", "admin", "1", int64(100+i)))
+		}
+		assert.LessOrEqual(GinkgoT(), len(engine.expiry), expiryHeapCompactThreshold+1)
+
+		assert.Equal(GinkgoT(), 0, engine.purgeExpired(100+2*expiryHeapCompactThreshold-1))
+		assert.Equal(GinkgoT(), 1, engine.purgeExpired(100+2*expiryHeapCompactThreshold))
+		assert.True(GinkgoT(), engine.empty())
+	})
+
+	It("candidates", func() {
+		engine.bulkAdd([]*types.Policy{
+			newPolicy(1, "user", "admin", "1", 100),
+			newPolicy(2, "user", "tom", "1", 50),
+			newPolicy(3, "group", "1", "1", 100),
+		})
+		group := engine.groups[engine.policies[1].ExpressionSignature]
+
+		req := &types.SearchRequest{SubjectType: types.SubjectTypeAll, NowTimestamp: 60}
+		assert.Len(GinkgoT(), group.candidates(req, nil), 2)
+
+		req.SubjectType = types.SubjectTypeUser
+		policies := group.candidates(req, nil)
+		assert.Len(GinkgoT(), policies, 1)
+		assert.Equal(GinkgoT(), "user:admin", policies[0].Subject.UID)
+
+		req.SubjectType = types.SubjectTypeAll
+		req.SearchCursor = &types.SearchCursor{EvalAfter: "user:admin"}
+		policies = group.candidates(req, nil)
+		assert.Len(GinkgoT(), policies, 0)
+	})
+
+	It("candidates of subjects", func() {
+		engine.bulkAdd([]*types.Policy{
+			newPolicy(1, "user", "admin", "1", 100),
+			newPolicy(2, "user", "tom", "1", 100),
+			newPolicy(3, "group", "1", "1", 100),
+		})
+		group := engine.groups[engine.policies[1].ExpressionSignature]
+
+		req := &types.SearchRequest{
+			SubjectType:  types.SubjectTypeAll,
+			NowTimestamp: 60,
+			Subjects:     []types.Subject{{Type: "user", ID: "tom"}},
+		}
+		policies := group.candidates(req, req.SubjectUIDSet())
+		assert.Len(GinkgoT(), policies, 1)
+		assert.Equal(GinkgoT(), "user:tom", policies[0].Subject.UID)
+
+		// all the groups are candidates when expanding the groups
+		req.ExpandGroups = true
+		assert.Len(GinkgoT(), group.candidates(req, req.SubjectUIDSet()), 2)
+	})
+
+	It("candidates of templates", func() {
+		p := newPolicy(2, "user", "tom", "1", 100)
+		p.TemplateID = 1
+		engine.bulkAdd([]*types.Policy{newPolicy(1, "user", "admin", "1", 100), p})
+		group := engine.groups[engine.policies[1].ExpressionSignature]
+
+		req := &types.SearchRequest{SubjectType: types.SubjectTypeAll, NowTimestamp: 60, TemplateIDs: []int64{1}}
+		policies := group.candidates(req, nil)
+		assert.Len(GinkgoT(), policies, 1)
+		assert.Equal(GinkgoT(), "user:tom", policies[0].Subject.UID)
+
+		req = &types.SearchRequest{SubjectType: types.SubjectTypeAll, NowTimestamp: 60, ExcludeTemplates: true}
+		policies = group.candidates(req, nil)
+		assert.Len(GinkgoT(), policies, 1)
+		assert.Equal(GinkgoT(), "user:admin", policies[0].Subject.UID)
+	})
+})
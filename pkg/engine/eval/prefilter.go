@@ -0,0 +1,302 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+
+	"engine/pkg/types"
+)
+
+// requirement the condition must be satisfied by the request if the expression is true
+// NOTE: 只用于缩小计算范围, 满足requirement的表达式仍需要eval
+type requirement struct {
+	// the resource type must be in the request, empty if no resource type required
+	Type string
+	// the attribute value of the field must be one of the values, empty if no value constraint
+	Field  string
+	Values []string
+}
+
+// fieldValues the eq/in constraint of the field
+type fieldValues struct {
+	Field  string
+	Values []string
+}
+
+// parseRequirement will parse the requirement of the expression
+// 1. 优先使用可选值最少的 eq/in 约束
+// 2. 其次使用必须存在的资源类型
+// 3. 都没有则每次都需要计算
+func parseRequirement(expr *expression.ExprCell) requirement {
+	_types, constraints := mandatoryConstraints(expr)
+
+	if len(constraints) > 0 {
+		sort.SliceStable(constraints, func(i, j int) bool {
+			return len(constraints[i].Values) < len(constraints[j].Values)
+		})
+		c := constraints[0]
+		return requirement{Type: fieldType(c.Field), Field: c.Field, Values: c.Values}
+	}
+
+	if _types.Size() > 0 {
+		typeList := _types.ToSlice()
+		sort.Strings(typeList)
+		return requirement{Type: typeList[0]}
+	}
+
+	return requirement{}
+}
+
+// mandatoryConstraints return the resource types must exist and the eq/in constraints must be satisfied
+// NOTE:
+//  1. AND: 所有子表达式的约束都必须满足, 取并集
+//  2. OR: 只有所有子表达式都要求的资源类型才是必须的, 取交集; eq/in 约束不再下推
+//  3. 正向操作符(eq/in/starts_with等)在资源不存在时(值为nil)一定为false, 要求资源类型存在
+//  4. any 以及否定操作符(not_eq/not_in等)在资源不存在时可能为true, 没有约束
+func mandatoryConstraints(expr *expression.ExprCell) (*set.StringSet, []fieldValues) {
+	switch expr.OP {
+	case operator.AND:
+		_types := set.NewStringSet()
+		constraints := make([]fieldValues, 0, len(expr.Content))
+		for i := range expr.Content {
+			t, c := mandatoryConstraints(&expr.Content[i])
+			_types.Append(t.ToSlice()...)
+			constraints = append(constraints, c...)
+		}
+		return _types, constraints
+	case operator.OR:
+		var _types *set.StringSet
+		for i := range expr.Content {
+			t, _ := mandatoryConstraints(&expr.Content[i])
+			if _types == nil {
+				_types = t
+				continue
+			}
+
+			common := set.NewStringSet()
+			for _, _type := range t.ToSlice() {
+				if _types.Has(_type) {
+					common.Add(_type)
+				}
+			}
+			_types = common
+		}
+		if _types == nil {
+			_types = set.NewStringSet()
+		}
+		return _types, nil
+	}
+
+	_types := set.NewStringSet()
+	_type := fieldType(expr.Field)
+	if _type == "" || expr.Value == nil {
+		return _types, nil
+	}
+
+	switch expr.OP {
+	case operator.Eq:
+		_types.Add(_type)
+		if value, ok := stringValue(expr.Value); ok {
+			return _types, []fieldValues{{Field: expr.Field, Values: []string{value}}}
+		}
+	case operator.In:
+		_types.Add(_type)
+		if values, ok := stringValues(expr.Value); ok {
+			return _types, []fieldValues{{Field: expr.Field, Values: values}}
+		}
+	case operator.Lt, operator.Lte, operator.Gt, operator.Gte,
+		operator.StartsWith, operator.EndsWith, operator.StringContains, operator.Contains:
+		_types.Add(_type)
+	}
+	return _types, nil
+}
+
+func fieldType(field string) string {
+	idx := strings.IndexByte(field, '.')
+	if idx == -1 {
+		return ""
+	}
+	return field[:idx]
+}
+
+// stringValue return the value if it's kind of string
+// NOTE: sdk中 in 操作符对string kind的值按字符串比较, 非string kind的值不会与之相等
+func stringValue(value interface{}) (string, bool) {
+	if value == nil {
+		return "", false
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// stringValues return the values if it's an array of string kind values
+func stringValues(value interface{}) ([]string, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	values := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		s, ok := stringValue(v.Index(i).Interface())
+		if !ok {
+			return nil, false
+		}
+		values = append(values, s)
+	}
+	return values, true
+}
+
+// prefilter the index of expression groups by the requirement
+// NOTE: 每个表达式组只会在其中一个索引中
+type prefilter struct {
+	// the groups without requirement, should always be evaluated
+	unfiltered map[string]*expressionGroup
+	// resource type => signature => group
+	byType map[string]map[string]*expressionGroup
+	// field => value => signature => group
+	byValue map[string]map[string]map[string]*expressionGroup
+}
+
+func newPrefilter() *prefilter {
+	return &prefilter{
+		unfiltered: make(map[string]*expressionGroup),
+		byType:     make(map[string]map[string]*expressionGroup),
+		byValue:    make(map[string]map[string]map[string]*expressionGroup),
+	}
+}
+
+// add ...
+func (f *prefilter) add(group *expressionGroup) {
+	r := group.requirement
+	switch {
+	case r.Field != "":
+		values, ok := f.byValue[r.Field]
+		if !ok {
+			values = make(map[string]map[string]*expressionGroup)
+			f.byValue[r.Field] = values
+		}
+		for _, value := range r.Values {
+			groups, ok := values[value]
+			if !ok {
+				groups = make(map[string]*expressionGroup, 1)
+				values[value] = groups
+			}
+			groups[group.signature] = group
+		}
+	case r.Type != "":
+		groups, ok := f.byType[r.Type]
+		if !ok {
+			groups = make(map[string]*expressionGroup, 1)
+			f.byType[r.Type] = groups
+		}
+		groups[group.signature] = group
+	default:
+		f.unfiltered[group.signature] = group
+	}
+}
+
+// remove ...
+func (f *prefilter) remove(group *expressionGroup) {
+	r := group.requirement
+	switch {
+	case r.Field != "":
+		values := f.byValue[r.Field]
+		for _, value := range r.Values {
+			delete(values[value], group.signature)
+			if len(values[value]) == 0 {
+				delete(values, value)
+			}
+		}
+		if len(values) == 0 {
+			delete(f.byValue, r.Field)
+		}
+	case r.Type != "":
+		delete(f.byType[r.Type], group.signature)
+		if len(f.byType[r.Type]) == 0 {
+			delete(f.byType, r.Type)
+		}
+	default:
+		delete(f.unfiltered, group.signature)
+	}
+}
+
+// candidates return the groups may be allowed for the resource of the request
+func (f *prefilter) candidates(resource types.Resource) []*expressionGroup {
+	groups := make([]*expressionGroup, 0, len(f.unfiltered))
+	for _, group := range f.unfiltered {
+		groups = append(groups, group)
+	}
+
+	// NOTE: 同一个资源类型有多个节点时, 与eval时的ObjectSet保持一致, 后面的覆盖前面的
+	attributes := make(map[string]map[string]interface{}, len(resource))
+	for _, node := range resource {
+		attributes[node.Type] = node.Attribute
+	}
+
+	for _type, attrs := range attributes {
+		for _, group := range f.byType[_type] {
+			groups = append(groups, group)
+		}
+
+		for name, value := range attrs {
+			values, ok := f.byValue[_type+"."+name]
+			if !ok {
+				continue
+			}
+
+			// NOTE: 属性值为数组时, 任意一个值命中即可, 同一个组可能被多个值命中, 需要去重
+			signatures := set.NewStringSet()
+			for _, v := range attributeStringValues(value) {
+				for signature, group := range values[v] {
+					if signatures.Has(signature) {
+						continue
+					}
+					signatures.Add(signature)
+					groups = append(groups, group)
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// attributeStringValues return the string kind values of the attribute, the attribute may be an array
+func attributeStringValues(value interface{}) []string {
+	if s, ok := stringValue(value); ok {
+		return []string{s}
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil
+	}
+
+	values := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if s, ok := stringValue(v.Index(i).Interface()); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,201 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"context"
+	"sort"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
+)
+
+var _ = Describe("Prefilter", func() {
+	Describe("parseRequirement", func() {
+		It("eq", func() {
+			expr := expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}
+			assert.Equal(GinkgoT(), requirement{Type: "host", Field: "host.id", Values: []string{"1"}}, parseRequirement(&expr))
+		})
+
+		It("eq number", func() {
+			expr := expression.ExprCell{OP: operator.Eq, Field: "host.cpu", Value: 4}
+			assert.Equal(GinkgoT(), requirement{Type: "host"}, parseRequirement(&expr))
+		})
+
+		It("AND use the constraint with fewest values", func() {
+			expr := expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{
+					{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"}},
+					{OP: operator.Eq, Field: "module.id", Value: "3"},
+					{OP: operator.NotEq, Field: "host.os", Value: "linux"},
+				},
+			}
+			assert.Equal(
+				GinkgoT(),
+				requirement{Type: "module", Field: "module.id", Values: []string{"3"}},
+				parseRequirement(&expr),
+			)
+		})
+
+		It("OR common type", func() {
+			expr := expression.ExprCell{
+				OP: operator.OR,
+				Content: []expression.ExprCell{
+					{OP: operator.Eq, Field: "host.id", Value: "1"},
+					{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/"},
+				},
+			}
+			assert.Equal(GinkgoT(), requirement{Type: "host"}, parseRequirement(&expr))
+		})
+
+		It("OR different types", func() {
+			expr := expression.ExprCell{
+				OP: operator.OR,
+				Content: []expression.ExprCell{
+					{OP: operator.Eq, Field: "host.id", Value: "1"},
+					{OP: operator.Eq, Field: "module.id", Value: "1"},
+				},
+			}
+			assert.Equal(GinkgoT(), requirement{}, parseRequirement(&expr))
+		})
+
+		It("negative and any", func() {
+			expr := expression.ExprCell{OP: operator.NotIn, Field: "host.id", Value: []interface{}{"1"}}
+			assert.Equal(GinkgoT(), requirement{}, parseRequirement(&expr))
+
+			expr = expression.ExprCell{OP: operator.Any, Field: "host.id", Value: []interface{}{}}
+			assert.Equal(GinkgoT(), requirement{}, parseRequirement(&expr))
+		})
+	})
+
+	Describe("candidates", func() {
+		var f *prefilter
+		newGroup := func(signature string, expr expression.ExprCell) *expressionGroup {
+			p := &types.Policy{ExpressionSignature: signature, Expression: expr}
+			return newExpressionGroup(p)
+		}
+		signatures := func(groups []*expressionGroup) []string {
+			s := make([]string, 0, len(groups))
+			for _, g := range groups {
+				s = append(s, g.signature)
+			}
+			sort.Strings(s)
+			return s
+		}
+
+		BeforeEach(func() {
+			f = newPrefilter()
+			f.add(newGroup("eq", expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}))
+			f.add(newGroup("in", expression.ExprCell{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"}}))
+			f.add(newGroup("type", expression.ExprCell{OP: operator.StartsWith, Field: "host.name", Value: "a"}))
+			f.add(newGroup("module", expression.ExprCell{OP: operator.Eq, Field: "module.id", Value: "1"}))
+			f.add(newGroup("not_eq", expression.ExprCell{OP: operator.NotEq, Field: "host.id", Value: "1"}))
+		})
+
+		It("match value", func() {
+			groups := f.candidates(types.Resource{{Type: "host", Attribute: map[string]interface{}{"id": "2"}}})
+			assert.Equal(GinkgoT(), []string{"in", "not_eq", "type"}, signatures(groups))
+		})
+
+		It("match array value", func() {
+			groups := f.candidates(types.Resource{{Type: "host", Attribute: map[string]interface{}{
+				"id": []interface{}{"1", "2"},
+			}}})
+			assert.Equal(GinkgoT(), []string{"eq", "in", "not_eq", "type"}, signatures(groups))
+		})
+
+		It("type not in request", func() {
+			groups := f.candidates(types.Resource{{Type: "set", Attribute: map[string]interface{}{"id": "1"}}})
+			assert.Equal(GinkgoT(), []string{"not_eq"}, signatures(groups))
+		})
+
+		It("remove", func() {
+			f.remove(newGroup("eq", expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}))
+			f.remove(newGroup("in", expression.ExprCell{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "2"}}))
+			f.remove(newGroup("type", expression.ExprCell{OP: operator.StartsWith, Field: "host.name", Value: "a"}))
+			assert.Empty(GinkgoT(), f.byType)
+			assert.NotContains(GinkgoT(), f.byValue, "host.id")
+		})
+	})
+
+	It("search equivalent to eval all policies", func() {
+		exprs := []expression.ExprCell{
+			{OP: operator.Eq, Field: "host.id", Value: "1"},
+			{OP: operator.In, Field: "host.id", Value: []interface{}{"2", "3"}},
+			{OP: operator.NotEq, Field: "host.id", Value: "1"},
+			{OP: operator.Any, Field: "host.id", Value: []interface{}{}},
+			{OP: operator.Eq, Field: "module.id", Value: "1"},
+			{OP: operator.Contains, Field: "host.tags", Value: "db"},
+			{
+				OP: operator.AND,
+				Content: []expression.ExprCell{
+					{OP: operator.Eq, Field: "host.os", Value: "linux"},
+					{OP: operator.Gt, Field: "host.cpu", Value: 2},
+				},
+			},
+			{
+				OP: operator.OR,
+				Content: []expression.ExprCell{
+					{OP: operator.Eq, Field: "host.id", Value: "9"},
+					{OP: operator.NotIn, Field: "module.id", Value: []interface{}{"1"}},
+				},
+			},
+		}
+
+		engine := newActionEngine("bk_cmdb", "edit_host")
+		for i, expr := range exprs {
+			p := &types.Policy{
+				ID:         int64(i),
+				Subject:    types.Subject{Type: "user", ID: string(rune('a' + i))},
+				Expression: expr,
+				ExpiredAt:  4102444800,
+			}
+			_ = p.FillUniqueFields()
+			engine.add(p)
+		}
+
+		resources := []types.Resource{
+			{{Type: "host", Attribute: map[string]interface{}{"id": "1", "os": "linux", "cpu": 4}}},
+			{{Type: "host", Attribute: map[string]interface{}{"id": []interface{}{"3", "4"}, "tags": []interface{}{"db"}}}},
+			{{Type: "module", Attribute: map[string]interface{}{"id": "1"}}},
+			{{Type: "set", Attribute: map[string]interface{}{"id": "1"}}},
+		}
+		for _, resource := range resources {
+			obj := expression.NewObjectSet()
+			for _, node := range resource {
+				obj.Set(node.Type, node.Attribute)
+			}
+
+			expected := []string{}
+			for _, p := range engine.dump() {
+				if p.Expression.Eval(obj) {
+					expected = append(expected, p.Subject.UID)
+				}
+			}
+
+			req := &types.SearchRequest{Resource: resource, SubjectType: types.SubjectTypeAll}
+			subjects, partial := engine.search(context.Background(), req, 0, nil)
+			assert.False(GinkgoT(), partial)
+
+			uids := make([]string, 0, len(subjects))
+			for _, subject := range subjects {
+				uids = append(uids, subject.UID)
+			}
+			assert.ElementsMatch(GinkgoT(), expected, uids, "resource: %v", resource)
+		}
+	})
+})
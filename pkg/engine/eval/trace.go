@@ -0,0 +1,49 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+
+	"engine/pkg/types"
+)
+
+// evalWithTrace will eval the expression and record the result of each node
+// NOTE: 为了展示所有分支的计算结果, AND/OR 不会短路, 结果与 ExprCell.Eval 一致
+func evalWithTrace(expr *expression.ExprCell, data expression.ObjectSetInterface) types.EvalTrace {
+	trace := types.EvalTrace{
+		OP: string(expr.OP),
+	}
+
+	switch expr.OP {
+	case operator.AND, operator.OR:
+		trace.Content = make([]types.EvalTrace, 0, len(expr.Content))
+		trace.Result = expr.OP == operator.AND
+		for i := range expr.Content {
+			t := evalWithTrace(&expr.Content[i], data)
+			trace.Content = append(trace.Content, t)
+
+			if expr.OP == operator.AND {
+				trace.Result = trace.Result && t.Result
+			} else {
+				trace.Result = trace.Result || t.Result
+			}
+		}
+	default:
+		trace.Field = expr.Field
+		trace.Value = expr.Value
+		trace.ObjectValue = data.GetAttribute(expr.Field)
+		trace.Result = expr.Eval(data)
+	}
+	return trace
+}
@@ -0,0 +1,74 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package eval
+
+import (
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = Describe("Trace", func() {
+	var obj expression.ObjectSetInterface
+
+	BeforeEach(func() {
+		obj = expression.NewObjectSet()
+		obj.Set("host", map[string]interface{}{"id": "1", "os": "linux"})
+	})
+
+	It("binary operator", func() {
+		expr := expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}
+		trace := evalWithTrace(&expr, obj)
+		assert.True(GinkgoT(), trace.Result)
+		assert.Equal(GinkgoT(), "1", trace.ObjectValue)
+		assert.Empty(GinkgoT(), trace.Content)
+	})
+
+	It("AND", func() {
+		expr := expression.ExprCell{
+			OP: operator.AND,
+			Content: []expression.ExprCell{
+				{OP: operator.Eq, Field: "host.os", Value: "windows"},
+				{OP: operator.Eq, Field: "host.id", Value: "1"},
+			},
+		}
+		trace := evalWithTrace(&expr, obj)
+		assert.False(GinkgoT(), trace.Result)
+		assert.Len(GinkgoT(), trace.Content, 2)
+		assert.False(GinkgoT(), trace.Content[0].Result)
+		// no short circuit
+		assert.True(GinkgoT(), trace.Content[1].Result)
+		assert.Equal(GinkgoT(), expr.Eval(obj), trace.Result)
+	})
+
+	It("nested OR", func() {
+		expr := expression.ExprCell{
+			OP: operator.OR,
+			Content: []expression.ExprCell{
+				{OP: operator.Eq, Field: "host.id", Value: "2"},
+				{
+					OP: operator.AND,
+					Content: []expression.ExprCell{
+						{OP: operator.Eq, Field: "host.os", Value: "linux"},
+						{OP: operator.In, Field: "host.id", Value: []interface{}{"1", "3"}},
+					},
+				},
+			},
+		}
+		trace := evalWithTrace(&expr, obj)
+		assert.True(GinkgoT(), trace.Result)
+		assert.False(GinkgoT(), trace.Content[0].Result)
+		assert.True(GinkgoT(), trace.Content[1].Result)
+		assert.Equal(GinkgoT(), expr.Eval(obj), trace.Result)
+	})
+})
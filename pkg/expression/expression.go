@@ -21,10 +21,10 @@ import (
 	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
 
 	"engine/pkg/types"
+	"engine/pkg/util"
 )
 
 // FIXME: 这里应该合并 isSingleEqOrIn / isBkIAMPathStartsWith / isBKIAMPathStringContains
-// FIXME: 如果是单个number cmp, 也应该是simple的, 未来表达式中加入需要支持
 
 // isAny will check the expression, return true if only one expression with operator `any`
 func isAny(expr *expression.ExprCell) bool {
@@ -45,6 +45,17 @@ func isBkIAMPathStringContains(expr *expression.ExprCell) bool {
 	return expr.OP == operator.StringContains && strings.HasSuffix(expr.Field, types.BkIAMPathSuffix)
 }
 
+// isSingleNumberCompare will check the expression, return true if `obj.attr gt/gte/lt/lte number`
+func isSingleNumberCompare(expr *expression.ExprCell) bool {
+	switch expr.OP {
+	case operator.Gt, operator.Gte, operator.Lt, operator.Lte:
+		_, ok := util.ToFloat64(expr.Value)
+		return ok
+	default:
+		return false
+	}
+}
+
 // isAllOR will check the expression, return true if all the expression in content or nested expression are `OR`
 func isAllOR(expr *expression.ExprCell) bool {
 	// NOTE: single any already processed before
@@ -72,46 +83,42 @@ func isAllOR(expr *expression.ExprCell) bool {
 	return true
 }
 
-// sameObjectMergeableOPs ...
-var sameObjectMergeableOPs = map[operator.OP]bool{
-	operator.Eq:         true,
-	operator.In:         true,
-	operator.StartsWith: true,
+// docMergeableOPs ...
+var docMergeableOPs = map[operator.OP]bool{
+	operator.Eq:             true,
+	operator.In:             true,
+	operator.StartsWith:     true,
+	operator.StringContains: true,
 }
 
-// isSameObjectWithDifferentFields will check the expression,
-// return true if all OR content, the field's objects are the same
-func isSameObjectWithDifferentFields(expr *expression.ExprCell) bool {
+// isAllDocFieldsOR will check the expression,
+// return true if all OR content are eq / in / _bk_iam_path_ starts_with / _bk_iam_path_ string_contains
+// NOTE: 每个content在doc中都是独立的field(或同一个field的多个值), 任意一个命中即可,
+//
+//	所以field / 操作符 / 对象(资源类型) 都可以不同
+func isAllDocFieldsOR(expr *expression.ExprCell) bool {
 	if expr.OP != operator.OR {
 		return false
 	}
 
-	s := set.NewStringSet()
 	for _, c := range expr.Content {
-		// currently, only can merge into same object
 		// 1. eq
 		// 2. in
 		// 3. x._bk_iam_path_ starts_with
-		_, mergeable := sameObjectMergeableOPs[c.OP]
+		// 4. x._bk_iam_path_ string_contains
+		_, mergeable := docMergeableOPs[c.OP]
 		if !mergeable {
 			return false
 		}
 
 		// NOTE: 这里不允许, ._bk_iam_path_ 配置其他操作符
-		// 只支持starts_with  *._bk_iam_path_
-		if c.OP == operator.StartsWith && !strings.HasSuffix(c.Field, "._bk_iam_path_") {
+		// 只支持starts_with / string_contains  *._bk_iam_path_
+		if (c.OP == operator.StartsWith || c.OP == operator.StringContains) &&
+			!strings.HasSuffix(c.Field, types.BkIAMPathSuffix) {
 			return false
 		}
-
-		// TODO: 未来
-		//     - 其他操作符号怎么办? 目前 eq/in/starts_with特殊处理的
-		//     - 未来, field结构改变了, 会变成什么样子的?
-		parts := strings.Split(c.Field, ".")
-		s.Add(parts[0])
 	}
-
-	// size == 1 表示是同一个对象
-	return s.Size() == 1
+	return true
 }
 
 // flattenORExpr will flat the nested OR expression into flatten expression list.
@@ -195,7 +202,8 @@ func mergeORExpressions(exprs []expression.ExprCell) expression.ExprCell {
 			}
 		}
 	}
-	// TODO: 如果field出现两次并使用两个不同的operator(any除外, 那么这里无法处理)
+	// NOTE: 如果field出现两次并使用两个不同的operator, 会合并为两个content, 例如
+	//       x._bk_iam_path_ starts_with [...] or x._bk_iam_path_ string_contains [...]
 	if len(uniqFieldValues) == 1 {
 		for k, v := range uniqFieldValues {
 			parts := strings.Split(k, ":")
@@ -242,3 +250,46 @@ func flattenAndMergeAllOR(expr expression.ExprCell) expression.ExprCell {
 	mergedExpr := mergeORExpressions(flattenExprs)
 	return mergedExpr
 }
+
+// flattenANDExpr will flat the nested AND expression into flatten expression list.
+// e.g (A and B) and (C and D) => A and B and C and D
+func flattenANDExpr(expr expression.ExprCell) (exprs []expression.ExprCell) {
+	if expr.OP == operator.AND {
+		for _, c := range expr.Content {
+			exprs = append(exprs, flattenANDExpr(c)...)
+		}
+		return exprs
+	}
+
+	return []expression.ExprCell{expr}
+}
+
+// isDifferentFieldsAND will check the expression, return true if all the AND content are
+// eq / in / _bk_iam_path_ starts_with / _bk_iam_path_ string_contains with different fields
+// NOTE: 不同对象(包括跨系统资源依赖)的field在doc中都是独立的, 所以不要求是同一个对象
+// the input expr should be flattened AND expression!
+func isDifferentFieldsAND(expr *expression.ExprCell) bool {
+	if expr.OP != operator.AND || len(expr.Content) == 0 {
+		return false
+	}
+
+	fields := set.NewStringSet()
+	for _, c := range expr.Content {
+		if !(isSingleEqOrIn(&c) || isBkIAMPathStartsWith(&c) || isBkIAMPathStringContains(&c)) {
+			return false
+		}
+
+		// NOTE: string_contains 在doc中的field是 x._bk_iam_path_contains_, 与starts_with不冲突
+		field := c.Field
+		if c.OP == operator.StringContains {
+			field = types.ConvertBKIAMPathSuffixToBKIAMPathContainsSuffix(c.Field)
+		}
+
+		// 同一个field出现多次(例如 A.a in [1,2] and A.a in [2,3]), doc中无法表达, 需要eval
+		if fields.Has(field) {
+			return false
+		}
+		fields.Add(field)
+	}
+	return true
+}
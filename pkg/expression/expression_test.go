@@ -176,10 +176,10 @@ var _ = Describe("Expression", func() {
 		})
 	})
 
-	Describe("indexer.isSameObjectWithDifferentFields", func() {
+	Describe("indexer.isAllDocFieldsOR", func() {
 		It("not op.OR", func() {
-			assert.False(GinkgoT(), isSameObjectWithDifferentFields(&eqExpr))
-			assert.False(GinkgoT(), isSameObjectWithDifferentFields(&andExpr))
+			assert.False(GinkgoT(), isAllDocFieldsOR(&eqExpr))
+			assert.False(GinkgoT(), isAllDocFieldsOR(&andExpr))
 		})
 
 		Describe("is op.OR", func() {
@@ -200,7 +200,31 @@ var _ = Describe("Expression", func() {
 					},
 				}
 
-				assert.False(GinkgoT(), isSameObjectWithDifferentFields(&expr))
+				assert.True(GinkgoT(), isAllDocFieldsOR(&expr))
+			})
+
+			It("same field, different op", func() {
+				expr := expression.ExprCell{
+					OP:      operator.OR,
+					Content: []expression.ExprCell{startsWithExpr, stringContainsExpr, eqExpr},
+				}
+
+				assert.True(GinkgoT(), isAllDocFieldsOR(&expr))
+			})
+
+			It("string_contains field not _bk_iam_path_ ", func() {
+				expr := expression.ExprCell{
+					OP: operator.OR,
+					Content: []expression.ExprCell{
+						eqExpr,
+						{
+							OP:    operator.StringContains,
+							Field: "biz.name",
+							Value: "abc",
+						},
+					},
+				}
+				assert.False(GinkgoT(), isAllDocFieldsOR(&expr))
 			})
 
 			It("same object, not support op", func() {
@@ -219,7 +243,7 @@ var _ = Describe("Expression", func() {
 						},
 					},
 				}
-				assert.False(GinkgoT(), isSameObjectWithDifferentFields(&expr))
+				assert.False(GinkgoT(), isAllDocFieldsOR(&expr))
 			})
 
 			It("same object, starts_with field not _bk_iam_path_ ", func() {
@@ -238,7 +262,7 @@ var _ = Describe("Expression", func() {
 						},
 					},
 				}
-				assert.False(GinkgoT(), isSameObjectWithDifferentFields(&expr))
+				assert.False(GinkgoT(), isAllDocFieldsOR(&expr))
 			})
 
 			It("same object", func() {
@@ -258,7 +282,7 @@ var _ = Describe("Expression", func() {
 					},
 				}
 
-				assert.True(GinkgoT(), isSameObjectWithDifferentFields(&expr))
+				assert.True(GinkgoT(), isAllDocFieldsOR(&expr))
 			})
 		})
 	})
@@ -499,6 +523,44 @@ var _ = Describe("Expression", func() {
 	})
 
 	Describe("indexer.flattenAndMergeAllOR", func() {
+		It("mixed operators and objects", func() {
+			expr := expression.ExprCell{
+				OP: operator.OR,
+				Content: []expression.ExprCell{
+					startsWithExpr,
+					{
+						OP:      operator.OR,
+						Content: []expression.ExprCell{stringContainsExpr, eqExpr, inExpr},
+					},
+					{
+						OP:    operator.StartsWith,
+						Field: "host._bk_iam_path_",
+						Value: "/biz,2/",
+					},
+				},
+			}
+			result := flattenAndMergeAllOR(expr)
+
+			assert.Equal(GinkgoT(), operator.OR, result.OP)
+			assert.Len(GinkgoT(), result.Content, 3)
+			assert.Contains(GinkgoT(), result.Content, expression.ExprCell{
+				OP:    operator.StartsWith,
+				Field: "host._bk_iam_path_",
+				Value: []interface{}{"/biz,1/set,*/", "/biz,2/"},
+			})
+			assert.Contains(GinkgoT(), result.Content, expression.ExprCell{
+				OP:    operator.StringContains,
+				Field: "host._bk_iam_path_",
+				Value: []interface{}{"/biz,1/"},
+			})
+			assert.Contains(GinkgoT(), result.Content, expression.ExprCell{
+				OP:    operator.In,
+				Field: "biz.id",
+				Value: []interface{}{"123", "456"},
+			})
+			assert.True(GinkgoT(), isAllDocFieldsOR(&result))
+		})
+
 		It("not all OR", func() {
 			result := flattenAndMergeAllOR(andExpr)
 			assert.Equal(GinkgoT(), andExpr, result)
@@ -515,4 +577,110 @@ var _ = Describe("Expression", func() {
 			assert.Len(GinkgoT(), result.Content, 2)
 		})
 	})
+
+	Describe("indexer.isSingleNumberCompare", func() {
+		It("true", func() {
+			for _, op := range []operator.OP{operator.Gt, operator.Gte, operator.Lt, operator.Lte} {
+				expr := expression.ExprCell{OP: op, Field: "host.cpu_cores", Value: float64(8)}
+				assert.True(GinkgoT(), isSingleNumberCompare(&expr))
+			}
+		})
+
+		It("false", func() {
+			// the value is not a number
+			assert.False(GinkgoT(), isSingleNumberCompare(&gtExpr))
+			assert.False(GinkgoT(), isSingleNumberCompare(&eqExpr))
+			assert.False(GinkgoT(), isSingleNumberCompare(&andExpr))
+		})
+	})
+
+	Describe("indexer.flattenANDExpr", func() {
+		It("simple", func() {
+			exprs := flattenANDExpr(eqExpr)
+			assert.Equal(GinkgoT(), []expression.ExprCell{eqExpr}, exprs)
+		})
+
+		It("and nested", func() {
+			expr := expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{
+					andExpr,
+					inExpr,
+				},
+			}
+			exprs := flattenANDExpr(expr)
+			assert.Equal(GinkgoT(), []expression.ExprCell{eqExpr, startsWithExpr, inExpr}, exprs)
+		})
+	})
+
+	Describe("indexer.isDifferentFieldsAND", func() {
+		var hostIDExpr expression.ExprCell
+		BeforeEach(func() {
+			hostIDExpr = expression.ExprCell{
+				OP:    operator.In,
+				Field: "host.id",
+				Value: []interface{}{"1", "2"},
+			}
+		})
+
+		It("true", func() {
+			expr := expression.ExprCell{
+				OP:      operator.AND,
+				Content: []expression.ExprCell{hostIDExpr, startsWithExpr},
+			}
+			assert.True(GinkgoT(), isDifferentFieldsAND(&expr))
+		})
+
+		It("true, starts_with and string_contains of the same path", func() {
+			expr := expression.ExprCell{
+				OP:      operator.AND,
+				Content: []expression.ExprCell{hostIDExpr, startsWithExpr, stringContainsExpr},
+			}
+			assert.True(GinkgoT(), isDifferentFieldsAND(&expr))
+		})
+
+		It("false, not AND", func() {
+			assert.False(GinkgoT(), isDifferentFieldsAND(&orExpr))
+			assert.False(GinkgoT(), isDifferentFieldsAND(&eqExpr))
+		})
+
+		It("true, different objects", func() {
+			assert.True(GinkgoT(), isDifferentFieldsAND(&andExpr))
+		})
+
+		It("false, same field", func() {
+			expr := expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{hostIDExpr, {
+					OP:    operator.Eq,
+					Field: "host.id",
+					Value: "1",
+				}},
+			}
+			assert.False(GinkgoT(), isDifferentFieldsAND(&expr))
+		})
+
+		It("false, not support op", func() {
+			expr := expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{hostIDExpr, {
+					OP:    operator.Gt,
+					Field: "host.size",
+					Value: 1,
+				}},
+			}
+			assert.False(GinkgoT(), isDifferentFieldsAND(&expr))
+		})
+
+		It("false, nested OR", func() {
+			expr := expression.ExprCell{
+				OP: operator.AND,
+				Content: []expression.ExprCell{hostIDExpr, {
+					OP:      operator.OR,
+					Content: []expression.ExprCell{startsWithExpr, stringContainsExpr},
+				}},
+			}
+			assert.False(GinkgoT(), isDifferentFieldsAND(&expr))
+		})
+	})
 })
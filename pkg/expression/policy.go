@@ -14,6 +14,9 @@ package expression
 import (
 	"fmt"
 
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+
 	"engine/pkg/types"
 )
 
@@ -50,8 +53,9 @@ func SplitPoliciesWithExpressionType(policies []types.Policy) (
 		}
 
 		// 2. `biz.id eq 1` 及 `biz.id in [1,2,3]`;   `biz._bk_iam_path_ starts_with x` ;   `biz._bk_iam_path_ string_contains x`
+		//    `host.cpu_cores gte 8`, 单个数字比较
 		if isSingleEqOrIn(&p.Expression) || isBkIAMPathStartsWith(&p.Expression) ||
-			isBkIAMPathStringContains(&p.Expression) {
+			isBkIAMPathStringContains(&p.Expression) || isSingleNumberCompare(&p.Expression) {
 			p.ExpressionType = types.Doc
 			esPolicies = append(esPolicies, &p)
 			continue
@@ -70,10 +74,25 @@ func SplitPoliciesWithExpressionType(policies []types.Policy) (
 				continue
 			}
 
-			// 3.2 same object with different values in all OR content
-			// file相同, op为 in startwith _bk_iam_path_也可以搜索
+			// 3.2 all OR content are eq / in / _bk_iam_path_ starts_with / _bk_iam_path_ string_contains
+			// field / 操作符 / 对象可以不同, 都存储为doc的field, 任意一个命中即可
 			// 注意这里有个前提, isAllOR, 然后打平->合并后的表达式, 才能保证正确性
-			if isSameObjectWithDifferentFields(&expr) {
+			if isAllDocFieldsOR(&expr) {
+				p.Expression = expr
+				p.ExpressionType = types.Doc
+				esPolicies = append(esPolicies, &p)
+				continue
+			}
+		}
+
+		// 4. 如果是 `(A and B) and C`, 打平后都是不同field的 eq / in / _bk_iam_path_ starts_with / string_contains
+		// 存储为doc, 检索时需要所有field都命中; 跨系统资源依赖的field存储在资源类型所属的系统下
+		if p.Expression.OP == operator.AND {
+			expr := expression.ExprCell{
+				OP:      operator.AND,
+				Content: flattenANDExpr(p.Expression),
+			}
+			if isDifferentFieldsAND(&expr) {
 				p.Expression = expr
 				p.ExpressionType = types.Doc
 				esPolicies = append(esPolicies, &p)
@@ -82,7 +101,7 @@ func SplitPoliciesWithExpressionType(policies []types.Policy) (
 		}
 
 		// 暂时不支持的表达式, 全部需要执行
-		// 1. 所有包含and, 包括跨系统资源依赖的 and 关系
+		// 1. 其他包含and的表达式
 		p.ExpressionType = types.Eval
 		evalPolicies = append(evalPolicies, &p)
 	}
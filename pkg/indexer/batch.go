@@ -0,0 +1,263 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+// batchSearchPoolSize the max count of the requests searched concurrently in one batch search
+const batchSearchPoolSize = 8
+
+// BatchSearch return the subjects and the status of each request
+// NOTE: 单个请求失败/超时不影响其它请求, 失败的请求返回空的subjects, eval超时的请求返回部分subjects
+func (i *Index) BatchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([][]types.Subject, []types.BatchSearchItemStatus) {
+	results, statuses := i.cachedBatchSearch(ctx, requests, entry)
+
+	for idx, req := range requests {
+		if !req.ExpandGroups || statuses[idx].Status == types.BatchSearchStatusError {
+			continue
+		}
+
+		subjects, err := i.expandGroupMembers(ctx, req, results[idx])
+		if err != nil {
+			results[idx] = []types.Subject{}
+			statuses[idx] = types.BatchSearchItemStatus{
+				Status:  types.BatchSearchStatusError,
+				Message: err.Error(),
+				Phases:  statuses[idx].Phases,
+			}
+			continue
+		}
+		results[idx] = subjects
+	}
+
+	return results, statuses
+}
+
+// cachedBatchSearch will search the requests not in the cache, only the results of status ok will be cached
+func (i *Index) cachedBatchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([][]types.Subject, []types.BatchSearchItemStatus) {
+	if !i.useSearchCache(entry) {
+		return i.batchSearch(ctx, requests, entry)
+	}
+
+	results := make([][]types.Subject, len(requests))
+	statuses := make([]types.BatchSearchItemStatus, len(requests))
+
+	missingIndexes := make([]int, 0, len(requests))
+	missingRequests := make([]*types.SearchRequest, 0, len(requests))
+	missingKeys := make([]*SearchCacheKey, 0, len(requests))
+	for idx, req := range requests {
+		key := i.SearchCache.Key(ctx, req)
+		if subjects, ok := i.SearchCache.Get(ctx, key); ok {
+			results[idx] = subjects
+			statuses[idx] = newBatchSearchItemStatus(
+				types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseDone}, nil,
+			)
+			continue
+		}
+
+		missingIndexes = append(missingIndexes, idx)
+		missingRequests = append(missingRequests, req)
+		missingKeys = append(missingKeys, key)
+	}
+
+	if len(missingRequests) == 0 {
+		return results, statuses
+	}
+
+	missingResults, missingStatuses := i.batchSearch(ctx, missingRequests, entry)
+	for j, idx := range missingIndexes {
+		results[idx] = missingResults[j]
+		statuses[idx] = missingStatuses[j]
+		if missingStatuses[j].Status == types.BatchSearchStatusOK {
+			i.SearchCache.Set(ctx, missingKeys[j], missingResults[j])
+		}
+	}
+	return results, statuses
+}
+
+// batchSearch return the subjects and the status of each request,
+// the identical requests will be searched only once, and the eval part will be searched concurrently
+func (i *Index) batchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([][]types.Subject, []types.BatchSearchItemStatus) {
+	results := make([][]types.Subject, len(requests))
+	statuses := make([]types.BatchSearchItemStatus, len(requests))
+	if len(requests) == 0 {
+		return results, statuses
+	}
+
+	// NOTE: debug时需要记录每个请求的检索过程, 不去重
+	uniqueRequests, uniqueIndexes := dedupeSearchRequests(requests, entry == nil)
+
+	// NOTE: 相同的请求使用最大的超时时间, msearch使用所有请求中最大的超时时间
+	uniqueTimeouts := make([]time.Duration, len(uniqueRequests))
+	var maxTimeout time.Duration
+	for idx, j := range uniqueIndexes {
+		timeout := searchTimeout(&i.SearchTimeout, requests[idx], true)
+		if timeout > uniqueTimeouts[j] {
+			uniqueTimeouts[j] = timeout
+		}
+		if timeout > maxTimeout {
+			maxTimeout = timeout
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxTimeout)
+	defer cancel()
+
+	// NOTE: msearch失败时, 每个请求单独查询doc引擎, 只有失败的请求返回错误
+	docResults, err := i.DocEngine.BatchSearch(ctx, uniqueRequests, entry)
+	if err != nil {
+		debug.WithError(entry, err)
+		docResults = nil
+	}
+
+	uniqueResults := make([][]types.Subject, len(uniqueRequests))
+	uniqueStatuses := make([]types.BatchSearchItemStatus, len(uniqueRequests))
+
+	poolSize := batchSearchPoolSize
+	if len(uniqueRequests) < poolSize {
+		poolSize = len(uniqueRequests)
+	}
+
+	var wg sync.WaitGroup
+	p, _ := ants.NewPoolWithFunc(poolSize, func(v interface{}) {
+		defer wg.Done()
+
+		j := v.(int)
+		var docResult types.SearchResult
+		if docResults != nil {
+			docResult = docResults[j]
+		}
+
+		uniqueResults[j], uniqueStatuses[j] = i.batchSearchItem(
+			ctx, uniqueRequests[j], uniqueTimeouts[j], docResult, debug.GetSubEntryByIndex(entry, j),
+		)
+	})
+	defer p.Release()
+
+	for j := range uniqueRequests {
+		wg.Add(1)
+		_ = p.Invoke(j)
+	}
+	wg.Wait()
+
+	for idx, j := range uniqueIndexes {
+		results[idx] = uniqueResults[j]
+		statuses[idx] = uniqueStatuses[j]
+	}
+	return results, statuses
+}
+
+// batchSearchItem search one request of the batch search within the timeout,
+// search the doc engine if the doc result is nil
+func (i *Index) batchSearchItem(
+	ctx context.Context,
+	req *types.SearchRequest,
+	timeout time.Duration,
+	docResult types.SearchResult,
+	entry *debug.Entry,
+) ([]types.Subject, types.BatchSearchItemStatus) {
+	debug.WithValue(entry, "timeout", timeout.String())
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if docResult == nil {
+		var err error
+		docResult, err = i.DocEngine.Search(ctx, req, entry)
+		if err != nil {
+			debug.WithError(entry, err)
+			phases := types.SearchPhases{Doc: errorPhase(ctx, err), Eval: types.SearchPhaseSkipped}
+			return []types.Subject{}, newBatchSearchItemStatus(phases, err)
+		}
+	}
+
+	subjects, evalPhase, err := i.searchWithDocResult(ctx, req, docResult, entry)
+	if err != nil {
+		debug.WithError(entry, err)
+		phases := types.SearchPhases{Doc: types.SearchPhaseDone, Eval: errorPhase(ctx, err)}
+		return []types.Subject{}, newBatchSearchItemStatus(phases, err)
+	}
+
+	return subjects, newBatchSearchItemStatus(types.SearchPhases{Doc: types.SearchPhaseDone, Eval: evalPhase}, nil)
+}
+
+// newBatchSearchItemStatus return the status of the request by the phases, timeout if any phase timeout
+func newBatchSearchItemStatus(phases types.SearchPhases, err error) types.BatchSearchItemStatus {
+	status := types.BatchSearchItemStatus{
+		Status:  types.BatchSearchStatusOK,
+		Partial: phases.Partial(),
+		Phases:  phases,
+	}
+
+	switch {
+	case phases.Doc == types.SearchPhaseTimeout || phases.Eval == types.SearchPhaseTimeout:
+		status.Status = types.BatchSearchStatusTimeout
+	case err != nil:
+		status.Status = types.BatchSearchStatusError
+	}
+
+	if err != nil {
+		status.Message = err.Error()
+	} else if status.Partial {
+		status.Message = "eval timeout, the subjects are partial"
+	}
+	return status
+}
+
+// dedupeSearchRequests return the unique requests, and the index of the unique request for each request
+func dedupeSearchRequests(requests []*types.SearchRequest, dedupe bool) ([]*types.SearchRequest, []int) {
+	indexes := make([]int, len(requests))
+	if !dedupe {
+		for idx := range requests {
+			indexes[idx] = idx
+		}
+		return requests, indexes
+	}
+
+	uniqueRequests := make([]*types.SearchRequest, 0, len(requests))
+	keyIndexes := make(map[string]int, len(requests))
+	for idx, req := range requests {
+		key := req.System + ":" + req.Action.ID + ":" + strconv.FormatInt(req.NowTimestamp, 10) + ":" +
+			searchRequestHash(req)
+
+		j, ok := keyIndexes[key]
+		if !ok {
+			j = len(uniqueRequests)
+			keyIndexes[key] = j
+			uniqueRequests = append(uniqueRequests, req)
+		}
+		indexes[idx] = j
+	}
+	return uniqueRequests, indexes
+}
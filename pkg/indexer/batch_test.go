@@ -0,0 +1,244 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+// batchTestDocEngine the msearch always fail, the search of the fail action fail
+type batchTestDocEngine struct {
+	types.DocEngine
+
+	failAction  string
+	searchCount int64
+}
+
+func (e *batchTestDocEngine) BatchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SearchResult, error) {
+	return nil, errors.New("msearch fail")
+}
+
+func (e *batchTestDocEngine) Search(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) (types.SearchResult, error) {
+	atomic.AddInt64(&e.searchCount, 1)
+	if req.Action.ID == e.failAction {
+		return nil, errors.New("search fail")
+	}
+	return e.DocEngine.Search(ctx, req, entry)
+}
+
+var _ = Describe("BatchSearch", func() {
+	newRequest := func(action string) *types.SearchRequest {
+		return &types.SearchRequest{
+			System: "bk_cmdb",
+			Action: types.Action{ID: action},
+			Resource: []types.ResourceNode{
+				{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+			},
+			SubjectType:  types.SubjectTypeAll,
+			Limit:        10,
+			NowTimestamp: 100,
+		}
+	}
+
+	Describe("dedupeSearchRequests", func() {
+		It("dedupe the identical requests", func() {
+			requests := []*types.SearchRequest{
+				newRequest("view_host"), newRequest("edit_host"), newRequest("view_host"),
+			}
+
+			uniqueRequests, indexes := dedupeSearchRequests(requests, true)
+			assert.Len(GinkgoT(), uniqueRequests, 2)
+			assert.Equal(GinkgoT(), []int{0, 1, 0}, indexes)
+		})
+
+		It("different timestamp", func() {
+			req := newRequest("view_host")
+			req.NowTimestamp = 200
+
+			uniqueRequests, indexes := dedupeSearchRequests([]*types.SearchRequest{newRequest("view_host"), req}, true)
+			assert.Len(GinkgoT(), uniqueRequests, 2)
+			assert.Equal(GinkgoT(), []int{0, 1}, indexes)
+		})
+
+		It("no dedupe", func() {
+			requests := []*types.SearchRequest{newRequest("view_host"), newRequest("view_host")}
+
+			uniqueRequests, indexes := dedupeSearchRequests(requests, false)
+			assert.Len(GinkgoT(), uniqueRequests, 2)
+			assert.Equal(GinkgoT(), []int{0, 1}, indexes)
+		})
+	})
+
+	Describe("Index", func() {
+		var idx *Index
+		var docEngine *batchTestDocEngine
+		logger := logrus.NewEntry(logrus.New())
+
+		BeforeEach(func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			var err error
+			idx, err = NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+
+			newPolicy := func(id int64, action string, expr expression.ExprCell) types.Policy {
+				return types.Policy{
+					ID:         id,
+					System:     "bk_cmdb",
+					Actions:    []types.Action{{ID: action}},
+					Subject:    types.Subject{Type: "user", ID: "admin"},
+					Expression: expr,
+					ExpiredAt:  200,
+					UpdatedAt:  100,
+				}
+			}
+			idx.BulkUpsert([]types.Policy{
+				// doc policy
+				newPolicy(1, "view_host", expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}),
+				// eval policy
+				newPolicy(2, "edit_host", expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: "1"}),
+			}, logger)
+
+			docEngine = &batchTestDocEngine{DocEngine: idx.DocEngine, failAction: "delete_host"}
+			idx.DocEngine = docEngine
+		})
+
+		It("per-item status, fallback to search each request", func() {
+			results, statuses := idx.BatchSearch(context.Background(), []*types.SearchRequest{
+				newRequest("view_host"), newRequest("delete_host"), newRequest("edit_host"), newRequest("view_host"),
+			}, nil)
+
+			assert.Len(GinkgoT(), results, 4)
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[0]))
+			assert.Equal(GinkgoT(), types.BatchSearchStatusOK, statuses[0].Status)
+			assert.Equal(GinkgoT(), types.SearchPhaseDone, statuses[0].Phases.Doc)
+
+			assert.Empty(GinkgoT(), results[1])
+			assert.NotNil(GinkgoT(), results[1])
+			assert.Equal(GinkgoT(), types.BatchSearchStatusError, statuses[1].Status)
+			assert.Equal(GinkgoT(), "search fail", statuses[1].Message)
+			assert.Equal(GinkgoT(), types.SearchPhases{
+				Doc: types.SearchPhaseError, Eval: types.SearchPhaseSkipped,
+			}, statuses[1].Phases)
+
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[2]))
+			assert.Equal(GinkgoT(), types.BatchSearchStatusOK, statuses[2].Status)
+
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[3]))
+			assert.Equal(GinkgoT(), types.BatchSearchStatusOK, statuses[3].Status)
+
+			// the identical requests are searched only once
+			assert.Equal(GinkgoT(), int64(3), atomic.LoadInt64(&docEngine.searchCount))
+		})
+
+		It("timeout", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, statuses := idx.BatchSearch(ctx, []*types.SearchRequest{newRequest("delete_host")}, nil)
+			assert.Equal(GinkgoT(), types.BatchSearchStatusTimeout, statuses[0].Status)
+			assert.Equal(GinkgoT(), types.SearchPhaseTimeout, statuses[0].Phases.Doc)
+			assert.False(GinkgoT(), statuses[0].Partial)
+		})
+
+		It("multi actions", func() {
+			idx.DocEngine = docEngine.DocEngine
+
+			req := newRequest("")
+			req.Actions = []types.Action{{ID: "view_host"}, {ID: "edit_host"}, {ID: "delete_host"}}
+			requests := req.ActionRequests()
+			assert.Len(GinkgoT(), requests, 3)
+			assert.Equal(GinkgoT(), "edit_host", requests[1].Action.ID)
+			assert.Empty(GinkgoT(), requests[1].Actions)
+
+			results, statuses := idx.BatchSearch(context.Background(), requests, nil)
+			// doc policy
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[0]))
+			// eval policy
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[1]))
+			assert.Empty(GinkgoT(), results[2])
+			for _, status := range statuses {
+				assert.Equal(GinkgoT(), types.BatchSearchStatusOK, status.Status)
+			}
+		})
+
+		It("resource actions", func() {
+			idx.DocEngine = docEngine.DocEngine
+
+			req := &types.ResourceActionsSearchRequest{
+				System:       "bk_cmdb",
+				Resource:     newRequest("").Resource,
+				SubjectType:  types.SubjectTypeAll,
+				Limit:        10,
+				NowTimestamp: 100,
+			}
+			// view_host in doc engine, edit_host in eval engine
+			actions, err := idx.ListActionsByResource(req.System, req.Resource)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), []string{"edit_host", "view_host"}, actions)
+
+			results, _ := idx.BatchSearch(context.Background(), req.ActionRequests(actions), nil)
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[0]))
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[1]))
+
+			actions, err = idx.ListActionsByResource("bk_job", req.Resource)
+			assert.NoError(GinkgoT(), err)
+			assert.Empty(GinkgoT(), actions)
+		})
+
+		It("search phases", func() {
+			idx.DocEngine = docEngine.DocEngine
+
+			req := newRequest("edit_host")
+			req.TimeoutMs = 1000
+			subjects, phases, err := idx.Search(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(subjects))
+			assert.Equal(GinkgoT(), types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseDone}, phases)
+			assert.False(GinkgoT(), phases.Partial())
+
+			// reach the limit by the doc engine, the eval is skipped
+			req = newRequest("view_host")
+			req.Limit = 1
+			_, phases, err = idx.Search(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseSkipped}, phases)
+		})
+	})
+})
@@ -0,0 +1,273 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/redis"
+	"engine/pkg/types"
+	"engine/pkg/util"
+)
+
+const (
+	defaultSearchCacheExpiration      = 10 * time.Second
+	defaultSearchCacheRedisExpiration = 60 * time.Second
+
+	searchCacheRedisKeyPrefix = "bk_iam_search_engine:search:"
+)
+
+// SearchCache the cache of search results
+// NOTE:
+//  1. 缓存key中带有 system+action 的版本号, 策略变更时版本号+1, 旧版本的缓存不会再被访问, 等待过期即可
+//  2. 检索前读取版本号, 检索过程中发生了变更, 结果会写入旧版本的key, 不会读到旧的结果
+//  3. 缓存的是展开用户组成员之前的结果, 用户组成员由本地的成员索引实时展开
+//  4. 结果中的过期策略只在查询时过滤, 缓存过期时间内可能返回刚过期的subject, 所以过期时间不宜过长
+//  5. 开启redis后, redis中的版本号由各副本的策略变更共同维护; 各副本同步策略的时机不同,
+//     可能短暂读到其他副本写入的旧结果, 由过期时间兜底
+type SearchCache struct {
+	local memory.Cache
+
+	// the global version, increased when the system actions changed unknown
+	version int64
+	// system:action => *int64
+	versions sync.Map
+
+	redisEnabled    bool
+	redisExpiration time.Duration
+}
+
+// NewSearchCache ...
+func NewSearchCache(cfg *config.SearchCache) *SearchCache {
+	expiration := defaultSearchCacheExpiration
+	if cfg.Expiration > 0 {
+		expiration = time.Duration(cfg.Expiration) * time.Second
+	}
+
+	redisExpiration := defaultSearchCacheRedisExpiration
+	if cfg.RedisExpiration > 0 {
+		redisExpiration = time.Duration(cfg.RedisExpiration) * time.Second
+	}
+
+	return &SearchCache{
+		// NOTE: 只使用 DirectGet / Set, 不需要 retrieveFunc
+		local: memory.NewCache("search_results", false, func(key cache.Key) (interface{}, error) {
+			return nil, errors.New("search results should not be retrieved by cache")
+		}, expiration),
+		redisEnabled:    cfg.RedisEnabled,
+		redisExpiration: redisExpiration,
+	}
+}
+
+// SearchCacheKey the keys of the request with the versions when searching
+type SearchCacheKey struct {
+	local string
+	redis string
+}
+
+// Key return the cache keys of the request, should be called before searching
+func (c *SearchCache) Key(ctx context.Context, req *types.SearchRequest) *SearchCacheKey {
+	hash := searchRequestHash(req)
+
+	key := &SearchCacheKey{
+		local: fmt.Sprintf(
+			"%s:%s:%d:%d:%s",
+			req.System, req.Action.ID, atomic.LoadInt64(&c.version), c.actionVersion(req.System, req.Action.ID), hash,
+		),
+	}
+
+	if client := c.redisClient(); client != nil {
+		versions, err := client.MGet(
+			ctx, redisVersionKey("", ""), redisVersionKey(req.System, req.Action.ID),
+		).Result()
+		if err != nil {
+			log.WithError(err).Warn("get search cache versions from redis fail")
+			return key
+		}
+
+		key.redis = fmt.Sprintf(
+			"%sresult:%s:%s:%v:%v:%s",
+			searchCacheRedisKeyPrefix, req.System, req.Action.ID, versions[0], versions[1], hash,
+		)
+	}
+	return key
+}
+
+// Get return the cached subjects, try local cache first, then redis
+func (c *SearchCache) Get(ctx context.Context, key *SearchCacheKey) ([]types.Subject, bool) {
+	if value, ok := c.local.DirectGet(cache.NewStringKey(key.local)); ok {
+		return value.([]types.Subject), true
+	}
+
+	client := c.redisClient()
+	if client == nil || key.redis == "" {
+		return nil, false
+	}
+
+	data, err := client.Get(ctx, key.redis).Bytes()
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			log.WithError(err).Warn("get search cache from redis fail")
+		}
+		return nil, false
+	}
+
+	var subjects []types.Subject
+	if err = jsoniter.Unmarshal(data, &subjects); err != nil {
+		log.WithError(err).Warn("unmarshal search cache from redis fail")
+		return nil, false
+	}
+
+	c.local.Set(cache.NewStringKey(key.local), subjects)
+	return subjects, true
+}
+
+// Set ...
+func (c *SearchCache) Set(ctx context.Context, key *SearchCacheKey, subjects []types.Subject) {
+	c.local.Set(cache.NewStringKey(key.local), subjects)
+
+	client := c.redisClient()
+	if client == nil || key.redis == "" {
+		return
+	}
+
+	data, err := jsoniter.Marshal(subjects)
+	if err != nil {
+		log.WithError(err).Warn("marshal search cache fail")
+		return
+	}
+
+	if err = client.Set(ctx, key.redis, data, c.redisExpiration).Err(); err != nil {
+		log.WithError(err).Warn("set search cache to redis fail")
+	}
+}
+
+// Invalidate will invalidate the caches of the system actions
+func (c *SearchCache) Invalidate(actions []types.SystemAction) {
+	if len(actions) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(actions))
+	for _, action := range actions {
+		atomic.AddInt64(c.actionVersionPtr(action.System, action.Action), 1)
+		keys = append(keys, redisVersionKey(action.System, action.Action))
+	}
+
+	c.incrRedisVersions(keys)
+}
+
+// InvalidateAll will invalidate all the caches, used when the system actions changed are unknown
+func (c *SearchCache) InvalidateAll() {
+	atomic.AddInt64(&c.version, 1)
+
+	c.incrRedisVersions([]string{redisVersionKey("", "")})
+}
+
+func (c *SearchCache) incrRedisVersions(keys []string) {
+	client := c.redisClient()
+	if client == nil {
+		return
+	}
+
+	_, err := client.Pipelined(context.Background(), func(pipe goredis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Incr(context.Background(), key)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("increase search cache versions in redis fail")
+	}
+}
+
+func (c *SearchCache) actionVersionPtr(system, action string) *int64 {
+	version, _ := c.versions.LoadOrStore(system+":"+action, new(int64))
+	return version.(*int64)
+}
+
+func (c *SearchCache) actionVersion(system, action string) int64 {
+	version, ok := c.versions.Load(system + ":" + action)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(version.(*int64))
+}
+
+// redisClient return nil if redis disabled or not initialized
+func (c *SearchCache) redisClient() *goredis.Client {
+	if !c.redisEnabled {
+		return nil
+	}
+	return redis.GetDefaultMQRedisClient()
+}
+
+// redisVersionKey return the key of the global version if system and action are empty
+func redisVersionKey(system, action string) string {
+	if system == "" && action == "" {
+		return searchCacheRedisKeyPrefix + "version"
+	}
+	return searchCacheRedisKeyPrefix + "version:" + system + ":" + action
+}
+
+// searchRequestHash return the hash of the normalized request, system and action are not included
+func searchRequestHash(req *types.SearchRequest) string {
+	// NOTE: 同类型的资源节点, eval时后面的覆盖前面的, 只按类型稳定排序
+	resource := make(types.Resource, len(req.Resource))
+	copy(resource, req.Resource)
+	sort.SliceStable(resource, func(i, j int) bool {
+		return resource[i].Type < resource[j].Type
+	})
+
+	templateIDs := make([]int64, len(req.TemplateIDs))
+	copy(templateIDs, req.TemplateIDs)
+	sort.Slice(templateIDs, func(i, j int) bool {
+		return templateIDs[i] < templateIDs[j]
+	})
+
+	var subjectUIDs []string
+	if uidSet := req.SubjectUIDSet(); uidSet != nil {
+		subjectUIDs = uidSet.ToSlice()
+		sort.Strings(subjectUIDs)
+	}
+
+	normalized := types.H{
+		"subject_type": req.SearchSubjectType(),
+		"limit":        strconv.Itoa(req.Limit),
+		"resource":     resource,
+		// NOTE: with_policies 的结果包含策略信息, 需要区分缓存
+		"with_policies":     req.WithPolicies,
+		"template_ids":      templateIDs,
+		"exclude_templates": req.ExcludeTemplates,
+		"subjects":          subjectUIDs,
+		// NOTE: 指定了候选subjects时, expand_groups 会同时返回非候选的用户组用于展开, 结果不同需要区分缓存
+		"expand_groups": subjectUIDs != nil && req.ExpandGroups && req.SubjectType != types.SubjectTypeGroup,
+	}
+
+	// NOTE: 需要对map的key排序, 保证同样的请求序列化结果一致
+	data, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(normalized)
+	return util.GetBytesMD5Hash(data)
+}
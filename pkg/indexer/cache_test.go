@@ -0,0 +1,232 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/types"
+)
+
+var _ = Describe("SearchCache", func() {
+	newRequest := func(action string) *types.SearchRequest {
+		return &types.SearchRequest{
+			System: "bk_cmdb",
+			Action: types.Action{ID: action},
+			Resource: []types.ResourceNode{
+				{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1", "os": "linux"}},
+			},
+			SubjectType:  types.SubjectTypeAll,
+			NowTimestamp: 100,
+		}
+	}
+
+	Describe("searchRequestHash", func() {
+		It("same for normalized request", func() {
+			req1 := newRequest("view_host")
+			req1.Resource = append(req1.Resource, types.ResourceNode{
+				System: "bk_cmdb", Type: "biz", ID: "2", Attribute: map[string]interface{}{"id": "2"},
+			})
+			req2 := newRequest("view_host")
+			req2.Resource = append(types.Resource{{
+				System: "bk_cmdb", Type: "biz", ID: "2", Attribute: map[string]interface{}{"id": "2"},
+			}}, req2.Resource...)
+			req2.Resource[1].Attribute = map[string]interface{}{"os": "linux", "id": "1"}
+
+			assert.Equal(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+		})
+
+		It("different", func() {
+			req1 := newRequest("view_host")
+			req2 := newRequest("view_host")
+			req2.Limit = 10
+			assert.NotEqual(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+
+			req2 = newRequest("view_host")
+			req2.SubjectType = types.SubjectTypeUser
+			assert.NotEqual(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+
+			req2 = newRequest("view_host")
+			req2.WithPolicies = true
+			assert.NotEqual(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+
+			req2 = newRequest("view_host")
+			req2.TemplateIDs = []int64{1}
+			assert.NotEqual(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+		})
+
+		It("expand groups share the cache of subject type all", func() {
+			req1 := newRequest("view_host")
+			req2 := newRequest("view_host")
+			req2.SubjectType = types.SubjectTypeUser
+			req2.ExpandGroups = true
+			assert.Equal(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+		})
+
+		It("expand groups with candidate subjects", func() {
+			req1 := newRequest("view_host")
+			req1.Subjects = []types.Subject{{Type: "user", ID: "admin"}}
+			req2 := newRequest("view_host")
+			req2.Subjects = []types.Subject{{Type: "user", ID: "admin"}}
+			req2.ExpandGroups = true
+			assert.NotEqual(GinkgoT(), searchRequestHash(req1), searchRequestHash(req2))
+		})
+	})
+
+	Describe("invalidate", func() {
+		var c *SearchCache
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			c = NewSearchCache(&config.SearchCache{Enabled: true})
+		})
+
+		It("by system action", func() {
+			viewReq, editReq := newRequest("view_host"), newRequest("edit_host")
+			viewKey, editKey := c.Key(ctx, viewReq), c.Key(ctx, editReq)
+			c.Set(ctx, viewKey, []types.Subject{{UID: "user:admin"}})
+			c.Set(ctx, editKey, []types.Subject{{UID: "user:tom"}})
+
+			c.Invalidate([]types.SystemAction{{System: "bk_cmdb", Action: "view_host"}})
+
+			_, ok := c.Get(ctx, c.Key(ctx, viewReq))
+			assert.False(GinkgoT(), ok)
+			subjects, ok := c.Get(ctx, c.Key(ctx, editReq))
+			assert.True(GinkgoT(), ok)
+			assert.Equal(GinkgoT(), []types.Subject{{UID: "user:tom"}}, subjects)
+		})
+
+		It("all", func() {
+			req := newRequest("view_host")
+			c.Set(ctx, c.Key(ctx, req), []types.Subject{{UID: "user:admin"}})
+
+			c.InvalidateAll()
+
+			_, ok := c.Get(ctx, c.Key(ctx, req))
+			assert.False(GinkgoT(), ok)
+		})
+
+		It("the result searched before invalidation will not be read", func() {
+			req := newRequest("view_host")
+			key := c.Key(ctx, req)
+
+			c.Invalidate([]types.SystemAction{{System: "bk_cmdb", Action: "view_host"}})
+			c.Set(ctx, key, []types.Subject{{UID: "user:admin"}})
+
+			_, ok := c.Get(ctx, c.Key(ctx, req))
+			assert.False(GinkgoT(), ok)
+		})
+	})
+
+	Describe("Index with cache", func() {
+		var idx *Index
+		logger := logrus.NewEntry(logrus.New())
+
+		newPolicy := func(id int64, action, subjectID, hostID string) types.Policy {
+			return types.Policy{
+				ID:         id,
+				System:     "bk_cmdb",
+				Actions:    []types.Action{{ID: action}},
+				Subject:    types.Subject{Type: "user", ID: subjectID},
+				Expression: expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: hostID},
+				ExpiredAt:  200,
+				UpdatedAt:  100,
+			}
+		}
+		search := func(action string) []string {
+			subjects, _, err := idx.Search(context.Background(), newRequest(action), nil)
+			assert.NoError(GinkgoT(), err)
+			return uidsOf(subjects)
+		}
+
+		BeforeEach(func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			var err error
+			idx, err = NewIndex(&config.Index{
+				Engine:      config.IndexEngineMemory,
+				SearchCache: config.SearchCache{Enabled: true},
+			})
+			assert.NoError(GinkgoT(), err)
+			idx.BulkUpsert([]types.Policy{
+				newPolicy(1, "view_host", "admin", "1"),
+				newPolicy(2, "edit_host", "admin", "1"),
+			}, logger)
+		})
+
+		It("hit the cache until the action changed", func() {
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("view_host"))
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("edit_host"))
+
+			// change the engine directly, the cache is not invalidated
+			p := newPolicy(3, "view_host", "tom", "1")
+			p.ExpressionType = types.Doc
+			_ = p.FillUniqueFields()
+			_ = idx.DocEngine.BulkAdd([]*types.Policy{&p})
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("view_host"))
+
+			idx.BulkUpsert([]types.Policy{newPolicy(4, "view_host", "jerry", "1")}, logger)
+			assert.ElementsMatch(GinkgoT(), []string{"user:admin", "user:tom", "user:jerry"}, search("view_host"))
+		})
+
+		It("invalidate the old action by upsert", func() {
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("view_host"))
+
+			// the action of policy 1 changed from view_host to delete_host
+			idx.BulkUpsert([]types.Policy{newPolicy(1, "delete_host", "admin", "1")}, logger)
+			assert.Empty(GinkgoT(), search("view_host"))
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("delete_host"))
+		})
+
+		It("invalidate by delete", func() {
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("view_host"))
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("edit_host"))
+
+			idx.BulkDelete([]int64{1}, logger)
+			assert.Empty(GinkgoT(), search("view_host"))
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("edit_host"))
+
+			idx.BulkDeleteBySubjects(200, []types.Subject{{Type: "user", ID: "admin"}}, logger)
+			assert.Empty(GinkgoT(), search("edit_host"))
+		})
+
+		It("batch search", func() {
+			assert.Equal(GinkgoT(), []string{"user:admin"}, search("view_host"))
+
+			idx.BulkDelete([]int64{2}, logger)
+			results, statuses := idx.BatchSearch(
+				context.Background(),
+				[]*types.SearchRequest{newRequest("view_host"), newRequest("edit_host")},
+				nil,
+			)
+			assert.Equal(GinkgoT(), []string{"user:admin"}, uidsOf(results[0]))
+			assert.Empty(GinkgoT(), results[1])
+			for _, status := range statuses {
+				assert.Equal(GinkgoT(), types.BatchSearchStatusOK, status.Status)
+			}
+		})
+	})
+})
@@ -15,12 +15,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
 	log "github.com/sirupsen/logrus"
 
+	"engine/pkg/cache/impls"
 	"engine/pkg/client"
+	"engine/pkg/components"
 	"engine/pkg/config"
 	"engine/pkg/engine/doc"
 	"engine/pkg/engine/eval"
@@ -29,10 +32,27 @@ import (
 	"engine/pkg/types"
 )
 
+// defaultPageSize the page size of cursor search if no limit
+const defaultPageSize = 100
+
+// expiredAtLookupBatchSize the max subjects of one doc expired_at query by subjects, less than the aggregation size
+const expiredAtLookupBatchSize = 1000
+
+// matchedPoliciesBatchSize the max subjects of one policies query by subjects, for the search with_policies
+const matchedPoliciesBatchSize = 1000
+
 // Index ...
 type Index struct {
-	EsEngine   types.Engine
+	DocEngine  types.DocEngine
 	EvalEngine types.Engine
+
+	GroupMemberIndex *GroupMemberIndex
+
+	// the cache of search results, nil if disabled
+	SearchCache *SearchCache
+
+	// the default and max timeout of search
+	SearchTimeout config.SearchTimeout
 }
 
 // NewIndex ...
@@ -42,11 +62,15 @@ func NewIndex(cfg *config.Index) (*Index, error) {
 	/*
 		NOTE: 总共有一下几种引擎
 		1. 本地Eval 用于 not searchable 策略
-		2. ES 用于 any 与 search able 策略
+		2. ES 或 本地内存倒排索引 用于 any 与 search able 策略
 	*/
-	// doc engine ES
-	var esEngine types.Engine
-	esEngine, err = doc.NewEsEngine(cfg)
+	// doc engine ES / memory
+	var docEngine types.DocEngine
+	if cfg.UseMemoryEngine() {
+		docEngine, err = doc.NewMemoryEngine()
+	} else {
+		docEngine, err = doc.NewEsEngine(cfg)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -58,27 +82,89 @@ func NewIndex(cfg *config.Index) (*Index, error) {
 		return nil, err
 	}
 
+	var searchCache *SearchCache
+	if cfg.SearchCache.Enabled {
+		searchCache = NewSearchCache(&cfg.SearchCache)
+	}
+
 	return &Index{
-		EsEngine:   esEngine,
+		DocEngine:  docEngine,
 		EvalEngine: evalEngine,
+
+		GroupMemberIndex: NewGroupMemberIndex(),
+
+		SearchCache:   searchCache,
+		SearchTimeout: cfg.SearchTimeout,
 	}, nil
 }
 
-// Search ...
-func (i *Index) Search(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) ([]types.Subject, error) {
-	subjects := make([]types.Subject, 0, 5)
-	allowedSubjectUIDs := set.NewFixedLengthStringSet(10)
+// useSearchCache return true if the cache enabled and not in debug mode
+// NOTE: debug时需要记录完整的检索过程, 不使用缓存
+func (i *Index) useSearchCache(entry *debug.Entry) bool {
+	return i.SearchCache != nil && entry == nil
+}
+
+// Search return the subjects, and the status of the doc and eval phases
+// NOTE: eval超时时返回部分结果, phases.Partial() 为 true
+func (i *Index) Search(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.Subject, types.SearchPhases, error) {
+	subjects, phases, err := i.cachedSearch(ctx, req, entry)
+	if err != nil || !req.ExpandGroups {
+		return subjects, phases, err
+	}
+
+	debug.AddStep(entry, "expand group members")
+	subjects, err = i.expandGroupMembers(ctx, req, subjects)
+	return subjects, phases, err
+}
+
+// cachedSearch will search with the cache, the partial result will not be cached
+func (i *Index) cachedSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.Subject, types.SearchPhases, error) {
+	if !i.useSearchCache(entry) {
+		return i.search(ctx, req, entry)
+	}
+
+	key := i.SearchCache.Key(ctx, req)
+	if subjects, ok := i.SearchCache.Get(ctx, key); ok {
+		return subjects, types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseDone}, nil
+	}
+
+	subjects, phases, err := i.search(ctx, req, entry)
+	if err != nil {
+		return nil, phases, err
+	}
+	if !phases.Partial() {
+		i.SearchCache.Set(ctx, key, subjects)
+	}
+	return subjects, phases, nil
+}
+
+// search return the subjects, and the status of the doc and eval phases
+func (i *Index) search(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.Subject, types.SearchPhases, error) {
+	timeout := searchTimeout(&i.SearchTimeout, req, false)
 
 	// 记录debug上下文
 	debug.WithValues(entry, types.H{
-		"system":       req.System,
-		"action":       req.Action,
-		"resource":     req.Resource,
-		"subject_type": req.SubjectType,
+		"system":        req.System,
+		"action":        req.Action,
+		"resource":      req.Resource,
+		"subject_type":  req.SubjectType,
+		"expand_groups": req.ExpandGroups,
+		"timeout":       timeout.String(),
 	})
 
-	// TODO: did timeout
-	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	/*
@@ -89,37 +175,490 @@ func (i *Index) Search(ctx context.Context, req *types.SearchRequest, entry *deb
 		4. 其它策略
 	*/
 
-	debug.AddStep(entry, "execute es query")
-	esResult, err := i.EsEngine.Search(ctx, req, entry)
+	debug.AddStep(entry, "execute doc query")
+	docResult, err := i.DocEngine.Search(ctx, req, entry)
 	if err != nil {
-		return nil, err
+		return nil, types.SearchPhases{Doc: errorPhase(ctx, err), Eval: types.SearchPhaseSkipped}, err
 	}
-	subjects = append(subjects, esResult.GetSubjects(allowedSubjectUIDs)...)
+
+	subjects, evalPhase, err := i.searchWithDocResult(ctx, req, docResult, entry)
+	phases := types.SearchPhases{Doc: types.SearchPhaseDone, Eval: evalPhase}
+	if err != nil {
+		phases.Eval = errorPhase(ctx, err)
+		return nil, phases, err
+	}
+	return subjects, phases, nil
+}
+
+// searchWithDocResult merge the subjects of the doc result and the eval engine,
+// return the subjects, and the status of the eval phase
+func (i *Index) searchWithDocResult(
+	ctx context.Context,
+	req *types.SearchRequest,
+	docResult types.SearchResult,
+	entry *debug.Entry,
+) ([]types.Subject, string, error) {
+	subjects := make([]types.Subject, 0, 5)
+	allowedSubjectUIDs := set.NewFixedLengthStringSet(10)
+
+	subjects = append(subjects, docResult.GetSubjects(allowedSubjectUIDs)...)
 
 	// reach the limit, truncate and return
 	if types.ResourceCountReachLimit(req, allowedSubjectUIDs) {
-		return subjects[:req.Limit], nil
+		subjects = subjects[:req.Limit]
+		return i.fillMatchedPolicies(ctx, req, subjects, types.SearchPhaseSkipped, entry)
 	}
 
 	// 3. search toEval
 	debug.AddStep(entry, "execute eval policies")
 	evalResult, err := i.EvalEngine.Search(ctx, req, entry)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	// NOTE: eval超时返回的是部分结果, 记录下来便于排查
+	if evalResult.Partial() {
+		debug.WithValue(entry, "eval_partial", true)
 	}
 	subjects = append(subjects, evalResult.GetSubjects(allowedSubjectUIDs)...)
 
-	// reach the limit, truncate and return
+	// reach the limit, truncate and return, the result is complete even if eval timeout
 	if types.ResourceCountReachLimit(req, allowedSubjectUIDs) {
-		return subjects[:req.Limit], nil
+		subjects = subjects[:req.Limit]
+		return i.fillMatchedPolicies(ctx, req, subjects, types.SearchPhaseDone, entry)
+	}
+
+	if evalResult.Partial() {
+		return i.fillMatchedPolicies(ctx, req, subjects, types.SearchPhaseTimeout, entry)
+	}
+	return i.fillMatchedPolicies(ctx, req, subjects, types.SearchPhaseDone, entry)
+}
+
+// fillMatchedPolicies set all the policies matched of the subjects, only for the search with_policies,
+// return the subjects, and the status of the eval phase, timeout if the eval policies of the subjects are partial
+// NOTE: 引擎达到limit时停止查询, 返回的策略不完整, 需要按选中的subject重新查询所有匹配的策略
+func (i *Index) fillMatchedPolicies(
+	ctx context.Context,
+	req *types.SearchRequest,
+	subjects []types.Subject,
+	evalPhase string,
+	entry *debug.Entry,
+) ([]types.Subject, string, error) {
+	if !req.WithPolicies || len(subjects) == 0 {
+		return subjects, evalPhase, nil
+	}
+
+	debug.AddStep(entry, "search policies of subjects")
+	for begin := 0; begin < len(subjects); begin += matchedPoliciesBatchSize {
+		end := begin + matchedPoliciesBatchSize
+		if end > len(subjects) {
+			end = len(subjects)
+		}
+		batch := subjects[begin:end]
+
+		// NOTE: 只查询选中的subject, 不再展开用户组, 也不限制数量
+		policiesReq := *req
+		policiesReq.SubjectType = req.SearchSubjectType()
+		policiesReq.ExpandGroups = false
+		policiesReq.Subjects = batch
+		policiesReq.Limit = 0
+
+		docPolicies, err := i.DocEngine.SearchPolicies(ctx, &policiesReq, entry)
+		if err != nil {
+			return nil, "", fmt.Errorf("search policies of subjects fail: %w", err)
+		}
+
+		evalResult, err := i.EvalEngine.Search(ctx, &policiesReq, entry)
+		if err != nil {
+			return nil, "", fmt.Errorf("search eval policies of subjects fail: %w", err)
+		}
+		if evalResult.Partial() {
+			evalPhase = types.SearchPhaseTimeout
+		}
+		evalPolicies := evalResult.MatchedPolicies()
+
+		for idx := range batch {
+			uid := batch[idx].UID
+			policies := make([]types.MatchedPolicy, 0, len(docPolicies[uid])+len(evalPolicies[uid]))
+			policies = append(policies, docPolicies[uid]...)
+			batch[idx].Policies = append(policies, evalPolicies[uid]...)
+		}
+	}
+	return subjects, evalPhase, nil
+}
+
+// ReverseSearch will list the resources the subject can access for system/action
+func (i *Index) ReverseSearch(
+	ctx context.Context,
+	req *types.ReverseSearchRequest,
+	entry *debug.Entry,
+) (*types.ReverseSearchResult, error) {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"subject_type": req.SubjectType,
+		"subject_id":   req.SubjectID,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(&i.SearchTimeout, 0, false))
+	defer cancel()
+
+	result := types.NewReverseSearchResult()
+
+	debug.AddStep(entry, "execute doc reverse query")
+	docResult, err := i.DocEngine.ReverseSearch(ctx, req, entry)
+	if err != nil {
+		return nil, err
+	}
+	result.Merge(docResult)
+
+	debug.AddStep(entry, "collect eval policies")
+	evalResult, err := i.EvalEngine.ReverseSearch(ctx, req, entry)
+	if err != nil {
+		return nil, err
+	}
+	result.Merge(evalResult)
+
+	return result, nil
+}
+
+// Explain will return all the policies granting the permission of system/action/resource to the subject
+func (i *Index) Explain(
+	ctx context.Context,
+	req *types.ExplainRequest,
+	entry *debug.Entry,
+) ([]types.ExplainPolicy, error) {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"resource":     req.Resource,
+		"subject_type": req.SubjectType,
+		"subject_id":   req.SubjectID,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(&i.SearchTimeout, 0, false))
+	defer cancel()
+
+	debug.AddStep(entry, "execute doc explain query")
+	policies, err := i.DocEngine.Explain(ctx, req, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.AddStep(entry, "eval policies with trace")
+	evalPolicies, err := i.EvalEngine.Explain(ctx, req, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(policies, evalPolicies...), nil
+}
+
+// Count will return the count of distinct subjects who have the permission, without limit
+func (i *Index) Count(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) (uint64, error) {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"resource":     req.Resource,
+		"subject_type": req.SubjectType,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout(&i.SearchTimeout, req, false))
+	defer cancel()
+
+	return i.count(ctx, req, entry)
+}
+
+// BatchCount ...
+func (i *Index) BatchCount(ctx context.Context, requests []*types.SearchRequest, entry *debug.Entry) ([]uint64, error) {
+	// NOTE: 所有请求共用一个超时时间, 使用所有请求中最大的
+	var timeout time.Duration
+	for _, req := range requests {
+		if t := searchTimeout(&i.SearchTimeout, req, true); t > timeout {
+			timeout = t
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make([]uint64, 0, len(requests))
+	for idx, req := range requests {
+		count, err := i.count(ctx, req, debug.GetSubEntryByIndex(entry, idx))
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, count)
+	}
+	return results, nil
+}
+
+// count = eval subjects + doc subjects not in eval subjects
+// NOTE: eval的结果是精确的subject列表, 先查eval, 再在doc engine聚合时排除掉这些subject, 避免重复计数
+func (i *Index) count(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) (uint64, error) {
+	debug.AddStep(entry, "execute eval policies")
+	evalSubjectUIDs, err := i.evalSubjectUIDs(ctx, req, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	debug.AddStep(entry, "execute doc count query")
+	docCount, err := i.DocEngine.Count(ctx, req, evalSubjectUIDs.ToSlice(), entry)
+	if err != nil {
+		return 0, err
+	}
+
+	return docCount + uint64(evalSubjectUIDs.Size()), nil
+}
+
+// evalSubjectUIDs return the uids of all the subjects matched by the eval engine, without the limit of the request
+// NOTE: 计数需要完整的结果, eval超时返回部分结果时返回错误
+func (i *Index) evalSubjectUIDs(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) (*set.StringSet, error) {
+	unlimitedReq := *req
+	unlimitedReq.Limit = 0
+
+	evalResult, err := i.EvalEngine.Search(ctx, &unlimitedReq, entry)
+	if err != nil {
+		return nil, err
+	}
+	if evalResult.Partial() {
+		return nil, fmt.Errorf("eval count timeout: %w", ctx.Err())
+	}
+
+	evalSubjectUIDs := set.NewStringSet()
+	evalResult.GetSubjects(evalSubjectUIDs)
+	return evalSubjectUIDs, nil
+}
+
+// ExpiringSearch return the subjects whose permission will expire within the days, sorted by the latest expired_at
+// NOTE: subject的过期时间取所有引擎中有权限的策略的最晚过期时间, 在窗口内才返回
+func (i *Index) ExpiringSearch(
+	ctx context.Context,
+	req *types.ExpiringSearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"resource":     req.Resource,
+		"subject_type": req.SubjectType,
+		"within_days":  req.WithinDays,
+	})
+
+	// NOTE: 需要完整计算所有eval策略, 使用batch search的超时时间
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout(&i.SearchTimeout, &req.SearchRequest, true))
+	defer cancel()
+
+	debug.AddStep(entry, "execute doc expired_at query")
+	docSubjects, err := i.DocEngine.SearchExpiredAt(ctx, &req.SearchRequest, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.AddStep(entry, "execute eval policies")
+	evalSubjects, err := i.EvalEngine.SearchExpiredAt(ctx, &req.SearchRequest, entry)
+	if err != nil {
+		return nil, err
 	}
 
+	debug.AddStep(entry, "execute doc expired_at query of eval subjects")
+	evalDocSubjects, err := i.searchDocExpiredAtOfSubjects(ctx, &req.SearchRequest, docSubjects, evalSubjects, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterExpiringSubjects(req.ExpireBefore(), req.Limit, docSubjects, evalDocSubjects, evalSubjects), nil
+}
+
+// searchDocExpiredAtOfSubjects return the latest expired_at in the doc engine of the eval subjects not in docSubjects
+// NOTE: doc引擎的聚合有数量上限, 过期最晚的subject会被截断, 如果它同时有eval策略,
+// 合并时看不到更晚的doc过期时间而误报即将过期, 所以需要按subject再查一次doc引擎
+func (i *Index) searchDocExpiredAtOfSubjects(
+	ctx context.Context,
+	req *types.SearchRequest,
+	docSubjects, evalSubjects []types.SubjectExpiry,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	docSubjectUIDs := set.NewFixedLengthStringSet(len(docSubjects))
+	for _, s := range docSubjects {
+		docSubjectUIDs.Add(s.UID)
+	}
+
+	missingSubjects := make([]types.Subject, 0, len(evalSubjects))
+	for _, s := range evalSubjects {
+		if !docSubjectUIDs.Has(s.UID) {
+			missingSubjects = append(missingSubjects, s.Subject)
+		}
+	}
+
+	subjects := make([]types.SubjectExpiry, 0, len(missingSubjects))
+	for begin := 0; begin < len(missingSubjects); begin += expiredAtLookupBatchSize {
+		end := begin + expiredAtLookupBatchSize
+		if end > len(missingSubjects) {
+			end = len(missingSubjects)
+		}
+
+		// only search the docs of the subjects, the result is not truncated
+		lookupReq := *req
+		lookupReq.Subjects = missingSubjects[begin:end]
+		lookupReq.ExpandGroups = false
+
+		batchSubjects, err := i.DocEngine.SearchExpiredAt(ctx, &lookupReq, entry)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, batchSubjects...)
+	}
 	return subjects, nil
 }
 
+// filterExpiringSubjects merge the latest expired_at of the subjects from all engines,
+// return the subjects expire before the timestamp, sorted by expired_at, at most limit if limit > 0
+func filterExpiringSubjects(before int64, limit int, results ...[]types.SubjectExpiry) []types.SubjectExpiry {
+	latest := make(map[string]types.SubjectExpiry)
+	for _, subjects := range results {
+		for _, s := range subjects {
+			if old, ok := latest[s.UID]; ok && old.ExpiredAt >= s.ExpiredAt {
+				continue
+			}
+			latest[s.UID] = s
+		}
+	}
+
+	subjects := make([]types.SubjectExpiry, 0, len(latest))
+	for _, s := range latest {
+		if s.ExpiredAt <= before {
+			subjects = append(subjects, s)
+		}
+	}
+
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].ExpiredAt != subjects[j].ExpiredAt {
+			return subjects[i].ExpiredAt < subjects[j].ExpiredAt
+		}
+		return subjects[i].UID < subjects[j].UID
+	})
+	if limit > 0 && len(subjects) > limit {
+		subjects = subjects[:limit]
+	}
+	return subjects
+}
+
+// PageSearch will return one page of subjects after the req.SearchCursor, and the next cursor
+// NOTE: next cursor is empty if there is no more subjects
+func (i *Index) PageSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.Subject, string, error) {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"resource":     req.Resource,
+		"subject_type": req.SubjectType,
+		"cursor":       req.Cursor,
+	})
+
+	size := defaultPageSize
+	if req.Limit > 0 {
+		size = req.Limit
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout(&i.SearchTimeout, req, false))
+	defer cancel()
+
+	debug.AddStep(entry, "execute doc page query")
+	docPage, err := i.DocEngine.PageSearch(ctx, req, size, entry)
+	if err != nil {
+		return nil, "", err
+	}
+
+	debug.AddStep(entry, "execute eval policies")
+	evalPage, err := i.EvalEngine.PageSearch(ctx, req, size, entry)
+	if err != nil {
+		return nil, "", err
+	}
+
+	subjects, hasMore := mergeSearchPages(size, docPage, evalPage)
+	if !hasMore || len(subjects) == 0 {
+		return subjects, "", nil
+	}
+
+	nextCursor, err := types.NewSearchCursor(subjects[len(subjects)-1].UID).Encode()
+	if err != nil {
+		return nil, "", err
+	}
+	return subjects, nextCursor, nil
+}
+
+// mergeSearchPages merge the pages sorted by subject uid, return at most size distinct subjects
+// NOTE: 如果某个引擎还有下一页, 那么只能返回不超过该页最后一个subject uid的结果, 否则后面的页会漏掉subject
+func mergeSearchPages(size int, pages ...*types.SearchPage) ([]types.Subject, bool) {
+	hasMore := false
+	boundary := ""
+	for _, page := range pages {
+		if !page.HasMore || len(page.Subjects) == 0 {
+			continue
+		}
+
+		hasMore = true
+		if last := page.LastSubjectUID(); boundary == "" || last < boundary {
+			boundary = last
+		}
+	}
+
+	subjects := make([]types.Subject, 0, size)
+	indexes := make([]int, len(pages))
+	for len(subjects) < size {
+		// pick the min subject uid from all pages
+		minPage := -1
+		for pi, page := range pages {
+			if indexes[pi] >= len(page.Subjects) {
+				continue
+			}
+			if minPage == -1 || page.Subjects[indexes[pi]].UID < pages[minPage].Subjects[indexes[minPage]].UID {
+				minPage = pi
+			}
+		}
+		if minPage == -1 {
+			break
+		}
+
+		subject := pages[minPage].Subjects[indexes[minPage]]
+		if hasMore && subject.UID > boundary {
+			break
+		}
+
+		// skip the duplicated subject in other pages
+		for pi, page := range pages {
+			if indexes[pi] < len(page.Subjects) && page.Subjects[indexes[pi]].UID == subject.UID {
+				indexes[pi]++
+			}
+		}
+		subjects = append(subjects, subject)
+	}
+
+	// left subjects not returned in this page
+	for pi, page := range pages {
+		if indexes[pi] < len(page.Subjects) {
+			hasMore = true
+		}
+	}
+	return subjects, hasMore
+}
+
 // Stats ...
 func (i *Index) Stats(system, action string) map[string]uint64 {
-	docSize := i.EsEngine.Size(system, action)
+	docSize := i.DocEngine.Size(system, action)
 	evalSize := i.EvalEngine.Size(system, action)
 
 	return map[string]uint64{
@@ -129,9 +668,61 @@ func (i *Index) Stats(system, action string) map[string]uint64 {
 	}
 }
 
+// TakeSnapshot will merge the snapshot of doc engine and eval engine
+func (i *Index) TakeSnapshot() []types.SnapRecord {
+	return mergeSnapRecords(i.DocEngine.TakeSnapshot(), i.EvalEngine.TakeSnapshot())
+}
+
+// LoadSnapshot ...
+func (i *Index) LoadSnapshot(data []types.SnapRecord) error {
+	err := i.DocEngine.LoadSnapshot(data)
+	if err != nil {
+		return fmt.Errorf("doc engine load snapshot fail: %w", err)
+	}
+
+	return i.EvalEngine.LoadSnapshot(data)
+}
+
+// mergeSnapRecords merge the records of the same system/action into one
+func mergeSnapRecords(docRecords, evalRecords []types.SnapRecord) []types.SnapRecord {
+	data := make([]types.SnapRecord, 0, len(docRecords)+len(evalRecords))
+	recordIndexes := make(map[string]int, len(docRecords))
+	for _, record := range docRecords {
+		recordIndexes[record.System+":"+record.Action] = len(data)
+		data = append(data, record)
+	}
+
+	for _, record := range evalRecords {
+		idx, ok := recordIndexes[record.System+":"+record.Action]
+		if !ok {
+			data = append(data, record)
+			continue
+		}
+
+		merged := &data[idx]
+		merged.EvalPolicies = record.EvalPolicies
+		if record.LastModifiedTimestamp > merged.LastModifiedTimestamp {
+			merged.LastModifiedTimestamp = record.LastModifiedTimestamp
+		}
+	}
+	return data
+}
+
 // BulkUpsert ...
 func (i *Index) BulkUpsert(policies []types.Policy, logger *log.Entry) {
+	unresolvedSystems := fillResourceTypeSystems(policies, logger)
+
+	// NOTE: 更新可能移除已有策略的操作, 需要在写入前查询策略原有的操作, 与新的操作一起失效缓存
+	ids := make([]int64, 0, len(policies))
+	for _, p := range policies {
+		ids = append(ids, p.ID)
+	}
+	invalidate := i.searchCacheInvalidator(func(engine types.Engine) ([]types.SystemAction, error) {
+		return engine.ListActionsByIDs(ids)
+	}, logger)
+
 	evalPolicies, esPolicies := expression.SplitPoliciesWithExpressionType(policies)
+	evalPolicies, esPolicies = evalUnresolvedDocPolicies(unresolvedSystems, evalPolicies, esPolicies)
 
 	evalPolicyIDs := make([]int64, 0, len(evalPolicies))
 	for _, p := range evalPolicies {
@@ -145,9 +736,9 @@ func (i *Index) BulkUpsert(policies []types.Policy, logger *log.Entry) {
 
 	if len(evalPolicyIDs) > 0 {
 		// delete eval policies from es engine
-		err = i.EsEngine.BulkDelete(evalPolicyIDs, logger)
+		err = i.DocEngine.BulkDelete(evalPolicyIDs, logger)
 		if err != nil {
-			logger.WithError(err).Error("indexer BulkUpsert EsEngine.BulkDelete error")
+			logger.WithError(err).Error("indexer BulkUpsert DocEngine.BulkDelete error")
 		}
 	}
 
@@ -157,9 +748,9 @@ func (i *Index) BulkUpsert(policies []types.Policy, logger *log.Entry) {
 	}
 
 	if len(esPolicies) > 0 {
-		err = i.EsEngine.BulkAdd(esPolicies)
+		err = i.DocEngine.BulkAdd(esPolicies)
 		if err != nil {
-			logger.WithError(err).Error("indexer BulkUpsert EsEngine.BulkAdd error")
+			logger.WithError(err).Error("indexer BulkUpsert DocEngine.BulkAdd error")
 		}
 	}
 
@@ -170,6 +761,79 @@ func (i *Index) BulkUpsert(policies []types.Policy, logger *log.Entry) {
 			logger.WithError(err).Error("indexer BulkUpsert EvalEngine.BulkDelete error")
 		}
 	}
+
+	invalidate()
+	if i.SearchCache != nil {
+		i.SearchCache.Invalidate(policiesSystemActions(policies))
+	}
+}
+
+// policiesSystemActions return the distinct system actions of the policies
+func policiesSystemActions(policies []types.Policy) []types.SystemAction {
+	actions := make([]types.SystemAction, 0, 1)
+	keys := set.NewStringSet()
+	for _, p := range policies {
+		for _, action := range p.Actions {
+			key := p.System + ":" + action.ID
+			if keys.Has(key) {
+				continue
+			}
+			keys.Add(key)
+			actions = append(actions, types.SystemAction{System: p.System, Action: action.ID})
+		}
+	}
+	return actions
+}
+
+// fillResourceTypeSystems record the resource types from other systems of the policies,
+// the doc fields of the resource type will be indexed under its own system,
+// return the systems whose resource type systems can't be resolved
+func fillResourceTypeSystems(policies []types.Policy, logger *log.Entry) *set.StringSet {
+	unresolvedSystems := set.NewStringSet()
+	systemResourceTypeSystems := make(map[string]map[string]string, 1)
+	for i := range policies {
+		p := &policies[i]
+
+		resourceTypeSystems, ok := systemResourceTypeSystems[p.System]
+		if !ok {
+			var err error
+			resourceTypeSystems, err = impls.GetResourceTypeSystems(p.System)
+			if err != nil {
+				logger.WithError(err).Warnf(
+					"get resource type systems of system `%s` fail, the doc policies will be indexed as eval", p.System,
+				)
+				unresolvedSystems.Add(p.System)
+			}
+			systemResourceTypeSystems[p.System] = resourceTypeSystems
+		}
+
+		p.FillResourceTypeSystems(resourceTypeSystems)
+	}
+	return unresolvedSystems
+}
+
+// evalUnresolvedDocPolicies move the doc policies of the unresolved systems into the eval policies
+// NOTE: 无法确定资源类型所属的系统时, 跨系统的field会索引在错误的系统下导致检索不到;
+// eval不区分资源类型所属的系统, 结果是正确的, 策略再次更新时会重新判断
+func evalUnresolvedDocPolicies(
+	unresolvedSystems *set.StringSet,
+	evalPolicies, esPolicies []*types.Policy,
+) ([]*types.Policy, []*types.Policy) {
+	if unresolvedSystems.Size() == 0 {
+		return evalPolicies, esPolicies
+	}
+
+	docPolicies := make([]*types.Policy, 0, len(esPolicies))
+	for _, p := range esPolicies {
+		// any策略没有field, 不受影响
+		if p.ExpressionType == types.Doc && unresolvedSystems.Has(p.System) {
+			p.ExpressionType = types.Eval
+			evalPolicies = append(evalPolicies, p)
+			continue
+		}
+		docPolicies = append(docPolicies, p)
+	}
+	return evalPolicies, docPolicies
 }
 
 // BulkDelete ...
@@ -177,14 +841,22 @@ func (i *Index) BulkDelete(ids []int64, logger *log.Entry) {
 	if len(ids) == 0 {
 		return
 	}
-	err := i.EsEngine.BulkDelete(ids, logger)
+
+	// NOTE: 删除后无法再查到策略所属的操作, 需要在删除前查询, 删除后再失效缓存
+	invalidate := i.searchCacheInvalidator(func(engine types.Engine) ([]types.SystemAction, error) {
+		return engine.ListActionsByIDs(ids)
+	}, logger)
+
+	err := i.DocEngine.BulkDelete(ids, logger)
 	if err != nil {
-		logger.WithError(err).Error("indexer BulkDelete EsEngine.BulkDelete error")
+		logger.WithError(err).Error("indexer BulkDelete DocEngine.BulkDelete error")
 	}
 	err = i.EvalEngine.BulkDelete(ids, logger)
 	if err != nil {
 		logger.WithError(err).Error("indexer BulkUpsert EvalEngine.BulkDelete error")
 	}
+
+	invalidate()
 }
 
 // BulkDeleteBySubjects ...
@@ -192,19 +864,96 @@ func (i *Index) BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Sub
 	if len(subjects) == 0 {
 		return
 	}
-	err := i.EsEngine.BulkDeleteBySubjects(beforeUpdatedAt, subjects, logger)
+
+	invalidate := i.searchCacheInvalidator(func(engine types.Engine) ([]types.SystemAction, error) {
+		return engine.ListActionsBySubjects(beforeUpdatedAt, subjects)
+	}, logger)
+
+	err := i.DocEngine.BulkDeleteBySubjects(beforeUpdatedAt, subjects, logger)
 	if err != nil {
-		logger.WithError(err).Error("indexer BulkDeleteBySubjects EsEngine.BulkDeleteBySubjects error")
+		logger.WithError(err).Error("indexer BulkDeleteBySubjects DocEngine.BulkDeleteBySubjects error")
 	}
 	err = i.EvalEngine.BulkDeleteBySubjects(beforeUpdatedAt, subjects, logger)
 	if err != nil {
 		logger.WithError(err).Error("indexer BulkDeleteBySubjects EvalEngine.BulkDeleteBySubjects error")
 	}
+
+	invalidate()
+}
+
+// PurgeExpired delete the policies expired before the timestamp from all engines, return the count of each engine
+// NOTE: 检索时已过滤过期策略, 清理不影响检索结果, 无需失效缓存
+func (i *Index) PurgeExpired(beforeExpiredAt int64, logger *log.Entry) (map[string]uint64, error) {
+	counts := make(map[string]uint64, 2)
+
+	docCount, err := i.DocEngine.PurgeExpired(beforeExpiredAt, logger)
+	if err != nil {
+		return counts, fmt.Errorf("doc engine purge expired fail: %w", err)
+	}
+	counts["doc"] = docCount
+
+	evalCount, err := i.EvalEngine.PurgeExpired(beforeExpiredAt, logger)
+	if err != nil {
+		return counts, fmt.Errorf("eval engine purge expired fail: %w", err)
+	}
+	counts["eval"] = evalCount
+
+	return counts, nil
+}
+
+// searchCacheInvalidator list the system actions of the policies to be changed from all engines,
+// return the func to invalidate the search cache of them, should be called after changing
+// NOTE: 查询失败时无法确定受影响的操作, 失效全部缓存
+func (i *Index) searchCacheInvalidator(
+	listActions func(engine types.Engine) ([]types.SystemAction, error),
+	logger *log.Entry,
+) func() {
+	if i.SearchCache == nil {
+		return func() {}
+	}
+
+	actions := make([]types.SystemAction, 0, 2)
+	for _, engine := range []types.Engine{i.DocEngine, i.EvalEngine} {
+		engineActions, err := listActions(engine)
+		if err != nil {
+			logger.WithError(err).Warn("list the actions of the policies to change fail, will invalidate all search cache")
+			return i.SearchCache.InvalidateAll
+		}
+		actions = append(actions, engineActions...)
+	}
+
+	return func() {
+		i.SearchCache.Invalidate(actions)
+	}
+}
+
+// ListActionsByResource return the sorted actions of the system applicable to the resource types in all engines
+func (i *Index) ListActionsByResource(system string, resource types.Resource) ([]string, error) {
+	docActions, err := i.DocEngine.ListActionsByResource(system, resource)
+	if err != nil {
+		return nil, fmt.Errorf("doc engine list actions by resource fail: %w", err)
+	}
+
+	evalActions, err := i.EvalEngine.ListActionsByResource(system, resource)
+	if err != nil {
+		return nil, fmt.Errorf("eval engine list actions by resource fail: %w", err)
+	}
+
+	actionSet := set.NewStringSet()
+	for _, a := range append(docActions, evalActions...) {
+		if a.System == system {
+			actionSet.Add(a.Action)
+		}
+	}
+
+	actions := actionSet.ToSlice()
+	sort.Strings(actions)
+	return actions, nil
 }
 
 // TotalStats ...
 func (i *Index) TotalStats() map[string]uint64 {
-	docSize := i.EsEngine.Total()
+	docSize := i.DocEngine.Total()
 	evalSize := i.EvalEngine.Total()
 
 	return map[string]uint64{
@@ -214,54 +963,51 @@ func (i *Index) TotalStats() map[string]uint64 {
 	}
 }
 
-// BatchSearch ...
-func (i *Index) BatchSearch(
+// expandGroupMembers will expand the group subjects to their member users
+// NOTE: 索引中缺失的用户组需要从iam backend拉取, 使用检索的超时时间, 超时返回错误
+func (i *Index) expandGroupMembers(
 	ctx context.Context,
-	requests []*types.SearchRequest,
-	entry *debug.Entry,
-) ([][]types.Subject, error) {
-	// TODO: did timeout
-	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	req *types.SearchRequest,
+	subjects []types.Subject,
+) ([]types.Subject, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout(&i.SearchTimeout, req, false))
 	defer cancel()
 
-	esSearchResults, err := i.EsEngine.BatchSearch(ctx, requests, entry)
+	groupMembers, err := loadGroupMembers(
+		ctx, i.GroupMemberIndex, groupIDsOfSubjects(subjects), components.NewIAMClient().ListGroupMember,
+	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("load group members fail: %w", err)
 	}
 
-	results := make([][]types.Subject, 0, len(requests))
-
-	for idx, req := range requests {
-		subjects := make([]types.Subject, 0, 5)
-		allowedSubjectUIDs := set.NewFixedLengthStringSet(10)
-
-		esQuerySubjects := esSearchResults[idx]
-		subjects = append(subjects, esQuerySubjects.GetSubjects(allowedSubjectUIDs)...)
-
-		// reach the limit, truncate
-		if types.ResourceCountReachLimit(req, allowedSubjectUIDs) {
-			results = append(results, subjects[:req.Limit])
-			continue
-		}
-
-		subEntry := debug.GetSubEntryByIndex(entry, idx)
-		evaResult, err := i.EvalEngine.Search(ctx, req, subEntry)
-		if err != nil {
-			return nil, err
-		}
-		subjects = append(subjects, evaResult.GetSubjects(allowedSubjectUIDs)...)
+	return expandGroupMembers(req, subjects, groupMembers), nil
+}
 
-		// reach the limit, truncate
-		if types.ResourceCountReachLimit(req, allowedSubjectUIDs) {
-			results = append(results, subjects[:req.Limit])
-			continue
+// indexMappings 动态mapping
+// 1. 数字比较的字段 `type.attribute__gte` 等, 索引为 double 类型, 用于range查询
+// 2. match string 类型时索引转换为 keyword 类型
+const indexMappings = `{
+	"dynamic_templates": [
+		{
+			"number_compare": {
+				"path_match": "resource.*",
+				"match_pattern": "regex",
+				"match": "^.+__(gt|gte|lt|lte)$",
+				"mapping": {
+					"type": "double"
+				}
+			}
+		},
+		{
+			"strings": {
+				"match_mapping_type": "string",
+				"mapping": {
+					"type": "keyword"
+				}
+			}
 		}
-
-		results = append(results, subjects)
-	}
-
-	return results, nil
-}
+	]
+}`
 
 func creatIndexIfNotExists(cfg *config.Index) error {
 	esClient, err := client.NewEsClient(&cfg.ElasticSearch)
@@ -275,25 +1021,20 @@ func creatIndexIfNotExists(cfg *config.Index) error {
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		// 动态mapping, match string 类型时索引转换为 keyword 类型
-		mapping := `{
-			"mappings": {
-				"dynamic_templates": [
-					{
-						"strings": {
-							"match_mapping_type": "string",
-							"mapping": {
-								"type": "keyword"
-							}
-						}
-					}
-				]
-			}
-		}`
-		_, err = esClient.CreateIndex(cfg.ElasticSearch.IndexName, mapping)
+		_, err = esClient.CreateIndex(cfg.ElasticSearch.IndexName, fmt.Sprintf(`{"mappings": %s}`, indexMappings))
 		if err != nil {
 			return fmt.Errorf("create index: [%s] error:%w", cfg.ElasticSearch.IndexName, err)
 		}
+		return nil
+	}
+
+	// NOTE: 已存在的索引需要更新dynamic_templates, 否则新增的数字比较字段无法按double索引
+	resp, err = esClient.PutMapping(cfg.ElasticSearch.IndexName, indexMappings)
+	if err != nil {
+		return fmt.Errorf("put index: [%s] mapping error:%w", cfg.ElasticSearch.IndexName, err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("put index: [%s] mapping fail, response: %s", cfg.ElasticSearch.IndexName, resp.String())
 	}
 
 	return nil
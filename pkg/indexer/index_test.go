@@ -10,3 +10,487 @@
  */
 
 package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+// truncatedExpiredAtDocEngine drop the subject expire latest if search without the candidate subjects,
+// the same as the aggregation of es truncated
+type truncatedExpiredAtDocEngine struct {
+	types.DocEngine
+}
+
+func (e *truncatedExpiredAtDocEngine) SearchExpiredAt(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	subjects, err := e.DocEngine.SearchExpiredAt(ctx, req, entry)
+	if err != nil || len(req.Subjects) > 0 || len(subjects) == 0 {
+		return subjects, err
+	}
+	return subjects[:len(subjects)-1], nil
+}
+
+func subjectsOf(uids ...string) []types.Subject {
+	subjects := make([]types.Subject, 0, len(uids))
+	for _, uid := range uids {
+		subjects = append(subjects, types.Subject{UID: uid})
+	}
+	return subjects
+}
+
+func uidsOf(subjects []types.Subject) []string {
+	uids := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		uids = append(uids, s.UID)
+	}
+	return uids
+}
+
+var _ = Describe("Index", func() {
+	Describe("mergeSearchPages", func() {
+		It("empty", func() {
+			subjects, hasMore := mergeSearchPages(10, &types.SearchPage{}, &types.SearchPage{})
+			assert.Empty(GinkgoT(), subjects)
+			assert.False(GinkgoT(), hasMore)
+		})
+
+		It("merge and dedup", func() {
+			subjects, hasMore := mergeSearchPages(10,
+				&types.SearchPage{Subjects: subjectsOf("user:a", "user:c")},
+				&types.SearchPage{Subjects: subjectsOf("user:b", "user:c", "user:d")},
+			)
+			assert.Equal(GinkgoT(), []string{"user:a", "user:b", "user:c", "user:d"}, uidsOf(subjects))
+			assert.False(GinkgoT(), hasMore)
+		})
+
+		It("truncate by size", func() {
+			subjects, hasMore := mergeSearchPages(2,
+				&types.SearchPage{Subjects: subjectsOf("user:a", "user:c")},
+				&types.SearchPage{Subjects: subjectsOf("user:b")},
+			)
+			assert.Equal(GinkgoT(), []string{"user:a", "user:b"}, uidsOf(subjects))
+			assert.True(GinkgoT(), hasMore)
+		})
+
+		It("stop at the boundary of the page has more", func() {
+			subjects, hasMore := mergeSearchPages(10,
+				&types.SearchPage{Subjects: subjectsOf("user:a", "user:b"), HasMore: true},
+				&types.SearchPage{Subjects: subjectsOf("user:a", "user:c", "user:d")},
+			)
+			assert.Equal(GinkgoT(), []string{"user:a", "user:b"}, uidsOf(subjects))
+			assert.True(GinkgoT(), hasMore)
+		})
+	})
+
+	Describe("filterExpiringSubjects", func() {
+		newSubjectExpiry := func(uid string, expiredAt int64) types.SubjectExpiry {
+			return types.SubjectExpiry{Subject: types.Subject{UID: uid}, ExpiredAt: expiredAt}
+		}
+
+		It("merge the latest expired_at", func() {
+			subjects := filterExpiringSubjects(
+				200, 0,
+				[]types.SubjectExpiry{newSubjectExpiry("user:a", 100), newSubjectExpiry("user:b", 150)},
+				[]types.SubjectExpiry{newSubjectExpiry("user:a", 300), newSubjectExpiry("user:c", 120)},
+			)
+			assert.Equal(GinkgoT(), []types.SubjectExpiry{
+				newSubjectExpiry("user:c", 120),
+				newSubjectExpiry("user:b", 150),
+			}, subjects)
+		})
+
+		It("truncate by limit", func() {
+			subjects := filterExpiringSubjects(
+				200, 1,
+				[]types.SubjectExpiry{newSubjectExpiry("user:b", 100), newSubjectExpiry("user:a", 100)},
+			)
+			assert.Equal(GinkgoT(), []types.SubjectExpiry{newSubjectExpiry("user:a", 100)}, subjects)
+		})
+	})
+
+	Describe("ExpiringSearch", func() {
+		It("the doc expired_at of the eval subjects truncated by the aggregation", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+
+			newPolicy := func(id int64, userID string, expr expression.ExprCell, expiredAt int64) types.Policy {
+				return types.Policy{
+					ID:         id,
+					System:     "bk_cmdb",
+					Actions:    []types.Action{{ID: "view_host"}},
+					Subject:    types.Subject{Type: "user", ID: userID},
+					Expression: expr,
+					ExpiredAt:  expiredAt,
+				}
+			}
+			docExpr := expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}
+			evalExpr := expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: "1"}
+			idx.BulkUpsert([]types.Policy{
+				newPolicy(1, "a", docExpr, 10000000),
+				newPolicy(2, "b", docExpr, 1000),
+				newPolicy(3, "a", evalExpr, 2000),
+			}, logrus.NewEntry(logrus.New()))
+			idx.DocEngine = &truncatedExpiredAtDocEngine{DocEngine: idx.DocEngine}
+
+			req := &types.ExpiringSearchRequest{
+				SearchRequest: types.SearchRequest{
+					System: "bk_cmdb",
+					Action: types.Action{ID: "view_host"},
+					Resource: []types.ResourceNode{
+						{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+					},
+					SubjectType:  types.SubjectTypeAll,
+					NowTimestamp: 100,
+				},
+				WithinDays: 7,
+			}
+			// user a has the doc policy expire later, not expiring
+			subjects, err := idx.ExpiringSearch(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Len(GinkgoT(), subjects, 1)
+			assert.Equal(GinkgoT(), "user:b", subjects[0].UID)
+		})
+	})
+
+	Describe("mergeSnapRecords", func() {
+		It("merge same system/action", func() {
+			data := mergeSnapRecords(
+				[]types.SnapRecord{
+					{System: "bk_cmdb", Action: "view_host", LastModifiedTimestamp: 1, DocPolicies: []*types.Policy{{ID: 1}}},
+				},
+				[]types.SnapRecord{
+					{System: "bk_cmdb", Action: "view_host", LastModifiedTimestamp: 2, EvalPolicies: []*types.Policy{{ID: 2}}},
+					{System: "bk_cmdb", Action: "edit_host", LastModifiedTimestamp: 3, EvalPolicies: []*types.Policy{{ID: 3}}},
+				},
+			)
+			assert.Len(GinkgoT(), data, 2)
+			assert.Equal(GinkgoT(), int64(2), data[0].LastModifiedTimestamp)
+			assert.Len(GinkgoT(), data[0].DocPolicies, 1)
+			assert.Len(GinkgoT(), data[0].EvalPolicies, 1)
+			assert.Equal(GinkgoT(), "edit_host", data[1].Action)
+		})
+	})
+
+	Describe("fillResourceTypeSystems", func() {
+		It("ok", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{"host": "bk_cmdb", "script": "bk_job"}, nil
+				}, time.Minute)
+
+			policies := []types.Policy{
+				{
+					ID:     1,
+					System: "bk_job",
+					Expression: expression.ExprCell{
+						OP: operator.AND,
+						Content: []expression.ExprCell{
+							{OP: operator.Eq, Field: "script.id", Value: "1"},
+							{OP: operator.Eq, Field: "host.id", Value: "2"},
+						},
+					},
+				},
+				{
+					ID:         2,
+					System:     "bk_job",
+					Expression: expression.ExprCell{OP: operator.Eq, Field: "script.id", Value: "1"},
+				},
+			}
+			fillResourceTypeSystems(policies, logrus.NewEntry(logrus.New()))
+
+			assert.Equal(GinkgoT(), map[string]string{"host": "bk_cmdb"}, policies[0].ResourceTypeSystems)
+			assert.Equal(GinkgoT(), "bk_cmdb", policies[0].ResourceTypeSystem("host"))
+			assert.Equal(GinkgoT(), "bk_job", policies[0].ResourceTypeSystem("script"))
+			assert.Nil(GinkgoT(), policies[1].ResourceTypeSystems)
+		})
+
+		It("unresolved, the doc policies indexed as eval", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return nil, errors.New("iam backend error")
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+
+			newPolicy := func(id int64, expr expression.ExprCell) types.Policy {
+				return types.Policy{
+					ID:         id,
+					System:     "bk_job",
+					Actions:    []types.Action{{ID: "execute_script"}},
+					Subject:    types.Subject{Type: "user", ID: fmt.Sprintf("user%d", id)},
+					Expression: expr,
+					ExpiredAt:  200,
+				}
+			}
+			idx.BulkUpsert([]types.Policy{
+				newPolicy(1, expression.ExprCell{
+					OP: operator.AND,
+					Content: []expression.ExprCell{
+						{OP: operator.Eq, Field: "script.id", Value: "1"},
+						{OP: operator.Eq, Field: "host.id", Value: "2"},
+					},
+				}),
+				newPolicy(2, expression.ExprCell{OP: operator.Any, Field: "script.id", Value: []interface{}{}}),
+			}, logrus.NewEntry(logrus.New()))
+			// the any policy not affected
+			assert.Equal(GinkgoT(), uint64(1), idx.DocEngine.Size("bk_job", "execute_script"))
+			assert.Equal(GinkgoT(), uint64(1), idx.EvalEngine.Size("bk_job", "execute_script"))
+
+			// the host from the other system
+			subjects, _, err := idx.Search(context.Background(), &types.SearchRequest{
+				System: "bk_job",
+				Action: types.Action{ID: "execute_script"},
+				Resource: []types.ResourceNode{
+					{System: "bk_job", Type: "script", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+					{System: "bk_cmdb", Type: "host", ID: "2", Attribute: map[string]interface{}{"id": "2"}},
+				},
+				SubjectType:  types.SubjectTypeAll,
+				NowTimestamp: 100,
+			}, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.ElementsMatch(GinkgoT(), []string{"user:user1", "user:user2"}, uidsOf(subjects))
+		})
+	})
+
+	Describe("doc policies equivalent to eval", func() {
+		newPolicy := func(id int64, expr expression.ExprCell) types.Policy {
+			return types.Policy{
+				ID:         id,
+				System:     "bk_cmdb",
+				Actions:    []types.Action{{ID: "view_host"}},
+				Subject:    types.Subject{Type: "user", ID: fmt.Sprintf("user%d", id)},
+				Expression: expr,
+				ExpiredAt:  200,
+			}
+		}
+		or := func(content ...expression.ExprCell) expression.ExprCell {
+			return expression.ExprCell{OP: operator.OR, Content: content}
+		}
+
+		policies := []types.Policy{
+			newPolicy(1, or(
+				expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"},
+				expression.ExprCell{OP: operator.In, Field: "host.id", Value: []interface{}{"2", "3"}},
+			)),
+			// same field, different operators
+			newPolicy(2, or(
+				expression.ExprCell{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,1/set,*/"},
+				expression.ExprCell{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/module,7/"},
+			)),
+			// different objects
+			newPolicy(3, or(
+				expression.ExprCell{OP: operator.Eq, Field: "module.id", Value: "7"},
+				expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "4"},
+			)),
+			// nested
+			newPolicy(4, or(
+				expression.ExprCell{OP: operator.StringContains, Field: "host._bk_iam_path_", Value: "/set,3/"},
+				or(
+					expression.ExprCell{OP: operator.In, Field: "module.id", Value: []interface{}{"8"}},
+					expression.ExprCell{OP: operator.StartsWith, Field: "host._bk_iam_path_", Value: "/biz,2/"},
+					expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "5"},
+				),
+			)),
+			// not supported operator, eval
+			newPolicy(5, or(
+				expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "9"},
+				expression.ExprCell{OP: operator.EndsWith, Field: "host.name", Value: "db"},
+			)),
+		}
+
+		It("search", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+			idx.BulkUpsert(policies, logrus.NewEntry(logrus.New()))
+			assert.Equal(GinkgoT(), uint64(4), idx.DocEngine.Size("bk_cmdb", "view_host"))
+			assert.Equal(GinkgoT(), uint64(1), idx.EvalEngine.Size("bk_cmdb", "view_host"))
+
+			for _, hostID := range []string{"1", "3", "4", "5", "6", "9"} {
+				for _, path := range []string{"/biz,1/set,2/module,7/", "/biz,2/set,3/module,8/", "/biz,3/set,4/module,9/"} {
+					for _, moduleID := range []string{"7", "8", "9"} {
+						req := &types.SearchRequest{
+							System: "bk_cmdb",
+							Action: types.Action{ID: "view_host"},
+							Resource: []types.ResourceNode{
+								{
+									System:    "bk_cmdb",
+									Type:      "host",
+									ID:        hostID,
+									Attribute: map[string]interface{}{"id": hostID, "_bk_iam_path_": path, "name": "web"},
+								},
+								{
+									System:    "bk_cmdb",
+									Type:      "module",
+									ID:        moduleID,
+									Attribute: map[string]interface{}{"id": moduleID},
+								},
+							},
+							SubjectType:  types.SubjectTypeAll,
+							NowTimestamp: 100,
+						}
+
+						obj := expression.NewObjectSet()
+						for _, node := range req.Resource {
+							obj.Set(node.Type, node.Attribute)
+						}
+						want := []string{}
+						for _, p := range policies {
+							if p.Expression.Eval(obj) {
+								want = append(want, "user:"+p.Subject.ID)
+							}
+						}
+
+						subjects, _, err := idx.Search(context.Background(), req, nil)
+						assert.NoError(GinkgoT(), err)
+						assert.ElementsMatch(GinkgoT(), want, uidsOf(subjects), req.Resource)
+					}
+				}
+			}
+		})
+
+		It("count without limit", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+			// more eval subjects than the limit, user1 also granted by the doc policy
+			evalPolicies := make([]types.Policy, 0, 3)
+			for _, id := range []int64{1, 6, 7} {
+				eval := newPolicy(id+10, expression.ExprCell{OP: operator.EndsWith, Field: "host.name", Value: "web"})
+				eval.Subject.ID = fmt.Sprintf("user%d", id)
+				evalPolicies = append(evalPolicies, eval)
+			}
+			idx.BulkUpsert(append(policies, evalPolicies...), logrus.NewEntry(logrus.New()))
+
+			req := &types.SearchRequest{
+				System: "bk_cmdb",
+				Action: types.Action{ID: "view_host"},
+				Resource: []types.ResourceNode{{
+					System:    "bk_cmdb",
+					Type:      "host",
+					ID:        "1",
+					Attribute: map[string]interface{}{"id": "1", "name": "web"},
+				}},
+				SubjectType:  types.SubjectTypeAll,
+				Limit:        1,
+				NowTimestamp: 100,
+			}
+			// user1 by doc and eval, user6 and user7 by eval
+			count, err := idx.Count(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), uint64(3), count)
+		})
+
+		It("search with policies", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+			// the same subject granted by doc and eval policies
+			eval := newPolicy(6, expression.ExprCell{OP: operator.EndsWith, Field: "host.name", Value: "web"})
+			eval.Subject.ID = "user1"
+			eval.TemplateID = 10
+			idx.BulkUpsert(append(policies, eval), logrus.NewEntry(logrus.New()))
+
+			req := &types.SearchRequest{
+				System: "bk_cmdb",
+				Action: types.Action{ID: "view_host"},
+				Resource: []types.ResourceNode{{
+					System:    "bk_cmdb",
+					Type:      "host",
+					ID:        "1",
+					Attribute: map[string]interface{}{"id": "1", "name": "web"},
+				}},
+				SubjectType:  types.SubjectTypeAll,
+				NowTimestamp: 100,
+			}
+			subjects, _, err := idx.Search(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), []string{"user:user1"}, uidsOf(subjects))
+			assert.Empty(GinkgoT(), subjects[0].Policies)
+
+			req.WithPolicies = true
+			subjects, _, err = idx.Search(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.Equal(GinkgoT(), []string{"user:user1"}, uidsOf(subjects))
+			assert.Equal(GinkgoT(), []types.MatchedPolicy{
+				{ID: 1, ExpiredAt: 200, Type: types.Doc},
+				{ID: 6, TemplateID: 10, ExpiredAt: 200, Type: types.Eval},
+			}, subjects[0].Policies)
+		})
+
+		It("search with policies reach the limit", func() {
+			impls.LocalResourceTypeSystemsCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return map[string]string{}, nil
+				}, time.Minute)
+
+			idx, err := NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+			assert.NoError(GinkgoT(), err)
+			// the doc policy reach the limit, the eval policy of user1 not searched by the limit
+			eval := newPolicy(6, expression.ExprCell{OP: operator.EndsWith, Field: "host.name", Value: "web"})
+			eval.Subject.ID = "user1"
+			eval.TemplateID = 10
+			idx.BulkUpsert(append(policies, eval), logrus.NewEntry(logrus.New()))
+
+			req := &types.SearchRequest{
+				System: "bk_cmdb",
+				Action: types.Action{ID: "view_host"},
+				Resource: []types.ResourceNode{{
+					System:    "bk_cmdb",
+					Type:      "host",
+					ID:        "1",
+					Attribute: map[string]interface{}{"id": "1", "name": "web"},
+				}},
+				SubjectType:  types.SubjectTypeAll,
+				Limit:        1,
+				WithPolicies: true,
+				NowTimestamp: 100,
+			}
+			subjects, phases, err := idx.Search(context.Background(), req, nil)
+			assert.NoError(GinkgoT(), err)
+			assert.False(GinkgoT(), phases.Partial())
+			assert.Equal(GinkgoT(), []string{"user:user1"}, uidsOf(subjects))
+			assert.Equal(GinkgoT(), []types.MatchedPolicy{
+				{ID: 1, ExpiredAt: 200, Type: types.Doc},
+				{ID: 6, TemplateID: 10, ExpiredAt: 200, Type: types.Eval},
+			}, subjects[0].Policies)
+		})
+	})
+})
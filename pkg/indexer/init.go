@@ -26,9 +26,12 @@ var globalIndex *Index
 // InitGlobalIndex ...
 func InitGlobalIndex(cfg *config.Index) {
 	var err error
-	err = creatIndexIfNotExists(cfg)
-	if err != nil {
-		panic(err)
+	// NOTE: 使用memory engine时不依赖es
+	if !cfg.UseMemoryEngine() {
+		err = creatIndexIfNotExists(cfg)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	globalIndex, err = NewIndex(cfg)
@@ -39,12 +42,12 @@ func InitGlobalIndex(cfg *config.Index) {
 
 // TakeSnapshot ...
 func TakeSnapshot() []types.SnapRecord {
-	return globalIndex.EvalEngine.TakeSnapshot()
+	return globalIndex.TakeSnapshot()
 }
 
 // LoadSnapshot ...
 func LoadSnapshot(data []types.SnapRecord) error {
-	return globalIndex.EvalEngine.LoadSnapshot(data)
+	return globalIndex.LoadSnapshot(data)
 }
 
 // BulkUpsert ...
@@ -62,16 +65,97 @@ func BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []types.Subject, logge
 	globalIndex.BulkDeleteBySubjects(beforeUpdatedAt, subjects, logger)
 }
 
+// PurgeExpired ...
+func PurgeExpired(beforeExpiredAt int64, logger *logrus.Entry) (map[string]uint64, error) {
+	return globalIndex.PurgeExpired(beforeExpiredAt, logger)
+}
+
 // Search ...
-func Search(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) ([]types.Subject, error) {
+func Search(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+) ([]types.Subject, types.SearchPhases, error) {
 	return globalIndex.Search(ctx, req, entry)
 }
 
 // BatchSearch ...
-func BatchSearch(ctx context.Context, requests []*types.SearchRequest, entry *debug.Entry) ([][]types.Subject, error) {
+func BatchSearch(
+	ctx context.Context,
+	requests []*types.SearchRequest,
+	entry *debug.Entry,
+) ([][]types.Subject, []types.BatchSearchItemStatus) {
 	return globalIndex.BatchSearch(ctx, requests, entry)
 }
 
+// ListActionsByResource ...
+func ListActionsByResource(system string, resource types.Resource) ([]string, error) {
+	return globalIndex.ListActionsByResource(system, resource)
+}
+
+// ReverseSearch ...
+func ReverseSearch(
+	ctx context.Context,
+	req *types.ReverseSearchRequest,
+	entry *debug.Entry,
+) (*types.ReverseSearchResult, error) {
+	return globalIndex.ReverseSearch(ctx, req, entry)
+}
+
+// Explain ...
+func Explain(ctx context.Context, req *types.ExplainRequest, entry *debug.Entry) ([]types.ExplainPolicy, error) {
+	return globalIndex.Explain(ctx, req, entry)
+}
+
+// Count ...
+func Count(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) (uint64, error) {
+	return globalIndex.Count(ctx, req, entry)
+}
+
+// BatchCount ...
+func BatchCount(ctx context.Context, requests []*types.SearchRequest, entry *debug.Entry) ([]uint64, error) {
+	return globalIndex.BatchCount(ctx, requests, entry)
+}
+
+// PageSearch ...
+func PageSearch(ctx context.Context, req *types.SearchRequest, entry *debug.Entry) ([]types.Subject, string, error) {
+	return globalIndex.PageSearch(ctx, req, entry)
+}
+
+// StreamSearch ...
+func StreamSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+	writeFn func(subjects []types.Subject) error,
+) error {
+	return globalIndex.StreamSearch(ctx, req, entry, writeFn)
+}
+
+// ExpiringSearch ...
+func ExpiringSearch(
+	ctx context.Context,
+	req *types.ExpiringSearchRequest,
+	entry *debug.Entry,
+) ([]types.SubjectExpiry, error) {
+	return globalIndex.ExpiringSearch(ctx, req, entry)
+}
+
+// ListMemberGroupIDs return the group ids in the local membership index
+func ListMemberGroupIDs() []string {
+	return globalIndex.GroupMemberIndex.GroupIDs()
+}
+
+// BulkSetGroupMembers ...
+func BulkSetGroupMembers(groupIDs []string, members []types.GroupMember) {
+	globalIndex.GroupMemberIndex.BulkSet(groupIDs, members)
+}
+
+// EvictInactiveGroupMembers ...
+func EvictInactiveGroupMembers(beforeAccessedAt int64) int {
+	return globalIndex.GroupMemberIndex.EvictInactive(beforeAccessedAt)
+}
+
 // Stats ...
 func Stats(system, action string) map[string]uint64 {
 	return globalIndex.Stats(system, action)
@@ -0,0 +1,261 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+
+	"engine/pkg/types"
+)
+
+// GroupMemberIndex the local membership index of the groups
+// NOTE: 只保存被检索到过的用户组, 由同步任务定时刷新, 长时间未被访问的用户组会被清理
+type GroupMemberIndex struct {
+	groups map[string]*groupMembers
+
+	mu *sync.RWMutex
+}
+
+type groupMembers struct {
+	members []types.GroupMember
+
+	lastAccessedAt int64
+}
+
+// NewGroupMemberIndex ...
+func NewGroupMemberIndex() *GroupMemberIndex {
+	return &GroupMemberIndex{
+		groups: make(map[string]*groupMembers, 100),
+		mu:     new(sync.RWMutex),
+	}
+}
+
+// Get will return the members of the groups, and the group ids not in the index
+func (m *GroupMemberIndex) Get(groupIDs []string) (map[string][]types.GroupMember, []string) {
+	now := time.Now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := make(map[string][]types.GroupMember, len(groupIDs))
+	missingGroupIDs := make([]string, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		group, ok := m.groups[groupID]
+		if !ok {
+			missingGroupIDs = append(missingGroupIDs, groupID)
+			continue
+		}
+
+		group.lastAccessedAt = now
+		members[groupID] = group.members
+	}
+	return members, missingGroupIDs
+}
+
+// BulkSet will replace the members of the groups
+func (m *GroupMemberIndex) BulkSet(groupIDs []string, members []types.GroupMember) {
+	now := time.Now().Unix()
+
+	groupMembersMap := make(map[string][]types.GroupMember, len(groupIDs))
+	for _, groupID := range groupIDs {
+		groupMembersMap[groupID] = []types.GroupMember{}
+	}
+	for _, member := range members {
+		member.Subject.FillUID()
+		groupMembersMap[member.GroupID] = append(groupMembersMap[member.GroupID], member)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for groupID, ms := range groupMembersMap {
+		group, ok := m.groups[groupID]
+		if !ok {
+			m.groups[groupID] = &groupMembers{members: ms, lastAccessedAt: now}
+			continue
+		}
+		group.members = ms
+	}
+}
+
+// GroupIDs return all the group ids in the index
+func (m *GroupMemberIndex) GroupIDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groupIDs := make([]string, 0, len(m.groups))
+	for groupID := range m.groups {
+		groupIDs = append(groupIDs, groupID)
+	}
+	return groupIDs
+}
+
+// EvictInactive will delete the groups not accessed after the timestamp, return the count deleted
+func (m *GroupMemberIndex) EvictInactive(beforeAccessedAt int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for groupID, group := range m.groups {
+		if group.lastAccessedAt < beforeAccessedAt {
+			delete(m.groups, groupID)
+			count++
+		}
+	}
+	return count
+}
+
+// Size ...
+func (m *GroupMemberIndex) Size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.groups)
+}
+
+// groupMemberBatchSize the count of groups fetched from iam backend in one request, the same as the sync task
+const groupMemberBatchSize = 100
+
+// loadGroupMembers will return the members of the groups, fetch from iam backend if not in the index
+// NOTE: 拉取在后台执行, ctx超时直接返回错误不阻塞检索, 已拉取成功的批次依然会写入索引供后续检索使用
+func loadGroupMembers(
+	ctx context.Context,
+	memberIndex *GroupMemberIndex,
+	groupIDs []string,
+	listGroupMember func(groupIDs []string) ([]types.GroupMember, error),
+) (map[string][]types.GroupMember, error) {
+	members, missingGroupIDs := memberIndex.Get(groupIDs)
+	if len(missingGroupIDs) == 0 {
+		return members, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fetchGroupMembers(ctx, memberIndex, missingGroupIDs, listGroupMember)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, fmt.Errorf("load group members timeout: %w", ctx.Err())
+	}
+
+	newMembers, _ := memberIndex.Get(missingGroupIDs)
+	for groupID, ms := range newMembers {
+		members[groupID] = ms
+	}
+	return members, nil
+}
+
+// fetchGroupMembers fetch the members of the groups from iam backend batch by batch, and set into the index
+func fetchGroupMembers(
+	ctx context.Context,
+	memberIndex *GroupMemberIndex,
+	groupIDs []string,
+	listGroupMember func(groupIDs []string) ([]types.GroupMember, error),
+) error {
+	for start := 0; start < len(groupIDs); start += groupMemberBatchSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		end := start + groupMemberBatchSize
+		if end > len(groupIDs) {
+			end = len(groupIDs)
+		}
+
+		ids := groupIDs[start:end]
+		members, err := listGroupMember(ids)
+		if err != nil {
+			return fmt.Errorf("list group member group_ids=`%v` fail: %w", ids, err)
+		}
+		memberIndex.BulkSet(ids, members)
+	}
+	return nil
+}
+
+// expandGroupMembers will expand the group subjects to their member users
+// NOTE: limit是对展开前的subjects生效的, 展开后再截断, 所以如果用户组成员都已过期, 返回的数量可能小于limit
+func expandGroupMembers(
+	req *types.SearchRequest,
+	subjects []types.Subject,
+	groupMembers map[string][]types.GroupMember,
+) []types.Subject {
+	// 查询用户组时不需要展开
+	if req.SubjectType == types.SubjectTypeGroup {
+		return subjects
+	}
+
+	expandedSubjects := make([]types.Subject, 0, len(subjects))
+	subjectUIDs := set.NewFixedLengthStringSet(len(subjects))
+	// only return the candidate subjects after expanding
+	candidateUIDs := req.SubjectUIDSet()
+
+	appendSubject := func(subject types.Subject) {
+		if subjectUIDs.Has(subject.UID) {
+			return
+		}
+		if candidateUIDs != nil && !candidateUIDs.Has(subject.UID) {
+			return
+		}
+		expandedSubjects = append(expandedSubjects, subject)
+		subjectUIDs.Add(subject.UID)
+	}
+
+	// 1. the subjects matched directly
+	for _, subject := range subjects {
+		if req.SubjectType == types.SubjectTypeUser && subject.Type != types.SubjectTypeUser {
+			continue
+		}
+		appendSubject(subject)
+	}
+
+	// 2. the member users of the groups matched
+	for _, subject := range subjects {
+		if subject.Type != types.SubjectTypeGroup {
+			continue
+		}
+
+		for _, member := range groupMembers[subject.ID] {
+			if member.ExpiredAt < req.NowTimestamp || member.Subject.Type != types.SubjectTypeUser {
+				continue
+			}
+			// NOTE: 成员用户的权限来自于用户组的策略
+			memberSubject := member.Subject
+			memberSubject.Policies = subject.Policies
+			appendSubject(memberSubject)
+		}
+	}
+
+	if req.Limit > 0 && len(expandedSubjects) > req.Limit {
+		return expandedSubjects[:req.Limit]
+	}
+	return expandedSubjects
+}
+
+func groupIDsOfSubjects(subjects []types.Subject) []string {
+	groupIDs := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		if subject.Type == types.SubjectTypeGroup {
+			groupIDs = append(groupIDs, subject.ID)
+		}
+	}
+	return groupIDs
+}
@@ -0,0 +1,165 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/types"
+)
+
+var _ = Describe("Member", func() {
+	var group types.Subject
+	var user types.Subject
+	var groupMembers map[string][]types.GroupMember
+
+	BeforeEach(func() {
+		group = types.Subject{Type: "group", ID: "1", UID: "group:1"}
+		user = types.Subject{Type: "user", ID: "admin", UID: "user:admin"}
+		groupMembers = map[string][]types.GroupMember{
+			"1": {
+				{GroupID: "1", Subject: types.Subject{Type: "user", ID: "tom", UID: "user:tom"}, ExpiredAt: 200},
+				{GroupID: "1", Subject: types.Subject{Type: "user", ID: "jerry", UID: "user:jerry"}, ExpiredAt: 50},
+				{GroupID: "1", Subject: types.Subject{Type: "user", ID: "admin", UID: "user:admin"}, ExpiredAt: 200},
+			},
+		}
+	})
+
+	Describe("GroupMemberIndex", func() {
+		It("get and set", func() {
+			m := NewGroupMemberIndex()
+
+			members, missing := m.Get([]string{"1", "2"})
+			assert.Empty(GinkgoT(), members)
+			assert.Equal(GinkgoT(), []string{"1", "2"}, missing)
+
+			m.BulkSet([]string{"1", "2"}, []types.GroupMember{
+				{GroupID: "1", Subject: types.Subject{Type: "user", ID: "tom"}, ExpiredAt: 200},
+			})
+			members, missing = m.Get([]string{"1", "2"})
+			assert.Empty(GinkgoT(), missing)
+			assert.Len(GinkgoT(), members["1"], 1)
+			assert.Equal(GinkgoT(), "user:tom", members["1"][0].Subject.UID)
+			assert.Empty(GinkgoT(), members["2"])
+			assert.Equal(GinkgoT(), 2, m.Size())
+		})
+
+		It("evict inactive", func() {
+			m := NewGroupMemberIndex()
+			m.BulkSet([]string{"1"}, nil)
+
+			assert.Equal(GinkgoT(), 0, m.EvictInactive(0))
+			assert.Equal(GinkgoT(), 1, m.EvictInactive(1<<62))
+			assert.Equal(GinkgoT(), 0, m.Size())
+		})
+	})
+
+	Describe("loadGroupMembers", func() {
+		var groupIDs []string
+
+		BeforeEach(func() {
+			groupIDs = make([]string, 0, groupMemberBatchSize+2)
+			for i := 0; i < groupMemberBatchSize+2; i++ {
+				groupIDs = append(groupIDs, strconv.Itoa(i))
+			}
+		})
+
+		It("batch", func() {
+			m := NewGroupMemberIndex()
+			m.BulkSet([]string{"0"}, nil)
+
+			batches := make([][]string, 0, 2)
+			members, err := loadGroupMembers(context.Background(), m, groupIDs,
+				func(ids []string) ([]types.GroupMember, error) {
+					batches = append(batches, ids)
+					return []types.GroupMember{{GroupID: ids[0], Subject: types.Subject{Type: "user", ID: "tom"}}}, nil
+				})
+			assert.NoError(GinkgoT(), err)
+			assert.Len(GinkgoT(), members, groupMemberBatchSize+2)
+			assert.Len(GinkgoT(), members["1"], 1)
+
+			// the group 0 in the index
+			assert.Len(GinkgoT(), batches, 2)
+			assert.Len(GinkgoT(), batches[0], groupMemberBatchSize)
+			assert.Equal(GinkgoT(), []string{strconv.Itoa(groupMemberBatchSize + 1)}, batches[1])
+		})
+
+		It("fail", func() {
+			_, err := loadGroupMembers(context.Background(), NewGroupMemberIndex(), groupIDs,
+				func(ids []string) ([]types.GroupMember, error) {
+					return nil, errors.New("iam backend error")
+				})
+			assert.Error(GinkgoT(), err)
+			assert.Contains(GinkgoT(), err.Error(), "iam backend error")
+		})
+
+		It("timeout", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			unblock := make(chan struct{})
+			defer close(unblock)
+
+			start := time.Now()
+			_, err := loadGroupMembers(ctx, NewGroupMemberIndex(), groupIDs,
+				func(ids []string) ([]types.GroupMember, error) {
+					<-unblock
+					return nil, nil
+				})
+			assert.ErrorIs(GinkgoT(), err, context.DeadlineExceeded)
+			assert.Less(GinkgoT(), time.Since(start), time.Second)
+		})
+	})
+
+	Describe("expandGroupMembers", func() {
+		It("user", func() {
+			req := &types.SearchRequest{SubjectType: "user", ExpandGroups: true, NowTimestamp: 100}
+			subjects := expandGroupMembers(req, []types.Subject{group, user}, groupMembers)
+			assert.Equal(GinkgoT(), []string{"user:admin", "user:tom"}, uidsOf(subjects))
+		})
+
+		It("all", func() {
+			req := &types.SearchRequest{SubjectType: "all", ExpandGroups: true, NowTimestamp: 100}
+			subjects := expandGroupMembers(req, []types.Subject{group, user}, groupMembers)
+			assert.Equal(GinkgoT(), []string{"group:1", "user:admin", "user:tom"}, uidsOf(subjects))
+		})
+
+		It("group", func() {
+			req := &types.SearchRequest{SubjectType: "group", ExpandGroups: true, NowTimestamp: 100}
+			subjects := expandGroupMembers(req, []types.Subject{group}, groupMembers)
+			assert.Equal(GinkgoT(), []string{"group:1"}, uidsOf(subjects))
+		})
+
+		It("candidate subjects", func() {
+			req := &types.SearchRequest{
+				SubjectType:  "all",
+				ExpandGroups: true,
+				NowTimestamp: 100,
+				Subjects:     []types.Subject{{Type: "user", ID: "tom"}},
+			}
+			subjects := expandGroupMembers(req, []types.Subject{group, user}, groupMembers)
+			assert.Equal(GinkgoT(), []string{"user:tom"}, uidsOf(subjects))
+		})
+
+		It("limit", func() {
+			req := &types.SearchRequest{SubjectType: "user", ExpandGroups: true, NowTimestamp: 100, Limit: 1}
+			subjects := expandGroupMembers(req, []types.Subject{group}, groupMembers)
+			assert.Equal(GinkgoT(), []string{"user:tom"}, uidsOf(subjects))
+		})
+	})
+})
@@ -0,0 +1,186 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TencentBlueKing/gopkg/collection/set"
+	log "github.com/sirupsen/logrus"
+
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+// streamSearchPageSize the page size of the doc engine in the stream search
+const streamSearchPageSize = 1000
+
+// StreamSearch search the subjects page by page, and write each page by the writeFn as soon as it is produced,
+// no limit if req.Limit <= 0
+// NOTE: 先计算eval(需要完整结果, 出错时还未写出任何数据), 再按subject uid分页查询doc引擎, 最后写出eval的subjects
+// NOTE: eval与doc的每一页分别使用batch search的超时时间, 不限制整个stream的时长;
+// doc引擎支持point in time时, 所有分页在同一个point in time上查询, 期间的策略变更不会导致subject遗漏或重复
+func (i *Index) StreamSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	entry *debug.Entry,
+	writeFn func(subjects []types.Subject) error,
+) error {
+	// 记录debug上下文
+	debug.WithValues(entry, types.H{
+		"system":       req.System,
+		"action":       req.Action,
+		"resource":     req.Resource,
+		"subject_type": req.SubjectType,
+		"limit":        req.Limit,
+	})
+
+	timeout := searchTimeout(&i.SearchTimeout, req, true)
+
+	debug.AddStep(entry, "execute eval policies")
+	evalSubjectUIDs := set.NewStringSet()
+	evalSubjects, err := i.streamEvalSubjects(ctx, req, timeout, evalSubjectUIDs, entry)
+	if err != nil {
+		return err
+	}
+
+	debug.AddStep(entry, "open doc point in time")
+	pitID, err := i.openStreamPointInTime(ctx, timeout)
+	if err != nil {
+		return err
+	}
+	pageReq := *req
+	pageReq.SearchCursor = &types.SearchCursor{PitID: pitID}
+	if pitID != "" {
+		// NOTE: pit id在每次分页后可能变化, 关闭最新的
+		defer func() {
+			i.closeStreamPointInTime(pageReq.SearchCursor.PitID, timeout)
+		}()
+	}
+
+	written := 0
+	reachLimit := func() bool {
+		return req.Limit > 0 && written >= req.Limit
+	}
+
+	debug.AddStep(entry, "execute doc page queries")
+	for !reachLimit() {
+		page, err := i.streamDocPage(ctx, &pageReq, timeout, entry)
+		if err != nil {
+			return err
+		}
+
+		// the subjects in eval will be written at last
+		subjects := make([]types.Subject, 0, len(page.Subjects))
+		for _, subject := range page.Subjects {
+			if !evalSubjectUIDs.Has(subject.UID) {
+				subjects = append(subjects, subject)
+			}
+		}
+
+		if err = writeStreamSubjects(req, subjects, &written, writeFn); err != nil {
+			return err
+		}
+
+		if !page.HasMore || len(page.Subjects) == 0 {
+			break
+		}
+
+		cursor := types.NewSearchCursor(page.LastSubjectUID())
+		cursor.PitID = pageReq.SearchCursor.PitID
+		if page.PitID != "" {
+			cursor.PitID = page.PitID
+		}
+		pageReq.SearchCursor = cursor
+	}
+
+	if reachLimit() {
+		return nil
+	}
+	return writeStreamSubjects(req, evalSubjects, &written, writeFn)
+}
+
+// streamEvalSubjects return the complete subjects of the eval engine, and add the uids into the evalSubjectUIDs
+func (i *Index) streamEvalSubjects(
+	ctx context.Context,
+	req *types.SearchRequest,
+	timeout time.Duration,
+	evalSubjectUIDs *set.StringSet,
+	entry *debug.Entry,
+) ([]types.Subject, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	evalResult, err := i.EvalEngine.Search(ctx, req, entry)
+	if err != nil {
+		return nil, err
+	}
+	if evalResult.Partial() {
+		return nil, fmt.Errorf("eval stream search timeout: %w", ctx.Err())
+	}
+	return evalResult.GetSubjects(evalSubjectUIDs), nil
+}
+
+// streamDocPage search one page of the doc engine within the timeout
+func (i *Index) streamDocPage(
+	ctx context.Context,
+	req *types.SearchRequest,
+	timeout time.Duration,
+	entry *debug.Entry,
+) (*types.SearchPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return i.DocEngine.PageSearch(ctx, req, streamSearchPageSize, entry)
+}
+
+// openStreamPointInTime open the point in time of the doc engine, empty if not support
+func (i *Index) openStreamPointInTime(ctx context.Context, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return i.DocEngine.OpenPointInTime(ctx)
+}
+
+// closeStreamPointInTime close the point in time, the error is only logged, it will expire after the keep alive
+// NOTE: 请求的ctx可能已经被取消(客户端断开), 使用独立的ctx关闭
+func (i *Index) closeStreamPointInTime(pitID string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := i.DocEngine.ClosePointInTime(ctx, pitID); err != nil {
+		log.WithError(err).Warn("close the point in time of the stream search fail")
+	}
+}
+
+// writeStreamSubjects write the subjects not beyond the limit, and add the count into written
+func writeStreamSubjects(
+	req *types.SearchRequest,
+	subjects []types.Subject,
+	written *int,
+	writeFn func(subjects []types.Subject) error,
+) error {
+	if req.Limit > 0 && *written+len(subjects) > req.Limit {
+		subjects = subjects[:req.Limit-*written]
+	}
+	if len(subjects) == 0 {
+		return nil
+	}
+
+	if err := writeFn(subjects); err != nil {
+		return fmt.Errorf("write stream subjects fail: %w", err)
+	}
+	*written += len(subjects)
+	return nil
+}
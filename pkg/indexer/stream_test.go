@@ -0,0 +1,187 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
+	"github.com/TencentBlueKing/iam-go-sdk/expression/operator"
+	. "github.com/onsi/ginkgo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/logging/debug"
+	"engine/pkg/types"
+)
+
+var _ = Describe("StreamSearch", func() {
+	var idx *Index
+	logger := logrus.NewEntry(logrus.New())
+
+	newRequest := func(limit int) *types.SearchRequest {
+		return &types.SearchRequest{
+			System: "bk_cmdb",
+			Action: types.Action{ID: "view_host"},
+			Resource: []types.ResourceNode{
+				{System: "bk_cmdb", Type: "host", ID: "1", Attribute: map[string]interface{}{"id": "1"}},
+			},
+			SubjectType:  types.SubjectTypeAll,
+			Limit:        limit,
+			NowTimestamp: 100,
+		}
+	}
+
+	BeforeEach(func() {
+		impls.LocalResourceTypeSystemsCache = memory.NewCache(
+			"mockCache", false, func(key cache.Key) (interface{}, error) {
+				return map[string]string{}, nil
+			}, time.Minute)
+
+		var err error
+		idx, err = NewIndex(&config.Index{Engine: config.IndexEngineMemory})
+		assert.NoError(GinkgoT(), err)
+
+		newPolicy := func(id int64, userID string, expr expression.ExprCell) types.Policy {
+			return types.Policy{
+				ID:         id,
+				System:     "bk_cmdb",
+				Actions:    []types.Action{{ID: "view_host"}},
+				Subject:    types.Subject{Type: "user", ID: userID},
+				Expression: expr,
+				ExpiredAt:  200,
+				UpdatedAt:  100,
+			}
+		}
+
+		// more than one page of doc policies
+		policies := make([]types.Policy, 0, streamSearchPageSize+2)
+		for i := 0; i < streamSearchPageSize+1; i++ {
+			policies = append(policies, newPolicy(int64(i+1), fmt.Sprintf("doc%04d", i),
+				expression.ExprCell{OP: operator.Eq, Field: "host.id", Value: "1"}))
+		}
+		// eval policies, doc0000 also in doc engine
+		policies = append(policies,
+			newPolicy(10001, "doc0000", expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: "1"}),
+			newPolicy(10002, "eval", expression.ExprCell{OP: operator.StartsWith, Field: "host.id", Value: "1"}),
+		)
+		idx.BulkUpsert(policies, logger)
+	})
+
+	It("all pages", func() {
+		pages := 0
+		uids := make([]string, 0, streamSearchPageSize+2)
+		err := idx.StreamSearch(context.Background(), newRequest(-1), nil, func(subjects []types.Subject) error {
+			pages++
+			uids = append(uids, uidsOf(subjects)...)
+			return nil
+		})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), 3, pages)
+		assert.Len(GinkgoT(), uids, streamSearchPageSize+2)
+
+		// the subjects in eval are written at last
+		assert.Equal(GinkgoT(), "user:doc0001", uids[0])
+		assert.ElementsMatch(GinkgoT(), []string{"user:doc0000", "user:eval"}, uids[len(uids)-2:])
+	})
+
+	It("limit", func() {
+		uids := make([]string, 0, 3)
+		err := idx.StreamSearch(context.Background(), newRequest(3), nil, func(subjects []types.Subject) error {
+			uids = append(uids, uidsOf(subjects)...)
+			return nil
+		})
+		assert.NoError(GinkgoT(), err)
+		assert.Equal(GinkgoT(), []string{"user:doc0001", "user:doc0002", "user:doc0003"}, uids)
+	})
+
+	It("point in time", func() {
+		docEngine := &streamTestDocEngine{DocEngine: idx.DocEngine}
+		idx.DocEngine = docEngine
+
+		err := idx.StreamSearch(context.Background(), newRequest(-1), nil, func(subjects []types.Subject) error {
+			return nil
+		})
+		assert.NoError(GinkgoT(), err)
+		// the pit id changed after the first page
+		assert.Equal(GinkgoT(), []string{"pit-0", "pit-1"}, docEngine.pagePitIDs)
+		assert.Equal(GinkgoT(), "pit-1", docEngine.closedPitID)
+	})
+
+	It("timeout of each page", func() {
+		idx.DocEngine = &streamTestDocEngine{DocEngine: idx.DocEngine, pageDelay: 30 * time.Millisecond}
+		idx.SearchTimeout = config.SearchTimeout{BatchSearch: 50}
+
+		// the whole stream is longer than the timeout
+		uids := make([]string, 0, streamSearchPageSize+2)
+		err := idx.StreamSearch(context.Background(), newRequest(-1), nil, func(subjects []types.Subject) error {
+			time.Sleep(30 * time.Millisecond)
+			uids = append(uids, uidsOf(subjects)...)
+			return nil
+		})
+		assert.NoError(GinkgoT(), err)
+		assert.Len(GinkgoT(), uids, streamSearchPageSize+2)
+	})
+
+	It("write fail", func() {
+		err := idx.StreamSearch(context.Background(), newRequest(-1), nil, func(subjects []types.Subject) error {
+			return errors.New("broken pipe")
+		})
+		assert.Error(GinkgoT(), err)
+		assert.Contains(GinkgoT(), err.Error(), "broken pipe")
+	})
+})
+
+// streamTestDocEngine record the point in time of each page, the pit id changed after each page
+type streamTestDocEngine struct {
+	types.DocEngine
+
+	pageDelay   time.Duration
+	pagePitIDs  []string
+	closedPitID string
+}
+
+func (e *streamTestDocEngine) OpenPointInTime(ctx context.Context) (string, error) {
+	return "pit-0", nil
+}
+
+func (e *streamTestDocEngine) ClosePointInTime(ctx context.Context, pitID string) error {
+	e.closedPitID = pitID
+	return nil
+}
+
+func (e *streamTestDocEngine) PageSearch(
+	ctx context.Context,
+	req *types.SearchRequest,
+	size int,
+	entry *debug.Entry,
+) (*types.SearchPage, error) {
+	time.Sleep(e.pageDelay)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	e.pagePitIDs = append(e.pagePitIDs, req.SearchCursor.PitID)
+	page, err := e.DocEngine.PageSearch(ctx, req, size, entry)
+	if err != nil {
+		return nil, err
+	}
+	page.PitID = fmt.Sprintf("pit-%d", len(e.pagePitIDs))
+	return page, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"engine/pkg/config"
+	"engine/pkg/types"
+)
+
+const (
+	defaultSearchTimeout      = 100 * time.Millisecond
+	defaultBatchSearchTimeout = 500 * time.Millisecond
+	defaultMaxSearchTimeout   = 5 * time.Second
+)
+
+// searchTimeout return the timeout of the request, the default timeout if timeout_ms not set, bounded by the max
+func searchTimeout(cfg *config.SearchTimeout, req *types.SearchRequest, batch bool) time.Duration {
+	return requestTimeout(cfg, req.TimeoutMs, batch)
+}
+
+// requestTimeout return the timeoutMs if set, otherwise the default timeout of the config, bounded by the max
+// NOTE: 没有timeout_ms参数的请求(reverse search/explain)传0, 使用配置的超时时间
+func requestTimeout(cfg *config.SearchTimeout, timeoutMs int, batch bool) time.Duration {
+	timeout := defaultSearchTimeout
+	if cfg.Search > 0 {
+		timeout = time.Duration(cfg.Search) * time.Millisecond
+	}
+	if batch {
+		timeout = defaultBatchSearchTimeout
+		if cfg.BatchSearch > 0 {
+			timeout = time.Duration(cfg.BatchSearch) * time.Millisecond
+		}
+	}
+
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+
+	if maxTimeout := maxSearchTimeout(cfg); timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	return timeout
+}
+
+// maxSearchTimeout return the max timeout of the config, the default max if not set
+func maxSearchTimeout(cfg *config.SearchTimeout) time.Duration {
+	if cfg.Max > 0 {
+		return time.Duration(cfg.Max) * time.Millisecond
+	}
+	return defaultMaxSearchTimeout
+}
+
+// errorPhase return the phase status of the error, timeout if the context is done
+func errorPhase(ctx context.Context, err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return types.SearchPhaseTimeout
+	}
+	return types.SearchPhaseError
+}
@@ -0,0 +1,109 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+
+	"engine/pkg/config"
+	"engine/pkg/types"
+)
+
+var _ = Describe("Timeout", func() {
+	Describe("searchTimeout", func() {
+		It("default", func() {
+			cfg := &config.SearchTimeout{}
+			req := &types.SearchRequest{}
+			assert.Equal(GinkgoT(), defaultSearchTimeout, searchTimeout(cfg, req, false))
+			assert.Equal(GinkgoT(), defaultBatchSearchTimeout, searchTimeout(cfg, req, true))
+		})
+
+		It("config", func() {
+			cfg := &config.SearchTimeout{Search: 200, BatchSearch: 1000}
+			req := &types.SearchRequest{}
+			assert.Equal(GinkgoT(), 200*time.Millisecond, searchTimeout(cfg, req, false))
+			assert.Equal(GinkgoT(), time.Second, searchTimeout(cfg, req, true))
+		})
+
+		It("timeout_ms", func() {
+			cfg := &config.SearchTimeout{}
+			req := &types.SearchRequest{TimeoutMs: 300}
+			assert.Equal(GinkgoT(), 300*time.Millisecond, searchTimeout(cfg, req, false))
+			assert.Equal(GinkgoT(), 300*time.Millisecond, searchTimeout(cfg, req, true))
+		})
+
+		It("bounded by the max", func() {
+			req := &types.SearchRequest{TimeoutMs: 60000}
+			assert.Equal(GinkgoT(), defaultMaxSearchTimeout, searchTimeout(&config.SearchTimeout{}, req, false))
+			assert.Equal(GinkgoT(), time.Second, searchTimeout(&config.SearchTimeout{Max: 1000}, req, false))
+		})
+	})
+
+	Describe("requestTimeout", func() {
+		It("without timeout_ms", func() {
+			cfg := &config.SearchTimeout{Search: 200, BatchSearch: 1000}
+			assert.Equal(GinkgoT(), 200*time.Millisecond, requestTimeout(cfg, 0, false))
+			assert.Equal(GinkgoT(), time.Second, requestTimeout(cfg, 0, true))
+		})
+	})
+
+	Describe("errorPhase", func() {
+		It("error", func() {
+			assert.Equal(GinkgoT(), types.SearchPhaseError, errorPhase(context.Background(), errors.New("fail")))
+		})
+
+		It("timeout", func() {
+			err := errors.New("fail")
+			assert.Equal(GinkgoT(), types.SearchPhaseTimeout, errorPhase(context.Background(), context.DeadlineExceeded))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.Equal(GinkgoT(), types.SearchPhaseTimeout, errorPhase(ctx, err))
+		})
+	})
+
+	Describe("newBatchSearchItemStatus", func() {
+		It("ok", func() {
+			phases := types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseSkipped}
+			status := newBatchSearchItemStatus(phases, nil)
+			assert.Equal(GinkgoT(), types.BatchSearchStatusOK, status.Status)
+			assert.False(GinkgoT(), status.Partial)
+		})
+
+		It("partial", func() {
+			phases := types.SearchPhases{Doc: types.SearchPhaseDone, Eval: types.SearchPhaseTimeout}
+			status := newBatchSearchItemStatus(phases, nil)
+			assert.Equal(GinkgoT(), types.BatchSearchStatusTimeout, status.Status)
+			assert.True(GinkgoT(), status.Partial)
+			assert.NotEmpty(GinkgoT(), status.Message)
+		})
+
+		It("doc timeout", func() {
+			phases := types.SearchPhases{Doc: types.SearchPhaseTimeout, Eval: types.SearchPhaseSkipped}
+			status := newBatchSearchItemStatus(phases, context.DeadlineExceeded)
+			assert.Equal(GinkgoT(), types.BatchSearchStatusTimeout, status.Status)
+			assert.False(GinkgoT(), status.Partial)
+		})
+
+		It("error", func() {
+			phases := types.SearchPhases{Doc: types.SearchPhaseError, Eval: types.SearchPhaseSkipped}
+			status := newBatchSearchItemStatus(phases, errors.New("fail"))
+			assert.Equal(GinkgoT(), types.BatchSearchStatusError, status.Status)
+			assert.Equal(GinkgoT(), "fail", status.Message)
+		})
+	})
+})
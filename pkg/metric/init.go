@@ -86,6 +86,15 @@ var (
 		Buckets:     []float64{20, 50, 100, 200, 500, 1000, 2000, 5000},
 	})
 
+	// ExpiredPolicyPurged 定时清理的过期策略数量
+	ExpiredPolicyPurged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "bkiam_search_engine_expired_policy_purged_total",
+		Help:        "How many expired policies purged, partitioned by engine.",
+		ConstLabels: prometheus.Labels{"service": serviceName},
+	},
+		[]string{"engine"},
+	)
+
 	// SnapshotDumpFail 当前这次同步失败了, 检测到直接告警
 	SnapshotDumpFail = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name:        "bkiam_search_engine_snapshot_dump_fail",
@@ -105,4 +114,5 @@ func InitMetrics() {
 	prometheus.MustRegister(SyncTaskDuration)
 	prometheus.MustRegister(EsSearchDuration)
 	prometheus.MustRegister(SnapshotDumpFail)
+	prometheus.MustRegister(ExpiredPolicyPurged)
 }
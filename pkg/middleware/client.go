@@ -12,6 +12,7 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -29,13 +30,16 @@ const (
 
 // NewClientAuthMiddleware ...
 func NewClientAuthMiddleware(c *config.Config) gin.HandlerFunc {
-	var apiGatewayPublicKey []byte
+	return ClientAuthMiddleware(getAPIGatewayPublicKey(c))
+}
+
+// getAPIGatewayPublicKey return the apigateway public key in the config, nil if not configured
+func getAPIGatewayPublicKey(c *config.Config) []byte {
 	apigwCrypto, ok := c.Cryptos["apigateway_public_key"]
-	if ok {
-		apiGatewayPublicKey = []byte(apigwCrypto.Key)
+	if !ok {
+		return nil
 	}
-
-	return ClientAuthMiddleware(apiGatewayPublicKey)
+	return []byte(apigwCrypto.Key)
 }
 
 // ClientAuthMiddleware ...
@@ -43,56 +47,19 @@ func ClientAuthMiddleware(apiGatewayPublicKey []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Debug("Middleware: ClientAuthMiddleware")
 
-		requestFrom := c.GetHeader("X-Bkapi-From")
-
-		var clientID string
-
-		// X-Bkapi-From: apigw
-		if requestFrom == APIGatewayRequest {
-			jwtToken := c.GetHeader("X-Bkapi-JWT")
-			// should not be empty
-			if jwtToken == "" {
-				util.UnauthorizedJSONResponse(c, "request from apigateway jwt token should not be empty!")
-				c.Abort()
-				return
-			}
-			if len(apiGatewayPublicKey) == 0 {
-				util.UnauthorizedJSONResponse(
-					c,
-					"iam apigateway public key is not configured, not support request from apigateway",
-				)
-				c.Abort()
-				return
-			}
-
-			var err error
-			clientID, err = getClientIDFromJWTToken(jwtToken, apiGatewayPublicKey)
-			if err != nil {
-				message := fmt.Sprintf("request from apigateway jwt token invalid! err=%s", err.Error())
-				util.UnauthorizedJSONResponse(c, message)
-				c.Abort()
-				return
-			}
-		} else {
-			appCode := c.GetHeader("X-Bk-App-Code")
-			appSecret := c.GetHeader("X-Bk-App-Secret")
-
-			// 1. check not empty
-			if appCode == "" || appSecret == "" {
-				util.UnauthorizedJSONResponse(c, "app code and app secret required")
-				c.Abort()
-				return
-			}
-
-			// 2. validate from cache -> database
-			valid := impls.VerifyAppCodeAppSecret(appCode, appSecret)
-			if !valid {
-				util.UnauthorizedJSONResponse(c, "app code or app secret wrong")
-				c.Abort()
-				return
-			}
-
-			clientID = appCode
+		clientID, err := AuthenticateClient(
+			ClientCredential{
+				RequestFrom: c.GetHeader("X-Bkapi-From"),
+				JWTToken:    c.GetHeader("X-Bkapi-JWT"),
+				AppCode:     c.GetHeader("X-Bk-App-Code"),
+				AppSecret:   c.GetHeader("X-Bk-App-Secret"),
+			},
+			apiGatewayPublicKey,
+		)
+		if err != nil {
+			util.UnauthorizedJSONResponse(c, err.Error())
+			c.Abort()
+			return
 		}
 
 		// 3. set client_id
@@ -101,3 +68,44 @@ func ClientAuthMiddleware(apiGatewayPublicKey []byte) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// ClientCredential the credential of the client, from the http headers or the grpc metadata
+type ClientCredential struct {
+	RequestFrom string
+	JWTToken    string
+	AppCode     string
+	AppSecret   string
+}
+
+// AuthenticateClient return the client id, by the apigateway jwt token or the app code/secret
+func AuthenticateClient(credential ClientCredential, apiGatewayPublicKey []byte) (string, error) {
+	// X-Bkapi-From: apigw
+	if credential.RequestFrom == APIGatewayRequest {
+		// should not be empty
+		if credential.JWTToken == "" {
+			return "", errors.New("request from apigateway jwt token should not be empty!")
+		}
+		if len(apiGatewayPublicKey) == 0 {
+			return "", errors.New("iam apigateway public key is not configured, not support request from apigateway")
+		}
+
+		clientID, err := getClientIDFromJWTToken(credential.JWTToken, apiGatewayPublicKey)
+		if err != nil {
+			return "", fmt.Errorf("request from apigateway jwt token invalid! err=%s", err.Error())
+		}
+		return clientID, nil
+	}
+
+	// 1. check not empty
+	if credential.AppCode == "" || credential.AppSecret == "" {
+		return "", errors.New("app code and app secret required")
+	}
+
+	// 2. validate from cache -> database
+	valid := impls.VerifyAppCodeAppSecret(credential.AppCode, credential.AppSecret)
+	if !valid {
+		return "", errors.New("app code or app secret wrong")
+	}
+
+	return credential.AppCode, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package middleware
+
+import (
+	"context"
+	"encoding/hex"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"engine/pkg/config"
+	"engine/pkg/util"
+)
+
+// getMetadataValue return the first value of the key in the grpc metadata, the key is the lower case http header
+func getMetadataValue(md metadata.MD, key string) string {
+	values := md.Get(strings.ToLower(key))
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// GRPCRecovery recover from the panic of the grpc handler, return the internal error
+func GRPCRecovery() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("grpc method %s panic: %v, stack: %s", info.FullMethod, r, debug.Stack())
+				err = status.Errorf(codes.Internal, "panic: %v", r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// GRPCRequestID add the request_id into the context of each grpc request, and send it back in the header
+func GRPCRequestID() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		requestID := getMetadataValue(md, util.RequestIDHeaderKey)
+		if requestID == "" || len(requestID) != 32 {
+			requestID = hex.EncodeToString(uuid.Must(uuid.NewV4()).Bytes())
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(util.RequestIDHeaderKey), requestID))
+
+		return handler(context.WithValue(ctx, util.ContextRequestIDKey, requestID), req)
+	}
+}
+
+// NewGRPCClientAuthInterceptor authenticate the client by the metadata, the same as the http headers
+func NewGRPCClientAuthInterceptor(c *config.Config) grpc.UnaryServerInterceptor {
+	apiGatewayPublicKey := getAPIGatewayPublicKey(c)
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		clientID, err := AuthenticateClient(
+			ClientCredential{
+				RequestFrom: getMetadataValue(md, "X-Bkapi-From"),
+				JWTToken:    getMetadataValue(md, "X-Bkapi-JWT"),
+				AppCode:     getMetadataValue(md, "X-Bk-App-Code"),
+				AppSecret:   getMetadataValue(md, "X-Bk-App-Secret"),
+			},
+			apiGatewayPublicKey,
+		)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "unauthorized:%s", err.Error())
+		}
+
+		return handler(util.WithClientID(ctx, clientID), req)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package middleware
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"engine/pkg/cache"
+	"engine/pkg/cache/impls"
+	"engine/pkg/cache/memory"
+	"engine/pkg/config"
+	"engine/pkg/util"
+)
+
+var _ = Describe("GRPC", func() {
+	Describe("NewGRPCClientAuthInterceptor", func() {
+		var interceptor grpc.UnaryServerInterceptor
+		var clientID string
+		var called bool
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			clientID = util.GetClientIDFromContext(ctx)
+			return nil, nil
+		}
+		info := &grpc.UnaryServerInfo{FullMethod: "/search.SearchService/Search"}
+
+		BeforeEach(func() {
+			impls.LocalAppCodeAppSecretCache = memory.NewCache(
+				"mockCache", false, func(key cache.Key) (interface{}, error) {
+					return key.Key() == "bk_cmdb:123", nil
+				}, time.Minute)
+			interceptor = NewGRPCClientAuthInterceptor(&config.Config{})
+			clientID = ""
+			called = false
+		})
+
+		It("ok", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"x-bk-app-code", "bk_cmdb", "x-bk-app-secret", "123",
+			))
+			_, err := interceptor(ctx, nil, info, handler)
+			assert.NoError(GinkgoT(), err)
+			assert.True(GinkgoT(), called)
+			assert.Equal(GinkgoT(), "bk_cmdb", clientID)
+		})
+
+		It("app secret wrong", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"x-bk-app-code", "bk_cmdb", "x-bk-app-secret", "456",
+			))
+			_, err := interceptor(ctx, nil, info, handler)
+			assert.Equal(GinkgoT(), codes.Unauthenticated, status.Code(err))
+			assert.False(GinkgoT(), called)
+		})
+
+		It("no metadata", func() {
+			_, err := interceptor(context.Background(), nil, info, handler)
+			assert.Equal(GinkgoT(), codes.Unauthenticated, status.Code(err))
+			assert.Contains(GinkgoT(), err.Error(), "app code and app secret required")
+			assert.False(GinkgoT(), called)
+		})
+
+		It("apigateway public key not configured", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"x-bkapi-from", APIGatewayRequest, "x-bkapi-jwt", "token",
+			))
+			_, err := interceptor(ctx, nil, info, handler)
+			assert.Equal(GinkgoT(), codes.Unauthenticated, status.Code(err))
+			assert.Contains(GinkgoT(), err.Error(), "public key is not configured")
+			assert.False(GinkgoT(), called)
+		})
+	})
+})
@@ -0,0 +1,95 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"engine/pkg/api/search"
+	"engine/pkg/config"
+	"engine/pkg/middleware"
+)
+
+// GRPCServer serve the grpc api on the grpc port, next to the http server
+type GRPCServer struct {
+	addr   string
+	server *grpc.Server
+	config *config.Config
+}
+
+// NewGRPCServer ...
+func NewGRPCServer(cfg *config.Config) *GRPCServer {
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			middleware.GRPCRecovery(),
+			middleware.GRPCRequestID(),
+			middleware.NewGRPCClientAuthInterceptor(cfg),
+		),
+	)
+	search.RegisterGRPC(server)
+
+	return &GRPCServer{
+		addr:   addr,
+		server: server,
+		config: cfg,
+	}
+}
+
+// Run serve until the ctx done, then stop gracefully
+func (s *GRPCServer) Run(ctx context.Context) {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("Stopping grpc server gracefully")
+		s.Stop()
+	}()
+
+	log.Infof("the grpc server listen on %s", s.addr)
+	if err := s.server.Serve(listener); err != nil {
+		panic(err)
+	}
+}
+
+// Stop will wait the running requests done within the grace timeout, then close all the connections
+func (s *GRPCServer) Stop() {
+	defer log.Info("GRPC server stopped")
+
+	graceTimeout := defaultGraceTimeout
+	if s.config.Server.GraceTimeout > 0 {
+		graceTimeout = time.Duration(s.config.Server.GraceTimeout) * time.Second
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(graceTimeout):
+		log.Error("Wait is over due to timeout")
+		s.server.Stop()
+	}
+}
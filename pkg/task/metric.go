@@ -21,6 +21,10 @@ const (
 	fullSyncType = "full_sync"
 	gapSyncType  = "gap_sync"
 	incrSyncType = "incr_sync"
+
+	groupMemberSyncType = "group_member_sync"
+
+	expiredPurgeType = "expired_purge"
 )
 
 // 记录任务中的metric信息
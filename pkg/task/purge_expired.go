@@ -0,0 +1,95 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"engine/pkg/indexer"
+	"engine/pkg/logging"
+	"engine/pkg/metric"
+	"engine/pkg/util"
+)
+
+// NOTE: 过期策略只在检索时过滤, 会一直保留在ES/eval引擎/快照中, 定时从所有引擎中清理掉
+
+// ExpiredPurger will purge the expired policies from all engines, each interval seconds.
+type ExpiredPurger struct {
+	interval      int64 // second
+	onSuccessFunc func()
+}
+
+// NewExpiredPurger ...
+func NewExpiredPurger(interval int64) Syncer {
+	return &ExpiredPurger{
+		interval:      interval,
+		onSuccessFunc: func() {},
+	}
+}
+
+// OnSuccess ...
+func (s *ExpiredPurger) OnSuccess(f func()) Syncer {
+	s.onSuccessFunc = f
+	return s
+}
+
+// Start ...
+func (s *ExpiredPurger) Start(ctx context.Context, idx *Indexer) {
+	logger := logging.GetSyncLogger()
+	taskID := util.RandString(16)
+	entry := logger.WithFields(logrus.Fields{
+		"task_id": taskID,
+		"type":    expiredPurgeType,
+	})
+
+	entry.Infof("start an expired purge task with interval = %v seconds", s.interval)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.interval) * time.Second)
+		for {
+			select {
+			case <-ticker.C:
+				err := syncWithMetrics(expiredPurgeType, func() error {
+					return purgeExpired(entry)
+				})
+				if err == nil {
+					s.onSuccessFunc()
+				}
+			case <-ctx.Done():
+				logger.Info("context done, the expired purger will stop running")
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func purgeExpired(logger *logrus.Entry) error {
+	counts, err := indexer.PurgeExpired(time.Now().Unix(), logger)
+
+	// NOTE: 部分引擎清理失败时, 已清理成功的数量也需要记录
+	for engine, count := range counts {
+		metric.ExpiredPolicyPurged.WithLabelValues(engine).Add(float64(count))
+	}
+
+	if err != nil {
+		logger.WithError(err).Error("purge the expired policies fail")
+		return fmt.Errorf("purge expired fail: %w", err)
+	}
+
+	logger.Infof("purge the expired policies success, counts=%v", counts)
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"engine/pkg/components"
+	"engine/pkg/indexer"
+	"engine/pkg/logging"
+	"engine/pkg/util"
+)
+
+// NOTE: 本地成员索引只保存expand_groups检索到的用户组, 定时全部刷新一次; 超过一天未被访问的用户组会被清理
+
+// groupMemberBatchSize 每次接口批量拉取的用户组数量
+const groupMemberBatchSize = 100
+
+// GroupMemberSyncer will refresh the members of the groups in local membership index, each interval seconds.
+type GroupMemberSyncer struct {
+	interval      int64 // second
+	onSuccessFunc func()
+}
+
+// NewGroupMemberSyncer ...
+func NewGroupMemberSyncer(interval int64) Syncer {
+	return &GroupMemberSyncer{
+		interval:      interval,
+		onSuccessFunc: func() {},
+	}
+}
+
+// OnSuccess ...
+func (s *GroupMemberSyncer) OnSuccess(f func()) Syncer {
+	s.onSuccessFunc = f
+	return s
+}
+
+// Start ...
+func (s *GroupMemberSyncer) Start(ctx context.Context, idx *Indexer) {
+	logger := logging.GetSyncLogger()
+	taskID := util.RandString(16)
+	entry := logger.WithFields(logrus.Fields{
+		"task_id": taskID,
+		"type":    groupMemberSyncType,
+	})
+
+	entry.Infof("start a group member sync task with interval = %v seconds", s.interval)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.interval) * time.Second)
+		for {
+			select {
+			case <-ticker.C:
+				err := syncWithMetrics(groupMemberSyncType, func() error {
+					return syncGroupMembers(entry)
+				})
+				if err == nil {
+					s.onSuccessFunc()
+				}
+			case <-ctx.Done():
+				logger.Info("context done, the group member syncer will stop running")
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func syncGroupMembers(logger *logrus.Entry) error {
+	count := indexer.EvictInactiveGroupMembers(time.Now().Unix() - oneDay)
+	if count > 0 {
+		logger.Infof("evict %d inactive groups from the membership index", count)
+	}
+
+	groupIDs := indexer.ListMemberGroupIDs()
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	logger.Infof("do the group member sync task, group count=%d", len(groupIDs))
+
+	client := components.NewIAMClient()
+	maxIndex := len(groupIDs)
+	for i := 0; i < maxIndex; i += groupMemberBatchSize {
+		endIndex := i + groupMemberBatchSize
+		if endIndex > maxIndex {
+			endIndex = maxIndex
+		}
+
+		ids := groupIDs[i:endIndex]
+		members, err := client.ListGroupMember(ids)
+		if err != nil {
+			logger.WithError(err).Errorf("ListGroupMember group_ids=`%v` fail", ids)
+			return fmt.Errorf("sync group member list member fail: %w", err)
+		}
+
+		indexer.BulkSetGroupMembers(ids, members)
+	}
+	return nil
+}
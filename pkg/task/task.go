@@ -111,6 +111,12 @@ func StartSync(ctx context.Context, cfg *config.Config) {
 	// start rmq cleaner
 	go startRmqCleaner()
 
+	// start group member sync, will refresh the local membership index every 60 seconds from now!
+	NewGroupMemberSyncer(60).Start(ctx, indexer)
+
+	// start expired policy purge, will purge every 1 hour from now!
+	NewExpiredPurger(60*60).Start(ctx, indexer)
+
 	// start timing grap incr, will sync 24 hour from now!
 	NewTimingGapIncrSyncer(24*60*60, snapshot).Start(ctx, indexer)
 
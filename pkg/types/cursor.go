@@ -0,0 +1,70 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// SearchCursor the position of cursor search
+// NOTE: all the engines return subjects sorted by subject uid, so the position is the last subject uid returned
+type SearchCursor struct {
+	// es search_after, sort by [subject.uid, id]
+	SearchAfter []interface{} `json:"search_after"`
+	// eval engine iteration position, the last subject uid
+	EvalAfter string `json:"eval_after"`
+	// es point in time id, only for the stream search in one request, not encoded into the cursor
+	PitID string `json:"-"`
+}
+
+// NewSearchCursor will create the cursor after the subject uid
+func NewSearchCursor(lastSubjectUID string) *SearchCursor {
+	return &SearchCursor{
+		// NOTE: skip all the docs of the last subject
+		SearchAfter: []interface{}{lastSubjectUID, int64(math.MaxInt64)},
+		EvalAfter:   lastSubjectUID,
+	}
+}
+
+// Encode will encode the cursor into an opaque string
+func (c *SearchCursor) Encode() (string, error) {
+	bs, err := jsoniter.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("cursor marshal fail: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// DecodeSearchCursor will decode the opaque string into cursor, return nil if the string is empty
+func DecodeSearchCursor(s string) (*SearchCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	var cursor SearchCursor
+	if err = jsoniter.Unmarshal(bs, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if len(cursor.SearchAfter) != 2 {
+		return nil, fmt.Errorf("invalid cursor: search_after should contain 2 values")
+	}
+	return &cursor, nil
+}
@@ -13,9 +13,11 @@ package types
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/TencentBlueKing/gopkg/collection/set"
+	"github.com/TencentBlueKing/iam-go-sdk/expression"
 	log "github.com/sirupsen/logrus"
 
 	"engine/pkg/logging/debug"
@@ -23,7 +25,9 @@ import (
 
 // SubjectTypeAll ...
 const (
-	SubjectTypeAll = "all"
+	SubjectTypeAll   = "all"
+	SubjectTypeGroup = "group"
+	SubjectTypeUser  = "user"
 )
 
 // ResourceNode ...
@@ -45,16 +49,394 @@ type Action struct {
 // SearchRequest ...
 type SearchRequest struct {
 	System   string   `json:"system" binding:"required" example:"bk_paas"`
-	Action   Action   `json:"action" binding:"required"`
+	Action   Action   `json:"action" binding:"omitempty"`
 	Resource Resource `json:"resource" binding:"required"`
 
+	// search the subjects of each action in one request, only for /search, exclusive with action
+	Actions []Action `json:"actions" binding:"required_without=Action,excluded_with=Action,omitempty,max=10,dive"`
+
+	SubjectType string `json:"subject_type" binding:"required,oneof=all group user" example:"all"`
+	// ! /search can only fetch limit subjects at once, use /cursor-search with cursor to fetch all subjects page by page
+	Limit int `json:"limit" binding:"min=-1,max=10000" example:"10"`
+
+	// the next_cursor returned by the previous page, empty for the first page
+	Cursor string `json:"cursor" example:""`
+
+	// expand the matched groups to their member users, only for subject_type all/user
+	ExpandGroups bool `json:"expand_groups" example:"false"`
+
+	// return the id/template_id/expired_at/type of the policies granting the permission with each subject
+	WithPolicies bool `json:"with_policies" example:"false"`
+
+	// only search the policies of the templates, empty for all the policies
+	TemplateIDs []int64 `json:"template_ids" binding:"omitempty,max=100,dive,gt=0" example:"1"`
+	// exclude the policies of the templates, only search the custom policies (template_id=0)
+	ExcludeTemplates bool `json:"exclude_templates" binding:"excluded_with=TemplateIDs" example:"false"`
+	// group the subjects by the template_id of the policies granting the permission, only for /search
+	GroupByTemplate bool `json:"group_by_template" example:"false"`
+
+	// only search in the candidate subjects, empty for all the subjects
+	Subjects []Subject `json:"subjects" binding:"omitempty,max=1000"`
+
+	// the timeout milliseconds of the search and count requests, 0 for the default, bounded by the max of the server
+	TimeoutMs int `json:"timeout_ms" binding:"min=0" example:"0"`
+
+	NowTimestamp int64
+	SearchCursor *SearchCursor `json:"-"`
+}
+
+// IsMultiAction return true if search the subjects of multiple actions
+func (r *SearchRequest) IsMultiAction() bool {
+	return len(r.Actions) > 0
+}
+
+// ActionRequests split the multi-action request into the requests of each action
+func (r *SearchRequest) ActionRequests() []*SearchRequest {
+	requests := make([]*SearchRequest, 0, len(r.Actions))
+	for _, action := range r.Actions {
+		req := *r
+		req.Action = action
+		req.Actions = nil
+		requests = append(requests, &req)
+	}
+	return requests
+}
+
+// ActionSubjects the subjects of the action, for the multi-action search
+type ActionSubjects struct {
+	Action   Action    `json:"action"`
+	Subjects []Subject `json:"subjects"`
+}
+
+// SearchSubjectType return the subject type to search in the engines
+// NOTE: 开启expand_groups时, 查询user需要同时查出group, 再展开为group的成员
+func (r *SearchRequest) SearchSubjectType() string {
+	if r.ExpandGroups && r.SubjectType == SubjectTypeUser {
+		return SubjectTypeAll
+	}
+	return r.SubjectType
+}
+
+// SubjectUIDSet return the uid set of the candidate subjects, nil if no candidate subjects
+func (r *SearchRequest) SubjectUIDSet() *set.StringSet {
+	if len(r.Subjects) == 0 {
+		return nil
+	}
+
+	subjectUIDs := set.NewFixedLengthStringSet(len(r.Subjects))
+	for _, s := range r.Subjects {
+		subjectUIDs.Add(s.Type + ":" + s.ID)
+	}
+	return subjectUIDs
+}
+
+// IsCandidate return true if the subject should be searched, subjectUIDs is the result of SubjectUIDSet
+// NOTE: 展开用户组时, 候选用户可能通过用户组获得权限, 所有用户组都需要检索, 展开成员后再过滤
+func (r *SearchRequest) IsCandidate(subjectUIDs *set.StringSet, subject *Subject) bool {
+	if subjectUIDs == nil {
+		return true
+	}
+	if r.ExpandGroups && r.SubjectType != SubjectTypeGroup && subject.Type == SubjectTypeGroup {
+		return true
+	}
+	return subjectUIDs.Has(subject.UID)
+}
+
+// MatchTemplate return true if the policies of the template should be searched
+func (r *SearchRequest) MatchTemplate(templateID int64) bool {
+	if r.ExcludeTemplates {
+		return templateID == 0
+	}
+	if len(r.TemplateIDs) == 0 {
+		return true
+	}
+
+	for _, id := range r.TemplateIDs {
+		if id == templateID {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplateSubjects the subjects granted by the policies of the template, template_id 0 for the custom policies
+type TemplateSubjects struct {
+	TemplateID int64     `json:"template_id"`
+	Subjects   []Subject `json:"subjects"`
+}
+
+// GroupSubjectsByTemplate group the subjects by the template_id of their policies, sorted by template_id
+// NOTE: subject有多个模板的策略时, 会出现在每个模板的分组中
+func GroupSubjectsByTemplate(subjects []Subject, keepPolicies bool) []TemplateSubjects {
+	groups := make([]TemplateSubjects, 0, 2)
+	// template_id => index of groups
+	groupIndexes := make(map[int64]int, 2)
+	for _, subject := range subjects {
+		templateIDs := make(map[int64]struct{}, len(subject.Policies))
+		for _, p := range subject.Policies {
+			templateIDs[p.TemplateID] = struct{}{}
+		}
+
+		s := subject
+		if !keepPolicies {
+			s.Policies = nil
+		}
+		for templateID := range templateIDs {
+			idx, ok := groupIndexes[templateID]
+			if !ok {
+				idx = len(groups)
+				groupIndexes[templateID] = idx
+				groups = append(groups, TemplateSubjects{TemplateID: templateID})
+			}
+			groups[idx].Subjects = append(groups[idx].Subjects, s)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].TemplateID < groups[j].TemplateID
+	})
+	return groups
+}
+
+// ResourceActionsSearchRequest search the subjects of all the actions applicable to the resource
+type ResourceActionsSearchRequest struct {
+	System   string   `json:"system" binding:"required" example:"bk_paas"`
+	Resource Resource `json:"resource" binding:"required,min=1"`
+
 	SubjectType string `json:"subject_type" binding:"required,oneof=all group user" example:"all"`
-	// ! we don't support pagination, we can only fetch limit subjects at once
+	// the limit of the subjects of each action
 	Limit int `json:"limit" binding:"min=-1,max=10000" example:"10"`
 
+	// expand the matched groups to their member users, only for subject_type all/user
+	ExpandGroups bool `json:"expand_groups" example:"false"`
+
+	NowTimestamp int64
+}
+
+// ActionRequests return the search requests of each action
+func (r *ResourceActionsSearchRequest) ActionRequests(actions []string) []*SearchRequest {
+	requests := make([]*SearchRequest, 0, len(actions))
+	for _, action := range actions {
+		requests = append(requests, &SearchRequest{
+			System:       r.System,
+			Action:       Action{ID: action},
+			Resource:     r.Resource,
+			SubjectType:  r.SubjectType,
+			Limit:        r.Limit,
+			ExpandGroups: r.ExpandGroups,
+			NowTimestamp: r.NowTimestamp,
+		})
+	}
+	return requests
+}
+
+// ExpiringSearchRequest search the subjects whose permission will expire within the days
+type ExpiringSearchRequest struct {
+	SearchRequest
+
+	// the latest expired_at of the subject's policies granting the permission is in [now, now + within_days days]
+	WithinDays int `json:"within_days" binding:"required,min=1,max=365" example:"7"`
+}
+
+// ExpireBefore return the deadline timestamp of the window
+func (r *ExpiringSearchRequest) ExpireBefore() int64 {
+	return r.NowTimestamp + int64(r.WithinDays)*24*60*60
+}
+
+// SubjectExpiry the subject with the latest expired_at of its policies granting the permission
+type SubjectExpiry struct {
+	Subject
+
+	ExpiredAt int64 `json:"expired_at"`
+}
+
+// SearchPhaseDone ...
+const (
+	SearchPhaseDone    = "done"
+	SearchPhaseTimeout = "timeout"
+	SearchPhaseError   = "error"
+	// the eval phase is not executed, the limit is reached by the doc phase or the doc phase fail
+	SearchPhaseSkipped = "skipped"
+)
+
+// SearchPhases the status of the doc(ES/memory) and eval phases of the search
+type SearchPhases struct {
+	Doc  string `json:"doc" example:"done"`
+	Eval string `json:"eval" example:"done"`
+}
+
+// Partial return true if the eval phase timeout after the doc phase done, the subjects are partial
+func (p SearchPhases) Partial() bool {
+	return p.Doc == SearchPhaseDone && p.Eval == SearchPhaseTimeout
+}
+
+// BatchSearchStatus ...
+const (
+	BatchSearchStatusOK      = "ok"
+	BatchSearchStatusTimeout = "timeout"
+	BatchSearchStatusError   = "error"
+)
+
+// BatchSearchItemStatus the status of each request in the batch search
+// NOTE: eval超时时返回的是部分结果, partial=true
+type BatchSearchItemStatus struct {
+	Status  string       `json:"status" example:"ok"`
+	Message string       `json:"message,omitempty"`
+	Partial bool         `json:"partial" example:"false"`
+	Phases  SearchPhases `json:"phases"`
+}
+
+// SearchPage the subjects of one page, sorted by subject uid and distinct
+type SearchPage struct {
+	Subjects []Subject
+	// the engine may have more subjects after the last one
+	HasMore bool
+	// the point in time id should be used by the next page, may be changed after each page
+	PitID string
+}
+
+// LastSubjectUID ...
+func (p *SearchPage) LastSubjectUID() string {
+	if len(p.Subjects) == 0 {
+		return ""
+	}
+	return p.Subjects[len(p.Subjects)-1].UID
+}
+
+// ExplainRequest ...
+type ExplainRequest struct {
+	System   string   `json:"system" binding:"required" example:"bk_paas"`
+	Action   Action   `json:"action" binding:"required"`
+	Resource Resource `json:"resource" binding:"required"`
+
+	SubjectType string `json:"subject_type" binding:"required,oneof=group user" example:"user"`
+	SubjectID   string `json:"subject_id" binding:"required" example:"admin"`
+
+	NowTimestamp int64
+}
+
+// SubjectUID ...
+func (r *ExplainRequest) SubjectUID() string {
+	return r.SubjectType + ":" + r.SubjectID
+}
+
+// ToSearchRequest convert to the search request of the subject type
+func (r *ExplainRequest) ToSearchRequest() *SearchRequest {
+	return &SearchRequest{
+		System:       r.System,
+		Action:       r.Action,
+		Resource:     r.Resource,
+		SubjectType:  r.SubjectType,
+		NowTimestamp: r.NowTimestamp,
+	}
+}
+
+// ExplainPolicy the policy granting the permission to the subject
+type ExplainPolicy struct {
+	ID         int64          `json:"id"`
+	TemplateID int64          `json:"template_id"`
+	ExpiredAt  int64          `json:"expired_at"`
+	Type       ExpressionType `json:"type"`
+
+	// only for eval policy
+	Expression *expression.ExprCell `json:"expression,omitempty"`
+	Trace      *EvalTrace           `json:"trace,omitempty"`
+}
+
+// EvalTrace the evaluation result of each node in the expression tree
+type EvalTrace struct {
+	OP     string `json:"op"`
+	Result bool   `json:"result"`
+
+	// for AND/OR
+	Content []EvalTrace `json:"content,omitempty"`
+
+	// for binary operator
+	Field       string      `json:"field,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+	ObjectValue interface{} `json:"object_value,omitempty"`
+}
+
+// ReverseSearchRequest ...
+type ReverseSearchRequest struct {
+	System string `json:"system" binding:"required" example:"bk_paas"`
+	Action Action `json:"action" binding:"required"`
+
+	SubjectType string `json:"subject_type" binding:"required,oneof=group user" example:"user"`
+	SubjectID   string `json:"subject_id" binding:"required" example:"admin"`
+
 	NowTimestamp int64
 }
 
+// SubjectUID ...
+func (r *ReverseSearchRequest) SubjectUID() string {
+	return r.SubjectType + ":" + r.SubjectID
+}
+
+// ResourceInstance ...
+type ResourceInstance struct {
+	System string      `json:"system"`
+	Type   string      `json:"type"`
+	ID     interface{} `json:"id"`
+}
+
+// ResourcePath ...
+type ResourcePath struct {
+	System string `json:"system"`
+	Type   string `json:"type"`
+	// starts_with: 属于该路径下的资源; string_contains: 路径中包含该节点的资源
+	Operator string `json:"operator"`
+	Path     string `json:"path"`
+}
+
+// ResourceAttribute ...
+type ResourceAttribute struct {
+	System    string        `json:"system"`
+	Type      string        `json:"type"`
+	Attribute string        `json:"attribute"`
+	Values    []interface{} `json:"values"`
+}
+
+// ReverseSearchResult ...
+type ReverseSearchResult struct {
+	Any        bool                `json:"any"`
+	Instances  []ResourceInstance  `json:"instances"`
+	Paths      []ResourcePath      `json:"paths"`
+	Attributes []ResourceAttribute `json:"attributes"`
+
+	// eval 策略无法展开为资源实例, 返回原始表达式
+	Expressions []expression.ExprCell `json:"expressions"`
+}
+
+// NewReverseSearchResult ...
+func NewReverseSearchResult() *ReverseSearchResult {
+	return &ReverseSearchResult{
+		Instances:   []ResourceInstance{},
+		Paths:       []ResourcePath{},
+		Attributes:  []ResourceAttribute{},
+		Expressions: []expression.ExprCell{},
+	}
+}
+
+// Merge ...
+func (r *ReverseSearchResult) Merge(other *ReverseSearchResult) {
+	if other == nil {
+		return
+	}
+
+	r.Any = r.Any || other.Any
+	r.Instances = append(r.Instances, other.Instances...)
+	r.Paths = append(r.Paths, other.Paths...)
+	r.Attributes = append(r.Attributes, other.Attributes...)
+	r.Expressions = append(r.Expressions, other.Expressions...)
+}
+
+// SystemAction ...
+type SystemAction struct {
+	System string
+	Action string
+}
+
 // Engine ...
 type Engine interface {
 	Size(system, action string) uint64
@@ -62,10 +444,28 @@ type Engine interface {
 
 	BulkDelete(ids []int64, logger *log.Entry) error
 	BulkDeleteBySubjects(beforeUpdatedAt int64, subjects []Subject, logger *log.Entry) error
+	// PurgeExpired delete the policies expired before the timestamp, return the count of policies deleted
+	PurgeExpired(beforeExpiredAt int64, logger *log.Entry) (uint64, error)
+
+	// ListActionsByIDs return the system actions of the policies, should be called before deleting
+	ListActionsByIDs(ids []int64) ([]SystemAction, error)
+	// ListActionsBySubjects return the system actions of the subjects' policies, should be called before deleting
+	ListActionsBySubjects(beforeUpdatedAt int64, subjects []Subject) ([]SystemAction, error)
+	// ListActionsByResource return the actions of the system having the policies of the resource types or any
+	ListActionsByResource(system string, resource Resource) ([]SystemAction, error)
 
 	Search(ctx context.Context, req *SearchRequest, entry *debug.Entry) (SearchResult, error)
 	BatchSearch(ctx context.Context, requests []*SearchRequest, entry *debug.Entry) (results []SearchResult, err error)
 
+	ReverseSearch(ctx context.Context, req *ReverseSearchRequest, entry *debug.Entry) (*ReverseSearchResult, error)
+	PageSearch(ctx context.Context, req *SearchRequest, size int, entry *debug.Entry) (*SearchPage, error)
+	// OpenPointInTime return the id of a consistent view for PageSearch, empty if the engine not support
+	OpenPointInTime(ctx context.Context) (string, error)
+	ClosePointInTime(ctx context.Context, pitID string) error
+	// SearchExpiredAt return the subjects with the latest expired_at of their policies granting the permission
+	SearchExpiredAt(ctx context.Context, req *SearchRequest, entry *debug.Entry) ([]SubjectExpiry, error)
+	Explain(ctx context.Context, req *ExplainRequest, entry *debug.Entry) ([]ExplainPolicy, error)
+
 	Total() uint64
 	GetLastIndexTime() time.Time
 
@@ -73,7 +473,21 @@ type Engine interface {
 	LoadSnapshot([]SnapRecord) error
 }
 
+// DocEngine the engine of the any/doc policies, count the subjects in the engine
+// NOTE: eval引擎的计数需要subject列表去重, 由indexer通过Search完成
+type DocEngine interface {
+	Engine
+
+	Count(ctx context.Context, req *SearchRequest, excludedSubjectUIDs []string, entry *debug.Entry) (uint64, error)
+	// SearchPolicies return all the policies matched of each subject uid, not limited by the limit of the request
+	SearchPolicies(ctx context.Context, req *SearchRequest, entry *debug.Entry) (map[string][]MatchedPolicy, error)
+}
+
 // SearchResult ...
 type SearchResult interface {
 	GetSubjects(allowedSubjectUIDs *set.StringSet) []Subject
+	// Partial return true if the search stopped by the ctx deadline, and the subjects are not complete
+	Partial() bool
+	// MatchedPolicies return the policies matched of each subject uid, empty if the request without with_policies
+	MatchedPolicies() map[string][]MatchedPolicy
 }
@@ -0,0 +1,19 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-权限中心检索引擎
+ * (BlueKing-IAM-Search-Engine) available.
+ * Copyright (C) 2017-2021 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package types
+
+// GroupMember the member of the group, the membership will expire at ExpiredAt
+type GroupMember struct {
+	GroupID   string  `json:"group_id" mapstructure:"group_id"`
+	Subject   Subject `json:"subject" mapstructure:"subject"`
+	ExpiredAt int64   `json:"expired_at" mapstructure:"expired_at"`
+}
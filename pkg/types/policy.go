@@ -61,6 +61,75 @@ type Policy struct {
 	ExpressionLength    int
 
 	ExpressionType ExpressionType // 表达式类型 any, doc, eval
+
+	// NOTE: 跨系统资源依赖时, 表达式中的资源类型来自于其他系统, 这里只记录不属于策略系统的资源类型
+	ResourceTypeSystems map[string]string `json:"resource_type_systems,omitempty" mapstructure:"-"`
+}
+
+// ResourceTypeSystem return the system of the resource type in the expression, default is the policy system
+func (p *Policy) ResourceTypeSystem(_type string) string {
+	if system, ok := p.ResourceTypeSystems[_type]; ok {
+		return system
+	}
+	return p.System
+}
+
+// MatchResourceTypes return true if the policy is any, or the expression has the resource type of any node
+// NOTE: 只用于发现资源相关的操作, 不代表策略对资源有权限
+func (p *Policy) MatchResourceTypes(resource Resource) bool {
+	if p.ExpressionType == Any {
+		return true
+	}
+
+	var walk func(expr *expression.ExprCell) bool
+	walk = func(expr *expression.ExprCell) bool {
+		for i := range expr.Content {
+			if walk(&expr.Content[i]) {
+				return true
+			}
+		}
+
+		if expr.Field == "" {
+			return false
+		}
+
+		_type := strings.SplitN(expr.Field, ".", 2)[0]
+		for _, node := range resource {
+			if node.Type == _type && node.System == p.ResourceTypeSystem(_type) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(&p.Expression)
+}
+
+// FillResourceTypeSystems record the resource types of the expression not belong to the policy system
+func (p *Policy) FillResourceTypeSystems(resourceTypeSystems map[string]string) {
+	var walk func(expr *expression.ExprCell)
+	walk = func(expr *expression.ExprCell) {
+		for i := range expr.Content {
+			walk(&expr.Content[i])
+		}
+
+		if expr.Field == "" {
+			return
+		}
+
+		_type := strings.SplitN(expr.Field, ".", 2)[0]
+		system, ok := resourceTypeSystems[_type]
+		if !ok || system == p.System {
+			return
+		}
+
+		if p.ResourceTypeSystems == nil {
+			p.ResourceTypeSystems = make(map[string]string, 1)
+		}
+		p.ResourceTypeSystems[_type] = system
+	}
+
+	walk(&p.Expression)
 }
 
 // FillUniqueFields ...
@@ -85,6 +154,28 @@ type Subject struct {
 	Name string `json:"name"`
 
 	UID string
+
+	// the policies granting the permission, only for the search with_policies
+	Policies []MatchedPolicy `json:"policies,omitempty" mapstructure:"-"`
+}
+
+// MatchedPolicy the metadata of the policy granting the permission to the subject
+type MatchedPolicy struct {
+	ID         int64 `json:"id"`
+	TemplateID int64 `json:"template_id"`
+	ExpiredAt  int64 `json:"expired_at"`
+	// the engine matched: any/doc/eval
+	Type ExpressionType `json:"type"`
+}
+
+// NewMatchedPolicy ...
+func NewMatchedPolicy(p *Policy, _type ExpressionType) MatchedPolicy {
+	return MatchedPolicy{
+		ID:         p.ID,
+		TemplateID: p.TemplateID,
+		ExpiredAt:  p.ExpiredAt,
+		Type:       _type,
+	}
 }
 
 // FillUID
@@ -103,6 +194,11 @@ type SnapRecord struct {
 	Action                string    `json:"action"`
 	LastModifiedTimestamp int64     `json:"last_modified_timestamp"`
 	EvalPolicies          []*Policy `json:"eval_policies"`
+
+	// NOTE: 只有doc engine为memory时才会保存any/doc策略
+	DocEngine        string    `json:"doc_engine,omitempty"`
+	DocPolicies      []*Policy `json:"doc_policies,omitempty"`
+	DocSchemaVersion int       `json:"doc_schema_version,omitempty"`
 }
 
 func (s *SnapRecord) FillPoliciesUniqueFields() (err error) {
@@ -112,5 +208,11 @@ func (s *SnapRecord) FillPoliciesUniqueFields() (err error) {
 			return err
 		}
 	}
+	for _, p := range s.DocPolicies {
+		err = p.FillUniqueFields()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -17,6 +17,8 @@ type ContextStringKey string // context.WithValue 的key需要定义一个自己
 const (
 	RequestIDKey       = "request_id"
 	RequestIDHeaderKey = "X-Request-Id"
+	// the subjects of the search result are partial, the eval phase timeout
+	SearchPartialHeaderKey = "X-Search-Partial"
 
 	ClientIDKey = "client_id"
 
@@ -27,4 +29,5 @@ const (
 	// NeverExpiresUnixTime = 4102444800
 
 	ContextRequestIDKey ContextStringKey = RequestIDKey // context.WithValue 的key需要定义一个自己的type
+	ContextClientIDKey  ContextStringKey = ClientIDKey  // grpc请求的client_id存放在context中
 )
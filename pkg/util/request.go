@@ -78,3 +78,14 @@ func BasicAuthAuthorizationHeader(user, password string) string {
 func GetContextWithRequestID(c *gin.Context) context.Context {
 	return context.WithValue(context.Background(), ContextRequestIDKey, GetRequestID(c))
 }
+
+// WithClientID return the context with the client id, for the grpc request
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return context.WithValue(ctx, ContextClientIDKey, clientID)
+}
+
+// GetClientIDFromContext return the client id of the grpc request
+func GetClientIDFromContext(ctx context.Context) string {
+	clientID, _ := ctx.Value(ContextClientIDKey).(string)
+	return clientID
+}
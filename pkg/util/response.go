@@ -15,10 +15,15 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
 )
 
+// NDJSONContentType the content type of the newline delimited json stream response
+const NDJSONContentType = "application/x-ndjson"
+
 // Response ...
 type Response struct {
 	Code    int         `json:"code"`
@@ -100,3 +105,62 @@ func SystemErrorJSONResponse(c *gin.Context, err error) {
 	SetError(c, err)
 	BaseErrorJSONResponse(c, SystemError, message)
 }
+
+// =============== ndjson stream response ===============
+
+// AcceptNDJSON return true if the client accept the ndjson stream response
+func AcceptNDJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), NDJSONContentType)
+}
+
+// NDJSONWriter write the items as the lines of json, the header is written before the first line
+type NDJSONWriter struct {
+	c       *gin.Context
+	encoder *jsoniter.Encoder
+}
+
+// NewNDJSONWriter ...
+func NewNDJSONWriter(c *gin.Context) *NDJSONWriter {
+	return &NDJSONWriter{
+		c:       c,
+		encoder: jsoniter.NewEncoder(c.Writer),
+	}
+}
+
+// Started return true if the response header has been written, can not response json any more
+func (w *NDJSONWriter) Started() bool {
+	return w.c.Writer.Written()
+}
+
+// Write write each item as one line, flush after all the items written
+func (w *NDJSONWriter) Write(items ...interface{}) error {
+	if !w.Started() {
+		w.c.Header("Content-Type", NDJSONContentType)
+		w.c.Status(http.StatusOK)
+	}
+
+	for _, item := range items {
+		if err := w.encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// Close write the header if no item written, the response is empty
+func (w *NDJSONWriter) Close() {
+	if !w.Started() {
+		w.c.Header("Content-Type", NDJSONContentType)
+		w.c.Status(http.StatusOK)
+		w.c.Writer.WriteHeaderNow()
+	}
+}
+
+// WriteError write the error as the last line with the code and message, the same as SystemErrorJSONResponse
+// NOTE: 已经开始写出数据后无法再修改状态码, 调用方通过最后一行是否有code判断是否出错
+func (w *NDJSONWriter) WriteError(err error) {
+	message := fmt.Sprintf("system error[request_id=%s]: %s", GetRequestID(w.c), err.Error())
+	SetError(w.c, err)
+	_ = w.Write(Response{Code: SystemError, Message: message, Data: gin.H{}})
+}
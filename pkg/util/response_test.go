@@ -15,6 +15,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http/httptest"
+	"strings"
 
 	"engine/pkg/util"
 
@@ -88,4 +89,50 @@ var _ = Describe("Response", func() {
 		assert.Equal(GinkgoT(), util.SystemError, got.Code)
 		assert.Contains(GinkgoT(), got.Message, "system error")
 	})
+
+	Describe("NDJSONWriter", func() {
+		It("AcceptNDJSON", func() {
+			c.Request = httptest.NewRequest("POST", "/", nil)
+			assert.False(GinkgoT(), util.AcceptNDJSON(c))
+
+			c.Request.Header.Set("Accept", "application/x-ndjson")
+			assert.True(GinkgoT(), util.AcceptNDJSON(c))
+		})
+
+		It("Write", func() {
+			writer := util.NewNDJSONWriter(c)
+			assert.False(GinkgoT(), writer.Started())
+
+			assert.NoError(GinkgoT(), writer.Write(gin.H{"id": "1"}, gin.H{"id": "2"}))
+			assert.True(GinkgoT(), writer.Started())
+			assert.NoError(GinkgoT(), writer.Write(gin.H{"id": "3"}))
+			writer.Close()
+
+			assert.Equal(GinkgoT(), 200, w.Code)
+			assert.Equal(GinkgoT(), util.NDJSONContentType, w.Header().Get("Content-Type"))
+			assert.Equal(GinkgoT(), "{\"id\":\"1\"}\n{\"id\":\"2\"}\n{\"id\":\"3\"}\n", w.Body.String())
+		})
+
+		It("empty", func() {
+			util.NewNDJSONWriter(c).Close()
+
+			assert.Equal(GinkgoT(), 200, w.Code)
+			assert.Equal(GinkgoT(), util.NDJSONContentType, w.Header().Get("Content-Type"))
+			assert.Empty(GinkgoT(), w.Body.String())
+		})
+
+		It("WriteError", func() {
+			writer := util.NewNDJSONWriter(c)
+			assert.NoError(GinkgoT(), writer.Write(gin.H{"id": "1"}))
+			writer.WriteError(errors.New("anError"))
+
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			assert.Len(GinkgoT(), lines, 2)
+
+			var got util.Response
+			assert.NoError(GinkgoT(), json.Unmarshal([]byte(lines[1]), &got))
+			assert.Equal(GinkgoT(), util.SystemError, got.Code)
+			assert.Contains(GinkgoT(), got.Message, "anError")
+		})
+	})
 })